@@ -33,8 +33,9 @@ type Mapper struct{}
 type T map[string]interface{}
 
 type ActionOption struct {
-	AutoMapForm bool
-	CheckXsrf   bool
+	AutoMapForm  bool
+	CheckXsrf    bool
+	StreamRender bool //Render writes to the client while the template runs
 }
 
 // An Action object or it's substruct is created for every incoming HTTP request.
@@ -48,9 +49,17 @@ type Action struct {
 	http.ResponseWriter
 	C             reflect.Value
 	session       *httpsession.Session
+	flash         *Flash
+	xsrf          XsrfManager
+	stream        *streamWriter
+	themeName     *string
+	locale        *string
+	user          *Principal
+	authenticator Authenticator
 	T             T
 	f             T
 	RootTemplate  *template.Template
+	Layout        string //default layout of Render
 	RequestBody   []byte
 	StatusCode    int
 	ResponseSize  int64
@@ -180,6 +189,81 @@ func (c *Action) IP() string {
 	return ip
 }
 
+// trustedProxy reports whether ip belongs to AppConfig.TrustedProxies.
+func (c *Action) trustedProxy(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, proxy := range c.App.AppConfig.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, cidr, err := net.ParseCIDR(proxy); err == nil && cidr.Contains(addr) {
+				return true
+			}
+		} else if p := net.ParseIP(proxy); p != nil && p.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// connIP returns the ip of the connection.
+func (c *Action) connIP() string {
+	ip, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		ip = strings.TrimSpace(c.Request.RemoteAddr)
+	}
+	return ip
+}
+
+// requestScheme returns the scheme the client used, which unlike Scheme
+// can't be forged by the client: https on tls, else the X-Forwarded-Proto
+// of a trusted proxy, else http.
+func (c *Action) requestScheme() string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	if c.trustedProxy(c.connIP()) {
+		proto := c.Header("X-Forwarded-Proto")
+		if i := strings.IndexByte(proto, ','); i >= 0 {
+			proto = proto[:i]
+		}
+		if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	return "http"
+}
+
+// RemoteIP returns the ip of the client which can't be forged by the client:
+// the address of the connection, or when that is one of the trusted proxies
+// the last address of X-Forwarded-For which is not a trusted proxy.
+func (c *Action) RemoteIP() string {
+	ip := c.connIP()
+	if !c.trustedProxy(ip) {
+		return ip
+	}
+	forwarded := c.Header("X-Forwarded-For")
+	if forwarded == "" {
+		if real := strings.TrimSpace(c.Header("X-Real-Ip")); real != "" {
+			return real
+		}
+		return ip
+	}
+	hops := strings.Split(forwarded, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !c.trustedProxy(hop) {
+			return hop
+		}
+		ip = hop
+	}
+	return ip
+}
+
 // Proxy returns proxy client ips slice.
 func (c *Action) Proxy() []string {
 	if ips := c.Header("X-Forwarded-For"); ips != "" {
@@ -285,47 +369,58 @@ func (c *Action) SetBody(content []byte) error {
 		return nil
 	}
 	output_writer := c.ResponseWriter.(io.Writer)
+	encoder := c.contentEncoder()
+	if encoder != nil {
+		output_writer = encoder
+	} else {
+		c.SetHeader("Content-Length", strconv.Itoa(len(content)))
+	}
+	size, err := output_writer.Write(content)
+	c.ResponseSize += int64(size)
+	if encoder != nil {
+		encoder.Close()
+	}
+	return err
+}
+
+// contentEncoder returns a gzip or deflate writer on the response and sets
+// Content-Encoding, if gzip is enabled and the client accepts one of them.
+func (c *Action) contentEncoder() flushWriteCloser {
 	if c.App.Server.Config.EnableGzip == true && c.Header("Accept-Encoding") != "" {
 		splitted := strings.SplitN(c.Header("Accept-Encoding"), ",", -1)
-		encodings := make([]string, len(splitted))
-
-		for i, val := range splitted {
-			encodings[i] = strings.TrimSpace(val)
-		}
-		for _, val := range encodings {
+		for _, val := range splitted {
+			val = strings.TrimSpace(val)
 			if val == "gzip" {
 				c.SetHeader("Content-Encoding", "gzip")
-				output_writer, _ = gzip.NewWriterLevel(c.ResponseWriter, gzip.BestSpeed)
-				break
+				w, _ := gzip.NewWriterLevel(c.ResponseWriter, gzip.BestSpeed)
+				return w
 			} else if val == "deflate" {
 				c.SetHeader("Content-Encoding", "deflate")
-				output_writer, _ = flate.NewWriter(c.ResponseWriter, flate.BestSpeed)
-				break
+				w, _ := flate.NewWriter(c.ResponseWriter, flate.BestSpeed)
+				return w
 			}
 		}
-	} else {
-		c.SetHeader("Content-Length", strconv.Itoa(len(content)))
 	}
-	size, err := output_writer.Write(content)
-	c.ResponseSize += int64(size)
-	switch output_writer.(type) {
-	case *gzip.Writer:
-		output_writer.(*gzip.Writer).Close()
-	case *flate.Writer:
-		output_writer.(*flate.Writer).Close()
+	return nil
+}
+
+func (c *Action) xsrfManager() XsrfManager {
+	if c.xsrf == nil {
+		c.xsrf = c.App.newXsrfManager(c)
 	}
-	return err
+	return c.xsrf
 }
 
+// XsrfValue returns the xsrf token masked with a new random pad, it can be
+// sent back in the _xsrf form field, the X-XSRF-Token header or a json body.
 func (c *Action) XsrfValue() string {
-	c.App.XsrfManager.Init(c)
 	var name string = c.App.AppConfig.CookiePrefix + XSRF_TAG
-	var val string = c.App.XsrfManager.Get(name)
+	var val string = c.xsrfManager().Get(name)
 	if val == "" {
 		val = uuid.NewRandom().String()
-		c.App.XsrfManager.Set(name, val)
+		c.xsrfManager().Set(name, val)
 	}
-	return val
+	return maskXsrfToken(val)
 }
 
 func (c *Action) XsrfFormHtml() template.HTML {
@@ -436,12 +531,47 @@ func (c *Action) SetContentType(val string) string {
 	return ctype
 }
 
-// SetCookie adds a cookie header to the response.
-func (c *Action) SetCookie(cookie *http.Cookie) {
-	c.SetHeader("Set-Cookie", cookie.String())
+// SetCookie adds a cookie header to the response, the options given
+// replace the attributes of the cookie.
+func (c *Action) SetCookie(cookie *http.Cookie, options ...*CookieOptions) {
+	if len(options) > 0 {
+		options[0].Apply(cookie)
+	}
+	c.ResponseWriter.Header().Add("Set-Cookie", cookie.String())
+}
+
+// CookieOptions returns the default cookie attributes of the App,
+// to be changed and passed to NewCookie.
+func (c *Action) CookieOptions() *CookieOptions {
+	return &CookieOptions{
+		MaxAge:   int64(c.App.AppConfig.SessionTimeout / time.Second),
+		Path:     "/",
+		Domain:   c.App.AppConfig.CookieDomain,
+		Secure:   c.IsSecure(),
+		HttpOnly: true,
+		SameSite: c.App.AppConfig.CookieSameSite,
+	}
 }
 
 func (c *Action) NewCookie(name string, value string, args ...interface{}) *http.Cookie {
+	if len(args) > 0 {
+		var o CookieOptions
+		switch v := args[0].(type) {
+		case *CookieOptions:
+			o = *v
+		case CookieOptions:
+			o = v
+		}
+		if o != (CookieOptions{}) {
+			if o.Path == "" {
+				o.Path = "/"
+			}
+			if o.Domain == "" {
+				o.Domain = c.App.AppConfig.CookieDomain
+			}
+			return o.Cookie(c.App.AppConfig.CookiePrefix+name, value)
+		}
+	}
 	length := len(args)
 	if length < 1 {
 		args = append(args, c.App.AppConfig.SessionTimeout)
@@ -473,48 +603,74 @@ func (c *Action) CookieAuthKey() string {
 	return key
 }
 
+// cookieContext is what the signature of secure cookies is bound to
+// besides the keys
+func (c *Action) cookieContext() []string {
+	context := make([]string, 0, 2)
+	if c.App.AppConfig.CookieLimitIP {
+		context = append(context, c.IP())
+	}
+	if c.App.AppConfig.CookieLimitUA {
+		context = append(context, c.UserAgent())
+	}
+	return context
+}
+
+// SetSecureCookie stores val signed by the App's CookieCodec, the client
+// can read it but not change it.
 func (c *Action) SetSecureCookie(name string, val string, args ...interface{}) {
-	//base64 encode the val
-	if len(c.App.AppConfig.CookieSecret) == 0 {
+	codec := c.App.cookieCodec()
+	if len(codec.Keys) == 0 {
 		c.App.Error("Secret Key for secure cookies has not been set. Please assign a cookie secret to web.Config.CookieSecret.")
 		return
 	}
-	vs := str.Base64Encode(val)
-	vb := []byte(vs)
-	key := c.CookieAuthKey()
-	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
-	sig := str.Token(key, vb, timestamp)
-	cookie := strings.Join([]string{vs, timestamp, sig}, "|")
-	c.SetCookie(c.NewCookie(name, cookie, args...))
+	c.SetCookie(c.NewCookie(name, codec.Encode(name, val, c.cookieContext()...), args...))
 }
 
 func (c *Action) GetSecureCookie(name string) (string, bool) {
-	if cookie, err := c.GetCookie(name); err == nil {
-		parts := strings.SplitN(cookie.Value, "|", 3)
-		if len(parts) < 3 {
-			return "", false
-		}
-		val := parts[0]
-		timestamp := parts[1]
-		sig := parts[2]
-
-		key := c.CookieAuthKey()
-
-		if str.Token(key, []byte(val), timestamp) != sig {
-			c.SetCookie(NewCookie(name, "", -86400))
-			return "", false
+	cookie, err := c.GetCookie(name)
+	if err != nil {
+		return "", false
+	}
+	codec := c.App.cookieCodec()
+	var val string
+	if IsLegacySignedCookie(cookie.Value) {
+		if time.Now().After(c.App.AppConfig.LegacyCookieUntil) {
+			err = ErrCookieSignature
+		} else {
+			val, err = codec.DecodeLegacy(cookie.Value, c.CookieAuthKey())
 		}
+	} else {
+		val, err = codec.Decode(name, cookie.Value, c.cookieContext()...)
+	}
+	if err != nil {
+		c.SetCookie(c.NewCookie(name, "", -86400))
+		return "", false
+	}
+	return val, true
+}
 
-		ts, _ := strconv.ParseInt(timestamp, 0, 64)
-
-		if time.Now().Unix()-31*86400 > ts {
-			c.SetCookie(NewCookie(name, "", -86400))
-			return "", false
-		}
+// SetEncryptedCookie stores val encrypted by the App's Cryptor, so that the
+// client can neither read nor change it.
+func (c *Action) SetEncryptedCookie(name string, val string, args ...interface{}) {
+	if len(c.App.AppConfig.CookieSecret) == 0 {
+		c.App.Error("Secret Key for secure cookies has not been set. Please assign a cookie secret to web.Config.CookieSecret.")
+		return
+	}
+	c.SetCookie(c.NewCookie(name, c.App.Cryptor.Encode(val, c.CookieAuthKey()), args...))
+}
 
-		return str.Base64Decode(val), true
+func (c *Action) GetEncryptedCookie(name string) (string, bool) {
+	cookie, err := c.GetCookie(name)
+	if err != nil {
+		return "", false
+	}
+	val, err := c.App.Cryptor.Decode(cookie.Value, c.CookieAuthKey())
+	if err != nil {
+		c.SetCookie(c.NewCookie(name, "", -86400))
+		return "", false
 	}
-	return "", false
+	return val, true
 }
 
 func (c *Action) Method() string {
@@ -614,81 +770,67 @@ type ActionInformation struct {
 
 // Include method provide to template for {{include "xx.tmpl"}}
 func (c *Action) Include(tmplName string) interface{} {
-	t := c.RootTemplate.New(tmplName)
-	t.Funcs(c.GetFuncs())
-
-	content, err := c.getTemplate(tmplName)
-	if err != nil {
-		errMsg := fmt.Sprintf("RenderTemplate %v read err: %s", tmplName, err)
-		c.Error(errMsg)
-		return errMsg
-	}
-
-	constr := string(content)
-
-	Event("BeforeRender", &ActionInformation{c, &constr, nil}, func(_ bool) {})
-
-	tmpl, err := t.Parse(constr)
-	if err != nil {
-		errMsg := fmt.Sprintf("Parse %v err: %v", tmplName, err)
-		c.Error(errMsg)
-		return errMsg
-	}
 	newbytes := bytes.NewBufferString("")
-	err = tmpl.Execute(newbytes, c.C.Elem().Interface())
-	if err != nil {
-		errMsg := fmt.Sprintf("Parse %v err: %v", tmplName, err)
-		c.Error(errMsg)
-		return errMsg
+	var err error
+	if e, ok := c.App.TemplateEngine.(*HtmlTemplateEngine); ok {
+		// an included template gets no default layout
+		err = e.render(newbytes, tmplName, "", c.C.Elem().Interface(), c)
+	} else {
+		err = c.App.TemplateEngine.Render(newbytes, tmplName, c.C.Elem().Interface(), c)
 	}
-
-	tplcontent, err := ioutil.ReadAll(newbytes)
 	if err != nil {
-		errMsg := fmt.Sprintf("Parse %v err: %v", tmplName, err)
+		errMsg := fmt.Sprintf("RenderTemplate %v err: %v", tmplName, err)
 		c.Error(errMsg)
 		return errMsg
 	}
-	return template.HTML(string(tplcontent))
-}
-
-// render the template with vars map, you can have zero or one map
-func (c *Action) NamedRender(name, content string, params ...*T) error {
-	c.f["include"] = c.Include
+	return template.HTML(newbytes.String())
+}
+
+// requestFuncs are the template functions bound to the request.
+func (c *Action) requestFuncs() T {
+	funcs := T{
+		"include":      c.Include,
+		"cookie":       c.Cookie,
+		"flashes":      c.Flash().Messages,
+		"cspNonce":     c.CSPNonce,
+		"XsrfFormHtml": c.XsrfFormHtml,
+		"XsrfValue":    c.XsrfValue,
+		"flush":        c.flushStream,
+		"StaticUrl":    c.StaticUrl,
+		"T":            c.Tr,
+	}
 	if c.App.AppConfig.SessionOn {
-		c.f["session"] = c.GetSession
+		funcs["session"] = c.GetSession
 	} else {
-		c.f["session"] = func(key string) interface{} {
+		funcs["session"] = func(key string) interface{} {
 			return ""
 		}
 	}
-	c.f["cookie"] = c.Cookie
-	c.f["XsrfFormHtml"] = c.XsrfFormHtml
-	c.f["XsrfValue"] = c.XsrfValue
+	return funcs
+}
+
+func (c *Action) prepareRender(params []*T) {
+	for k, v := range c.requestFuncs() {
+		c.f[k] = v
+	}
 	if len(params) > 0 {
 		c.MultiAssign(params[0])
 	}
+}
 
-	c.RootTemplate = template.New(name)
-	c.RootTemplate.Funcs(c.GetFuncs())
-
-	Event("BeforeRender", &ActionInformation{c, &content, nil}, func(_ bool) {})
-
-	tmpl, err := c.RootTemplate.Parse(content)
-	if err != nil {
-		c.SetBody([]byte(fmt.Sprintf("%v", err)))
-		return err
+// renderBody runs exec and makes its output the body, AfterRender may
+// change it. With Option.StreamRender the output is streamed instead.
+func (c *Action) renderBody(exec func(w io.Writer) error) error {
+	if c.Option != nil && c.Option.StreamRender {
+		return c.streamBody(exec)
 	}
 	newbytes := bytes.NewBufferString("")
-	err = tmpl.Execute(newbytes, c.C.Elem().Interface())
-	if err != nil {
-		c.SetBody([]byte(fmt.Sprintf("%v", err)))
-		return err
-	}
-	tplcontent, err := ioutil.ReadAll(newbytes)
-	if err != nil {
+	if err := exec(newbytes); err != nil {
 		c.SetBody([]byte(fmt.Sprintf("%v", err)))
 		return err
 	}
+	tplcontent := newbytes.Bytes()
+	var err error
 	Event("AfterRender", &ActionInformation{c, nil, &tplcontent}, func(result bool) {
 		if result {
 			err = c.SetBody(tplcontent)
@@ -697,38 +839,52 @@ func (c *Action) NamedRender(name, content string, params ...*T) error {
 	return err
 }
 
-func (c *Action) getTemplate(tmpl string) ([]byte, error) {
-	if c.App.AppConfig.CacheTemplates {
-		return c.App.TemplateMgr.GetTemplate(tmpl)
-	}
-	path := c.App.getTemplatePath(tmpl)
-	if path == "" {
-		return nil, errors.New(fmt.Sprintf("No template file %v found", path))
-	}
+// render the template with vars map, you can have zero or one map.
+// content is always rendered by html/template, whatever App.TemplateEngine
+// is. It may extend a layout, see Render.
+func (c *Action) NamedRender(name, content string, params ...*T) error {
+	c.prepareRender(params)
+	return c.renderBody(func(w io.Writer) error {
+		return c.App.htmlEngine.renderContent(w, name, content, "", c.C.Elem().Interface(), c, true)
+	})
+}
 
-	return ioutil.ReadFile(path)
+func (c *Action) getTemplate(tmpl string) ([]byte, error) {
+	return c.App.themeContent(c, tmpl)
 }
 
-// render the template with vars map, you can have zero or one map
+// render the template with vars map, you can have zero or one map. The
+// template is rendered by App.TemplateEngine, by default html/template
+// with layouts:
+//
+// A template can extend a layout, {{extends "layouts/main"}} has to be its
+// first action. The layout declares blocks, {{block "title" .}}default{{end}},
+// which the template overrides with {{define "title"}}...{{end}} or with
+// blocks of its own, a layout can extend another one. A template without a
+// "content" block fills the content block with its body, unless the body
+// is blank. Templates which extend nothing are put into c.Layout, which is
+// AppConfig.Layout or the layout tag of the Mapper.
+//
+// With c.Option.StreamRender, or AppConfig.StreamRender, the page is sent
+// while the template runs, {{flush}} sends what has been written so far.
 func (c *Action) Render(tmpl string, params ...*T) error {
-	content, err := c.getTemplate(tmpl)
-	if err == nil {
-		err = c.NamedRender(tmpl, string(content), params...)
-	}
-	if err != nil {
-		c.SetBody([]byte(fmt.Sprintf("%v", err)))
-	}
-	return err
+	c.prepareRender(params)
+	return c.renderBody(func(w io.Writer) error {
+		return c.App.TemplateEngine.Render(w, tmpl, c.C.Elem().Interface(), c)
+	})
 }
 
+// GetFuncs returns the template functions of the request, those of the app
+// and those assigned to the action, in a new map.
 func (c *Action) GetFuncs() template.FuncMap {
-	funcs := c.App.FuncMaps
-	if c.f != nil {
-		for k, v := range c.f {
-			funcs[k] = v
-		}
+	appFuncs := c.App.TemplateFuncs()
+	funcs := make(template.FuncMap, len(appFuncs)+len(c.f))
+	for k, v := range appFuncs {
+		funcs[k] = v
+	}
+	for k, v := range c.f {
+		funcs[k] = v
 	}
-
 	return funcs
 }
 
@@ -748,8 +904,14 @@ func (c *Action) GetConfigString(name string) string {
 	return c.App.GetConfigString(name)
 }
 
+// RenderString renders content like NamedRender, but the compiled template
+// is not cached: the content may be different every time. Use NamedRender
+// for content which is rendered again and again.
 func (c *Action) RenderString(content string, params ...*T) error {
-	return c.NamedRender(str.Md5(content), content, params...)
+	c.prepareRender(params)
+	return c.renderBody(func(w io.Writer) error {
+		return c.App.htmlEngine.renderContent(w, str.Md5(content), content, "", c.C.Elem().Interface(), c, false)
+	})
 }
 
 // SetHeader sets a response header. the current value
@@ -893,6 +1055,38 @@ func (c *Action) Session() *httpsession.Session {
 	return c.session
 }
 
+// regenerateSession moves the session of the request to a new id, see
+// httpsession.Manager.Regenerate. A request without a session gets a new one.
+func (c *Action) regenerateSession() error {
+	session := c.existingSession()
+	if session == nil {
+		c.Session()
+		return nil
+	}
+	regenerated, err := c.App.SessionManager.Regenerate(c.Request, c.ResponseWriter, session)
+	if err != nil {
+		return err
+	}
+	c.session = regenerated
+	return nil
+}
+
+// existingSession returns the session of the request without creating one,
+// nil when the request does not carry the id of a stored session.
+func (c *Action) existingSession() *httpsession.Session {
+	if c.session != nil {
+		return c.session
+	}
+	if !c.App.AppConfig.SessionOn || c.App.SessionManager == nil {
+		return nil
+	}
+	id, err := c.App.SessionManager.Transfer().Get(c.Request)
+	if err != nil || id == "" || !c.App.SessionManager.Store().Exist(id) {
+		return nil
+	}
+	return c.Session()
+}
+
 func (c *Action) GetSession(key string) interface{} {
 	return c.Session().Get(key)
 }
@@ -906,3 +1100,118 @@ func (c *Action) DelSession(keys ...string) {
 		c.Session().Del(key)
 	}
 }
+
+// GetSessionString returns the session value of key as a string, "" when
+// there is none. Values of other types are formatted with %v.
+func (c *Action) GetSessionString(key string) string {
+	switch v := c.GetSession(key).(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// GetSessionInt returns the session value of key as an integer. Floats are
+// truncated, strings are parsed, anything else is 0.
+func (c *Action) GetSessionInt(key string) int64 {
+	switch v := c.GetSession(key).(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
+
+// GetSessionBool returns the session value of key as a bool. Strings are
+// parsed by strconv.ParseBool, numbers are true when not 0.
+func (c *Action) GetSessionBool(key string) bool {
+	switch v := c.GetSession(key).(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	case nil:
+		return false
+	}
+	return c.GetSessionInt(key) != 0
+}
+
+// SessionEncode stores v as json, so that any session store can keep it.
+func (c *Action) SessionEncode(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.SetSession(key, string(b))
+	return nil
+}
+
+// SessionDecode fills the struct pointed to by v with the session value of key.
+// The value may be json (see SessionEncode) or a value of the same type.
+func (c *Action) SessionDecode(key string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("SessionDecode needs a non-nil pointer")
+	}
+	val := c.GetSession(key)
+	switch sv := val.(type) {
+	case nil:
+		return errors.New("No session value for " + key)
+	case string:
+		return json.Unmarshal([]byte(sv), v)
+	case []byte:
+		return json.Unmarshal(sv, v)
+	}
+	vv := reflect.ValueOf(val)
+	if vv.Type().AssignableTo(rv.Elem().Type()) {
+		rv.Elem().Set(vv)
+		return nil
+	}
+	if vv.Kind() == reflect.Ptr && !vv.IsNil() && vv.Elem().Type().AssignableTo(rv.Elem().Type()) {
+		rv.Elem().Set(vv.Elem())
+		return nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Flash returns the one-shot messages of the current session.
+func (c *Action) Flash() *Flash {
+	if c.flash == nil {
+		c.flash = NewFlash(c)
+	}
+	return c.flash
+}
@@ -0,0 +1,174 @@
+package xweb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var ErrDecrypt = errors.New("the encrypted data is invalid or was forged")
+
+const aeadVersion byte = 1
+
+// aeadDerivedKeys bounds the cache of keys derived from authKeys, which
+// contain the client's ip and user agent under CookieLimitIP/UA.
+const aeadDerivedKeys = 1024
+
+// AeadKey is one key of the key ring of an AeadCrypto.
+type AeadKey struct {
+	Id   uint32
+	aead cipher.AEAD
+}
+
+// NewAeadKey derives an AES-256-GCM key and its id from the secret by HKDF,
+// so any string of enough entropy can be used as the secret.
+func NewAeadKey(secret string) (*AeadKey, error) {
+	kdf := hkdf.New(sha256.New, []byte(secret), nil, []byte("xweb cryptor"))
+	key := make([]byte, 32+4)
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AeadKey{Id: binary.BigEndian.Uint32(key[32:]), aead: aead}, nil
+}
+
+// AeadCrypto encrypts with AES-GCM and a random nonce, so that any change of
+// the encrypted data is detected by Decode.
+//
+// The output is version | key id | nonce | ciphertext, base64 url encoded.
+// With a key ring the first key encrypts and every key decrypts, which
+// allows rotating keys; the authKey passed to Encode and Decode is then
+// only authenticated along with the data. Without a key ring the key is
+// derived from the authKey itself.
+//
+// Data encrypted by AesCrypto, the default cryptor of older versions, can
+// not be decoded. To migrate, set Legacy to &AesCrypto{} until the old
+// cookies have expired: data which AES-GCM can not decode is then given
+// to it. AesCrypto does not detect forged data, so remove Legacy
+// afterwards.
+type AeadCrypto struct {
+	Keys    []*AeadKey
+	Legacy  Cryptor
+	derived map[string]*AeadKey
+	lock    sync.RWMutex
+}
+
+// NewAeadCrypto creates a cryptor with a key ring made of the secrets,
+// the first one is used to encrypt.
+func NewAeadCrypto(secrets ...string) (*AeadCrypto, error) {
+	c := &AeadCrypto{
+		Keys:    make([]*AeadKey, 0, len(secrets)),
+		derived: make(map[string]*AeadKey),
+	}
+	for _, secret := range secrets {
+		key, err := NewAeadKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		c.Keys = append(c.Keys, key)
+	}
+	return c, nil
+}
+
+func (c *AeadCrypto) derive(authKey string) (*AeadKey, error) {
+	c.lock.RLock()
+	key, ok := c.derived[authKey]
+	c.lock.RUnlock()
+	if ok {
+		return key, nil
+	}
+	key, err := NewAeadKey(authKey)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	if c.derived == nil || len(c.derived) >= aeadDerivedKeys {
+		c.derived = make(map[string]*AeadKey)
+	}
+	c.derived[authKey] = key
+	c.lock.Unlock()
+	return key, nil
+}
+
+// keys returns the keys to try for the given id and the additional data
+func (c *AeadCrypto) keys(id uint32, authKey string, header []byte) ([]*AeadKey, []byte, error) {
+	if len(c.Keys) == 0 {
+		key, err := c.derive(authKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*AeadKey{key}, header, nil
+	}
+	keys := make([]*AeadKey, 0, 1)
+	for _, key := range c.Keys {
+		if key.Id == id {
+			keys = append(keys, key)
+		}
+	}
+	return keys, append(header, authKey...), nil
+}
+
+func (c *AeadCrypto) Encode(rawData, authKey string) string {
+	var key *AeadKey
+	var err error
+	if len(c.Keys) > 0 {
+		key = c.Keys[0]
+	} else if key, err = c.derive(authKey); err != nil {
+		return ""
+	}
+	nonceSize := key.aead.NonceSize()
+	out := make([]byte, 5+nonceSize, 5+nonceSize+len(rawData)+key.aead.Overhead())
+	out[0] = aeadVersion
+	binary.BigEndian.PutUint32(out[1:5], key.Id)
+	if _, err = io.ReadFull(rand.Reader, out[5:]); err != nil {
+		return ""
+	}
+	_, ad, _ := c.keys(key.Id, authKey, out[:5:5])
+	out = key.aead.Seal(out, out[5:], []byte(rawData), ad)
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+func (c *AeadCrypto) Decode(cryptedData, authKey string) (string, error) {
+	out, err := c.decode(cryptedData, authKey)
+	if err != nil && c.Legacy != nil {
+		return c.Legacy.Decode(cryptedData, authKey)
+	}
+	return out, err
+}
+
+func (c *AeadCrypto) decode(cryptedData, authKey string) (string, error) {
+	in, err := base64.RawURLEncoding.DecodeString(cryptedData)
+	if err != nil || len(in) < 5 || in[0] != aeadVersion {
+		return "", ErrDecrypt
+	}
+	keys, ad, err := c.keys(binary.BigEndian.Uint32(in[1:5]), authKey, in[:5:5])
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		nonceSize := key.aead.NonceSize()
+		if len(in) < 5+nonceSize {
+			continue
+		}
+		out, err := key.aead.Open(nil, in[5:5+nonceSize], in[5+nonceSize:], ad)
+		if err == nil {
+			return string(out), nil
+		}
+	}
+	return "", ErrDecrypt
+}
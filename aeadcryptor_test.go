@@ -0,0 +1,78 @@
+package xweb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAeadCrypto(t *testing.T) {
+	ring, err := NewAeadCrypto("new secret", "old secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []*AeadCrypto{{}, ring} {
+		data := c.Encode("hello", "auth")
+		if data == c.Encode("hello", "auth") {
+			t.Error("the nonce should be random")
+		}
+		if v, err := c.Decode(data, "auth"); err != nil || v != "hello" {
+			t.Errorf("expected hello, got %q %v", v, err)
+		}
+		if _, err := c.Decode(data, "other"); err != ErrDecrypt {
+			t.Errorf("another authKey should fail, got %v", err)
+		}
+		// the last character also carries padding bits, leave it out
+		for i := 0; i < len(data)-1; i++ {
+			forged := []byte(data)
+			if forged[i] == 'A' {
+				forged[i] = 'B'
+			} else {
+				forged[i] = 'A'
+			}
+			if v, err := c.Decode(string(forged), "auth"); err == nil {
+				t.Errorf("forged byte %d was accepted as %q", i, v)
+			}
+		}
+	}
+}
+
+func TestAeadCryptoKeyRotation(t *testing.T) {
+	old, _ := NewAeadCrypto("old secret")
+	rotated, _ := NewAeadCrypto("new secret", "old secret")
+	dropped, _ := NewAeadCrypto("new secret")
+
+	data := old.Encode("hello", "auth")
+	if v, err := rotated.Decode(data, "auth"); err != nil || v != "hello" {
+		t.Errorf("the old key should still decrypt, got %q %v", v, err)
+	}
+	if _, err := dropped.Decode(data, "auth"); err != ErrDecrypt {
+		t.Errorf("a dropped key should not decrypt, got %v", err)
+	}
+	if v, err := dropped.Decode(rotated.Encode("hello", "auth"), "auth"); err != nil || v != "hello" {
+		t.Errorf("the new key should encrypt, got %q %v", v, err)
+	}
+}
+
+func TestAeadCryptoLegacy(t *testing.T) {
+	data := (&AesCrypto{}).Encode("hello", "auth")
+	if _, err := (&AeadCrypto{}).Decode(data, "auth"); err != ErrDecrypt {
+		t.Errorf("AesCrypto data should not be read without Legacy, got %v", err)
+	}
+	c := &AeadCrypto{Legacy: &AesCrypto{}}
+	if v, err := c.Decode(data, "auth"); err != nil || v != "hello" {
+		t.Errorf("expected hello from the legacy cryptor, got %q %v", v, err)
+	}
+	if v, err := c.Decode(c.Encode("new", "auth"), "auth"); err != nil || v != "new" {
+		t.Errorf("expected new, got %q %v", v, err)
+	}
+}
+
+func TestAeadCryptoDerivedKeys(t *testing.T) {
+	c := &AeadCrypto{}
+	for i := 0; i < 3*aeadDerivedKeys; i++ {
+		c.Encode("hello", fmt.Sprintf("auth|10.0.0.%d", i))
+	}
+	if len(c.derived) > aeadDerivedKeys {
+		t.Errorf("the cache of derived keys should be bounded, has %d keys", len(c.derived))
+	}
+}
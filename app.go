@@ -1,12 +1,14 @@
 package xweb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -14,16 +16,20 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coscms/tagfast"
 	"github.com/coscms/xweb/httpsession"
+	"github.com/coscms/xweb/lib/ratelimit"
 	"github.com/coscms/xweb/lib/route"
 	"github.com/coscms/xweb/log"
+	"github.com/coscms/xweb/validation"
 )
 
 var (
-	mapperType = reflect.TypeOf(Mapper{})
+	mapperType     = reflect.TypeOf(Mapper{})
+	validationType = reflect.TypeOf(&validation.Validation{})
 )
 
 type JSON struct {
@@ -74,18 +80,43 @@ type App struct {
 	ActionsPath        map[reflect.Type]string
 	ActionsNamePath    map[string]string
 	ActionsMethodRoute map[string]map[string]string
-	FuncMaps           template.FuncMap
+	mapperTags         map[reflect.Type]map[string]reflect.StructTag
+	FuncMaps           template.FuncMap //functions added by Assign, see TemplateFuncs
 	Logger             *log.Logger
 	VarMaps            T
+	tplFuncs           template.FuncMap
+	tplVars            T
+	tplLock            sync.RWMutex
 	SessionManager     *httpsession.Manager //Session manager
 	RootTemplate       *template.Template
 	ErrorTemplate      *template.Template
 	StaticVerMgr       *StaticVerMgr
 	TemplateMgr        *TemplateMgr
+	TemplateCache      *TemplateCache
+	TemplateEngine     TemplateEngine //renders Action.Render, HtmlTemplateEngine by default
+	htmlEngine         *HtmlTemplateEngine
 	ContentEncoding    string
-	RequestTime        time.Time
+	RequestTime        time.Time //Deprecated: no longer set, it was shared by concurrent requests
 	Cryptor
 	XsrfManager
+	CookieCodec *SignedCookieCodec
+	// SecurityHeaders are sent with every response, RouteGroups can have their own
+	SecurityHeaders *SecurityHeaders
+	Cors            *Cors
+	RateLimitStore  ratelimit.Store
+	Auth            *Auth
+	Authorizer      Authorizer
+	OIDC            *OIDCLogin
+	LoginThrottle   *LoginThrottle
+	Themes          *Themes
+	I18n            *I18n
+	groups          []*RouteGroup
+	rateLimits      map[reflect.Type]map[string]*RateLimit
+	requirements    map[reflect.Type]map[string]*Requirement
+
+	// RouteSecurityHeaders are chosen by the Mapper tag `headers:"name"` of a
+	// route instead of the headers of the App or group, `headers:"-"` sends none
+	RouteSecurityHeaders map[string]*SecurityHeaders
 }
 
 func NewAppConfig() *AppConfig {
@@ -109,6 +140,9 @@ type AppConfig struct {
 	Mode              int
 	StaticDir         string
 	TemplateDir       string
+	StaticFS          fs.FS  //static files, default OSDir(StaticDir), see OSDir
+	TemplateFS        fs.FS  //templates, default OSDir(TemplateDir)
+	Layout            string //default layout of Render, like layouts/main.html
 	SessionOn         bool
 	MaxUploadSize     int64
 	CookieSecret      string
@@ -116,11 +150,26 @@ type AppConfig struct {
 	CookieLimitUA     bool
 	CookiePrefix      string
 	CookieDomain      string
+	CookieSameSite    http.SameSite
+	CookieSignKeys    []string      //key ring of secure cookies, the first one signs, default CookieSecret
+	CookieMaxAge      time.Duration //how long a secure cookie is accepted, default 31 days
+	LegacyCookieUntil time.Time     //until when secure cookies of the old format are read, default start time + CookieMaxAge
 	StaticFileVersion bool
 	CacheTemplates    bool
 	ReloadTemplates   bool
 	CheckXsrf         bool
+	StreamRender      bool     //default of ActionOption.StreamRender
+	StreamBuffer      int      //bytes a streamed render keeps before the response is sent, default DefaultStreamBuffer
+	XsrfOrigins       []string //other origins allowed to send unsafe requests, like https://*.example.com
+	TrustedProxies    []string //ips or cidrs of the reverse proxies whose X-Forwarded-For is believed
+	//The Session* fields below configure the session manager of the app, they are
+	//ignored when Server.SessionManager is set: configure that manager instead.
 	SessionTimeout    time.Duration
+	SessionLock       bool   //serialize the requests of one session
+	SessionTransfer   string //cookie (default), cookie_url, url, header, chain (header, cookie, then query), strict_header or strict_chain (no bearer nor query)
+	SessionName       string //name of the sessionid cookie and query param
+	SessionHeader     string //header which carries the sessionid, default X-Session-Token
+	SessionSecure     bool   //send the sessionid cookie over https only
 	FormMapToStruct   bool
 	EnableHttpCache   bool
 	AuthBasedOnCookie bool
@@ -139,16 +188,44 @@ func NewApp(path string, name string) *App {
 		ActionsPath:        map[reflect.Type]string{},
 		ActionsNamePath:    map[string]string{},
 		ActionsMethodRoute: make(map[string]map[string]string),
-		FuncMaps:           DefaultFuncs,
+		mapperTags:         make(map[reflect.Type]map[string]reflect.StructTag),
+		rateLimits:         make(map[reflect.Type]map[string]*RateLimit),
+		requirements:       make(map[reflect.Type]map[string]*Requirement),
+		RateLimitStore:     ratelimit.NewMemoryStore(),
+		FuncMaps:           template.FuncMap{},
 		VarMaps:            T{},
 		filters:            make([]Filter, 0),
 		StaticVerMgr:       DefaultStaticVerMgr,
 		TemplateMgr:        DefaultTemplateMgr,
+		TemplateCache:      NewTemplateCache(),
 		Cryptor:            DefaultCryptor,
 		XsrfManager:        DefaultXsrfManager,
 	}
 }
 
+func (a *App) cookieCodec() *SignedCookieCodec {
+	if a.CookieCodec == nil {
+		keys := a.AppConfig.CookieSignKeys
+		if len(keys) == 0 && a.AppConfig.CookieSecret != "" {
+			keys = []string{a.AppConfig.CookieSecret}
+		}
+		a.CookieCodec = NewSignedCookieCodec(keys...)
+		if a.AppConfig.CookieMaxAge > 0 {
+			a.CookieCodec.MaxAge = a.AppConfig.CookieMaxAge
+		}
+	}
+	// cookies of the old format are no longer written, so after one
+	// cookie lifetime no genuine one is left
+	if a.AppConfig.LegacyCookieUntil.IsZero() {
+		maxAge := a.CookieCodec.MaxAge
+		if maxAge <= 0 {
+			maxAge = DefaultSignedCookieAge
+		}
+		a.AppConfig.LegacyCookieUntil = time.Now().Add(maxAge)
+	}
+	return a.CookieCodec
+}
+
 func (a *App) IsRootApp() bool {
 	return a.BasePath == "/"
 }
@@ -156,7 +233,8 @@ func (a *App) IsRootApp() bool {
 func (a *App) initApp() {
 	var isRootApp bool = a.IsRootApp()
 	if a.AppConfig.StaticFileVersion {
-		if isRootApp || a.Server.RootApp.AppConfig.StaticDir != a.AppConfig.StaticDir {
+		if isRootApp || a.Server.RootApp.AppConfig.StaticDir != a.AppConfig.StaticDir ||
+			a.Server.RootApp.AppConfig.StaticFS != nil || a.AppConfig.StaticFS != nil {
 			if !isRootApp {
 				a.StaticVerMgr = new(StaticVerMgr)
 			}
@@ -166,7 +244,8 @@ func (a *App) initApp() {
 		}
 	}
 	if a.AppConfig.CacheTemplates {
-		if isRootApp || a.Server.RootApp.AppConfig.TemplateDir != a.AppConfig.TemplateDir {
+		if isRootApp || a.Server.RootApp.AppConfig.TemplateDir != a.AppConfig.TemplateDir ||
+			a.Server.RootApp.AppConfig.TemplateFS != nil || a.AppConfig.TemplateFS != nil {
 			if !isRootApp {
 				a.TemplateMgr = new(TemplateMgr)
 			}
@@ -175,15 +254,24 @@ func (a *App) initApp() {
 			a.TemplateMgr = a.Server.RootApp.TemplateMgr
 		}
 	}
-	a.FuncMaps["StaticUrl"] = a.StaticUrl
-	a.FuncMaps["XsrfName"] = XsrfName
-	a.VarMaps["XwebVer"] = Version
+	a.cookieCodec()
+	a.Assign("XwebVer", Version)
+	a.htmlEngine = NewHtmlTemplateEngine(a)
+	if e, ok := a.TemplateEngine.(*HtmlTemplateEngine); ok {
+		a.htmlEngine = e
+	} else if a.TemplateEngine == nil {
+		a.TemplateEngine = a.htmlEngine
+	}
 
 	if a.AppConfig.SessionOn {
 		if a.Server.SessionManager != nil {
 			a.SessionManager = a.Server.SessionManager
 		} else {
 			a.SessionManager = httpsession.Default()
+			a.SessionManager.SetTransfer(httpsession.NewTransfer(
+				a.AppConfig.SessionTransfer, a.AppConfig.SessionName,
+				a.AppConfig.SessionHeader, httpsession.DefaultMaxAge,
+				a.AppConfig.SessionSecure, "/"))
 			if a.AppConfig.SessionTimeout > time.Second {
 				a.SessionManager.SetMaxAge(a.AppConfig.SessionTimeout)
 			}
@@ -194,6 +282,7 @@ func (a *App) initApp() {
 	if a.Logger == nil {
 		a.Logger = a.Server.Logger
 	}
+	a.checkCors()
 }
 
 func (a *App) Close() {
@@ -203,6 +292,9 @@ func (a *App) Close() {
 	if a.AppConfig.CacheTemplates && a.TemplateMgr != nil {
 		a.TemplateMgr.Close()
 	}
+	if a.Themes != nil {
+		a.Themes.close()
+	}
 	if a.AppConfig.SessionOn && a.Server.SessionManager == nil &&
 		a.SessionManager != nil {
 		//a.SessionManager.Close()
@@ -232,12 +324,18 @@ func (a *App) SetTemplateDir(path string) {
 	a.AppConfig.TemplateDir = path
 }
 
-func (a *App) getTemplatePath(name string) string {
-	templateFile := path.Join(a.AppConfig.TemplateDir, name)
-	if fileExists(templateFile) {
-		return templateFile
+// templateContent reads a template through the TemplateMgr when templates
+// are cached, else from AppConfig.TemplateFS. Before the app runs the
+// TemplateMgr is not ready, CheckTemplates reads the FS.
+func (a *App) templateContent(name string) ([]byte, error) {
+	if a.AppConfig.CacheTemplates && a.TemplateMgr != nil && a.TemplateMgr.initialized {
+		return a.TemplateMgr.GetTemplate(name)
 	}
-	return ""
+	content, err := fs.ReadFile(a.templateFS(), fsPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("No template file %v found", name)
+	}
+	return content, err
 }
 
 func (app *App) SetConfig(name string, val interface{}) {
@@ -276,11 +374,51 @@ func (app *App) AutoAction(cs ...interface{}) {
 }
 
 func (app *App) Assign(name string, varOrFun interface{}) {
+	app.tplLock.Lock()
+	defer app.tplLock.Unlock()
 	if reflect.TypeOf(varOrFun).Kind() == reflect.Func {
 		app.FuncMaps[name] = varOrFun
 	} else {
 		app.VarMaps[name] = varOrFun
 	}
+	app.publishTemplateVars()
+}
+
+// publishTemplateVars builds the maps returned by TemplateFuncs and
+// TemplateVars. They are never changed afterwards, Assign builds new ones,
+// so requests can use them without copying.
+func (app *App) publishTemplateVars() {
+	funcs := make(template.FuncMap, len(DefaultFuncs)+len(app.FuncMaps)+2)
+	for k, v := range DefaultFuncs {
+		funcs[k] = v
+	}
+	funcs["StaticUrl"] = app.StaticUrl
+	funcs["XsrfName"] = XsrfName
+	for k, v := range app.FuncMaps {
+		funcs[k] = v
+	}
+	vars := make(T, len(app.VarMaps))
+	for k, v := range app.VarMaps {
+		vars[k] = v
+	}
+	app.tplFuncs = funcs
+	app.tplVars = vars
+}
+
+// TemplateFuncs returns the template functions of the app: DefaultFuncs,
+// StaticUrl, XsrfName and the ones added by Assign. Don't modify it.
+func (app *App) TemplateFuncs() template.FuncMap {
+	app.tplLock.RLock()
+	defer app.tplLock.RUnlock()
+	return app.tplFuncs
+}
+
+// TemplateVars returns the template variables added by Assign. Don't
+// modify it.
+func (app *App) TemplateVars() T {
+	app.tplLock.RLock()
+	defer app.tplLock.RUnlock()
+	return app.tplVars
 }
 
 func (app *App) MultiAssign(t *T) {
@@ -356,6 +494,15 @@ func (app *App) filter(w http.ResponseWriter, req *http.Request) bool {
 	return true
 }
 
+// MapperTag returns the tag of the Mapper field of an action method,
+// e.g. to read `xsrf:"-"`.
+func (app *App) MapperTag(t reflect.Type, method string) reflect.StructTag {
+	if tags, ok := app.mapperTags[t]; ok {
+		return tags[method]
+	}
+	return ""
+}
+
 func (app *App) AddRouter(url string, c interface{}) {
 	t := reflect.TypeOf(c).Elem()
 	v := reflect.ValueOf(c)
@@ -366,6 +513,8 @@ func (app *App) AddRouter(url string, c interface{}) {
 	app.Actions[actionFullName] = c
 	app.ActionsNamePath[actionFullName] = url
 	app.ActionsMethodRoute[actionFullName] = make(map[string]string)
+	app.mapperTags[t] = make(map[string]reflect.StructTag)
+	app.addAuthorize(t, c)
 
 	for i := 0; i < t.NumField(); i++ {
 		if t.Field(i).Type != mapperType {
@@ -379,6 +528,9 @@ func (app *App) AddRouter(url string, c interface{}) {
 		}
 
 		tag := t.Field(i).Tag
+		app.mapperTags[t][a] = tag
+		app.addRateLimit(t, a, tag.Get("ratelimit"))
+		app.addRequirement(t, a, tag)
 		tagStr := tag.Get("xweb")
 		methods := map[string]bool{}    //map[string]bool{"GET": true, "POST": true}
 		extensions := map[string]bool{} //map[string]bool{"HTML": true, "JSON": true}
@@ -459,11 +611,26 @@ func (app *App) AddRouter(url string, c interface{}) {
 	}
 }
 
-func (a *App) ElapsedTimeString() string {
-	return fmt.Sprintf("%.3fs", a.ElapsedTime())
+type requestStartKey struct{}
+
+// RequestStart returns when the server received the request.
+func RequestStart(req *http.Request) time.Time {
+	t, _ := req.Context().Value(requestStartKey{}).(time.Time)
+	return t
+}
+
+func (a *App) ElapsedTimeString(req ...*http.Request) string {
+	return fmt.Sprintf("%.3fs", a.ElapsedTime(req...))
 }
 
-func (a *App) ElapsedTime() float64 {
+// ElapsedTime returns the seconds since the request was received.
+func (a *App) ElapsedTime(req ...*http.Request) float64 {
+	if len(req) > 0 {
+		if start := RequestStart(req[0]); !start.IsZero() {
+			return time.Now().Sub(start).Seconds()
+		}
+		return 0
+	}
 	return time.Now().Sub(a.RequestTime).Seconds()
 }
 
@@ -472,9 +639,9 @@ func (a *App) VisitedLog(req *http.Request, statusCode int, requestPath string,
 		statusCode = 200
 	}
 	if statusCode >= 200 && statusCode < 400 {
-		a.Info(req.RemoteAddr, req.Method, statusCode, requestPath, responseSize, a.ElapsedTimeString())
+		a.Info(req.RemoteAddr, req.Method, statusCode, requestPath, responseSize, a.ElapsedTimeString(req))
 	} else {
-		a.Error(req.RemoteAddr, req.Method, statusCode, requestPath, responseSize, a.ElapsedTimeString())
+		a.Error(req.RemoteAddr, req.Method, statusCode, requestPath, responseSize, a.ElapsedTimeString(req))
 	}
 }
 
@@ -488,6 +655,7 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 	defer func() {
 		a.VisitedLog(req, statusCode, requestPath, responseSize)
 	}()
+	req = a.applySecurityHeaders(w, req)
 
 	if !a.IsRootApp() || a.Server.Config.UrlSuffix != "" || a.Server.Config.UrlPrefix != "" {
 		// static files, needed op
@@ -519,6 +687,9 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 
 	//Set the default content-type
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if statusCode = a.handleCors(w, req); statusCode != 0 {
+		return
+	}
 	if !a.filter(w, req) {
 		statusCode = 302
 		return
@@ -538,10 +709,7 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 
 	requestPath = req.URL.Path //支持filter更改req.URL.Path
 
-	reqPath := removeStick(requestPath)
-	if a.Domain == "" && a.BasePath != "/" {
-		reqPath = "/" + strings.TrimPrefix(reqPath, a.BasePath)
-	}
+	reqPath := a.relativePath(requestPath)
 	reqMethod := Ternary(req.Method == "HEAD", "GET", req.Method).(string)
 	args, fnName, rfType, onMethod, onExtension, onGroup := a.Route.Get(reqPath, reqMethod, reqExtension)
 	if rfType != nil && fnName != "" {
@@ -583,6 +751,7 @@ func (a *App) run(req *http.Request, w http.ResponseWriter,
 	args []reflect.Value, handlerSuffix string, extensionName string) (isBreak bool,
 	statusCode int, responseSize int64) {
 
+	methodName := handlerName
 	if handlerSuffix != "" {
 		handlerName += handlerSuffix
 	}
@@ -595,10 +764,12 @@ func (a *App) run(req *http.Request, w http.ResponseWriter,
 		T:              T{},
 		f:              T{},
 		Option: &ActionOption{
-			AutoMapForm: a.AppConfig.FormMapToStruct,
-			CheckXsrf:   a.AppConfig.CheckXsrf,
+			AutoMapForm:  a.AppConfig.FormMapToStruct,
+			CheckXsrf:    a.AppConfig.CheckXsrf,
+			StreamRender: a.AppConfig.StreamRender,
 		},
 		ExtensionName: extensionName,
+		Layout:        a.layout(reflectType, methodName),
 		args:          make([]string, len(args)),
 	}
 
@@ -606,7 +777,29 @@ func (a *App) run(req *http.Request, w http.ResponseWriter,
 		c.args[k] = v.String()
 	}
 
-	for k, v := range a.VarMaps {
+	//路由自己的安全响应头
+	a.routeSecurityHeaders(c, reflectType, methodName)
+
+	//限制请求频率
+	if !a.checkRateLimit(c, reflectType, methodName) {
+		statusCode = c.StatusCode
+		return
+	}
+
+	//同一会话的请求依次执行，没有会话的请求不创建会话
+	if a.AppConfig.SessionLock {
+		if session := c.existingSession(); session != nil && session.Lock() {
+			defer session.Unlock()
+		}
+	}
+
+	//身份认证
+	if !a.authenticate(c, reflectType, methodName) {
+		statusCode = c.StatusCode
+		return
+	}
+
+	for k, v := range a.TemplateVars() {
 		c.T[k] = v
 	}
 	elem := vc.Elem()
@@ -622,6 +815,12 @@ func (a *App) run(req *http.Request, w http.ResponseWriter,
 		fieldC.Set(reflect.ValueOf(vc))
 	}
 
+	//设置Validation字段的值，验证消息使用请求的语言
+	fieldV := elem.FieldByName("Validation")
+	if fieldV.IsValid() && fieldV.Type() == validationType {
+		fieldV.Set(reflect.ValueOf(c.NewValidation()))
+	}
+
 	//执行Init方法
 	initM := vc.MethodByName("Init")
 	if initM.IsValid() {
@@ -638,28 +837,25 @@ func (a *App) run(req *http.Request, w http.ResponseWriter,
 		a.StructMap(vc, req)
 	}
 
-	//验证XSRF
-	if c.Option.CheckXsrf {
-		a.XsrfManager.Init(c)
-		if req.Method == "POST" {
-			formVals := req.Form[XSRF_TAG]
-			var formVal string
-			if len(formVals) > 0 {
-				formVal = formVals[0]
-			}
-			if formVal == "" ||
-				!a.XsrfManager.Valid(a.AppConfig.CookiePrefix+
-					XSRF_TAG, formVal) {
-				a.error(w, 500, "xsrf token error.")
-				a.Error("xsrf token error.")
-				statusCode = 500
-				return
-			}
+	//验证XSRF，请求头中的凭证不会被浏览器自动发送，无需验证
+	if c.Option.CheckXsrf && !a.xsrfExempt(reflectType, methodName) && !c.headerCredentials() {
+		if err := c.checkXsrf(); err != nil {
+			a.error(w, 403, err.Error())
+			a.Error(err.Error(), req.Method, req.URL.Path)
+			statusCode = 403
+			return
 		}
 	}
 	structName := reflect.ValueOf(reflectType.Name())
 	actionName := reflect.ValueOf(handlerName)
 
+	//权限验证
+	if !a.authorize(c, reflectType, methodName) {
+		statusCode = c.StatusCode
+		responseSize = c.ResponseSize
+		return
+	}
+
 	//执行Before方法
 	initM = vc.MethodByName("Before")
 	if initM.IsValid() {
@@ -802,11 +998,8 @@ func defaultResponse(c *Action, data interface{}) (responseSize int64, validType
 func (a *App) error(w http.ResponseWriter, status int, content string) error {
 	w.WriteHeader(status)
 	if errorTmpl == "" {
-		errTmplFile := a.AppConfig.TemplateDir + "/_error.html"
-		if file, err := os.Stat(errTmplFile); err == nil && !file.IsDir() {
-			if b, e := ioutil.ReadFile(errTmplFile); e == nil {
-				errorTmpl = string(b)
-			}
+		if b, e := fs.ReadFile(a.templateFS(), "_error.html"); e == nil {
+			errorTmpl = string(b)
 		}
 		if errorTmpl == "" {
 			errorTmpl = defaultErrorTmpl
@@ -818,13 +1011,15 @@ func (a *App) error(w http.ResponseWriter, status int, content string) error {
 	return err
 }
 
-func (a *App) StaticUrl(url string) string {
-	var basePath string
+func (a *App) staticBasePath() string {
 	if a.AppConfig.StaticDir == RootApp().AppConfig.StaticDir {
-		basePath = RootApp().BasePath
-	} else {
-		basePath = a.BasePath
+		return RootApp().BasePath
 	}
+	return a.BasePath
+}
+
+func (a *App) StaticUrl(url string) string {
+	basePath := a.staticBasePath()
 	if !a.AppConfig.StaticFileVersion {
 		return path.Join(basePath, url)
 	}
@@ -888,7 +1083,11 @@ func (a *App) TryServingFile(name string, req *http.Request, w http.ResponseWrit
 	}
 	var size int64
 	staticFile := filepath.Join(a.AppConfig.StaticDir, newPath)
-	finfo, err := os.Stat(staticFile)
+	staticFS, name, ok := a.themeStatic(newPath)
+	if !ok {
+		staticFS, name = a.staticFS(), fsPath(newPath)
+	}
+	finfo, err := fs.Stat(staticFS, name)
 	if err != nil {
 		return false, size
 	}
@@ -913,16 +1112,30 @@ func (a *App) TryServingFile(name string, req *http.Request, w http.ResponseWrit
 			}
 		}
 	}
+	file, err := staticFS.Open(name)
+	if err != nil {
+		return false, size
+	}
+	defer file.Close()
 	if isStaticFileToCompress {
 		a.ContentEncoding = GetAcceptEncodingZip(req)
-		memzipfile, err := OpenMemZipFile(staticFile, a.ContentEncoding)
+		memzipfile, err := openMemZipFile(file, staticFile, a.ContentEncoding)
 		if err != nil {
 			return false, size
 		}
 		a.InitHeadContent(w, finfo.Size())
 		http.ServeContent(w, req, staticFile, finfo.ModTime(), memzipfile)
 	} else {
-		http.ServeFile(w, req, staticFile)
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			// files of zip archives can not seek
+			b, err := ioutil.ReadAll(file)
+			if err != nil {
+				return false, size
+			}
+			content = bytes.NewReader(b)
+		}
+		http.ServeContent(w, req, staticFile, finfo.ModTime(), content)
 	}
 	return true, size
 }
@@ -1200,12 +1413,12 @@ func (app *App) Action(name string) interface{} {
 }
 
 /*
-example:
+example, the roles and permissions a route requires follow its methods:
 {
 	"AdminAction":{
 		"Index":["GET","POST"],
-		"Add":	["GET","POST"],
-		"Edit":	["GET","POST"]
+		"Add":	["GET","POST","role:editor"],
+		"Edit":	["GET","POST","role:editor","perm:article.edit"]
 	}
 }
 */
@@ -1235,5 +1448,35 @@ func (app *App) Nodes() (r map[string]map[string][]string) {
 			r[name][val.ExecuteFunc] = append(r[name][val.ExecuteFunc], k) //FUNC1:[POST,GET]
 		}
 	}
+	for name, methods := range app.NodeRequirements() {
+		for method, req := range methods {
+			if _, ok := r[name][method]; !ok {
+				continue
+			}
+			for _, role := range req.Roles {
+				r[name][method] = append(r[name][method], "role:"+role)
+			}
+			for _, perm := range req.Permissions {
+				r[name][method] = append(r[name][method], "perm:"+perm)
+			}
+		}
+	}
+	return
+}
+
+// NodeRequirements returns the roles and permissions the routes of Nodes
+// require as Requirements, by action and method name. Routes which require
+// nothing are left out.
+func (app *App) NodeRequirements() (r map[string]map[string]*Requirement) {
+	r = make(map[string]map[string]*Requirement)
+	for t, methods := range app.requirements {
+		name := t.Name()
+		for method, req := range methods {
+			if _, ok := r[name]; !ok {
+				r[name] = make(map[string]*Requirement)
+			}
+			r[name][method] = req
+		}
+	}
 	return
 }
@@ -0,0 +1,393 @@
+package xweb
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/coscms/xweb/lib/jwt"
+)
+
+var (
+	ErrUnauthorized  = errors.New("invalid credentials")
+	ErrNoSessionAuth = errors.New("App.Auth has no SessionAuth")
+	ErrNoSubject     = errors.New("the token has no sub claim")
+)
+
+// Principal is the authenticated user of a request.
+type Principal struct {
+	Id       string
+	Name     string
+	Roles    []string
+	Claims   map[string]interface{} `json:",omitempty"`
+	Strategy string                 `json:"-"` //the Authenticator which found it
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator is one way to find the Principal of a request. It returns
+// nil and no error when the request carries no credentials of its kind.
+type Authenticator interface {
+	Authenticate(c *Action) (*Principal, error)
+	// Challenge is sent in WWW-Authenticate, it may be empty.
+	Challenge() string
+}
+
+// HeaderCredentials is implemented by Authenticators whose credentials a
+// browser never sends by itself, like bearer tokens and api keys. Another
+// site can't have them sent, so the requests they authenticate skip the
+// xsrf check. Basic credentials and sessions are sent by the browser and
+// are checked.
+type HeaderCredentials interface {
+	HeaderCredentials() bool
+}
+
+// BasicAuth checks HTTP Basic credentials.
+type BasicAuth struct {
+	Realm string
+	Check func(user, password string) (*Principal, error)
+}
+
+// NewBasicAuthUsers checks against a fixed user/password list.
+// See NewBasicAuthHashes to keep hashed passwords instead.
+func NewBasicAuthUsers(realm string, users map[string]string) *BasicAuth {
+	return &BasicAuth{Realm: realm, Check: func(user, password string) (*Principal, error) {
+		expected, ok := users[user]
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			return nil, ErrUnauthorized
+		}
+		return &Principal{Id: user, Name: user}, nil
+	}}
+}
+
+// Authenticate is throttled by App.LoginThrottle.
+func (s *BasicAuth) Authenticate(c *Action) (*Principal, error) {
+	user, password, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	t := c.App.LoginThrottle
+	if t == nil {
+		return s.Check(user, password)
+	}
+	done, err := t.Attempt(c, user)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.Check(user, password)
+	done(err == nil)
+	return p, err
+}
+
+// NewBasicAuthHashes checks against a fixed list of users and their
+// password hashes, made by passwd.Hash.
+func NewBasicAuthHashes(realm string, users map[string]string) *BasicAuth {
+	return &BasicAuth{Realm: realm, Check: func(user, password string) (*Principal, error) {
+		ok, _, err := verifyPassword(password, users[user])
+		if !ok || err != nil {
+			return nil, ErrUnauthorized
+		}
+		return &Principal{Id: user, Name: user}, nil
+	}}
+}
+
+func (s *BasicAuth) Challenge() string {
+	return fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, s.Realm)
+}
+
+// TokenAuth reads an opaque token, a bearer token from Authorization when
+// Header is empty or an API key from Header, e.g. X-API-Key.
+type TokenAuth struct {
+	Header string
+	Lookup func(token string) (*Principal, error)
+}
+
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+func (s *TokenAuth) Authenticate(c *Action) (*Principal, error) {
+	var token string
+	if s.Header == "" {
+		token = bearerToken(c.Request)
+	} else {
+		token = c.Request.Header.Get(s.Header)
+	}
+	if token == "" {
+		return nil, nil
+	}
+	return s.Lookup(token)
+}
+
+func (s *TokenAuth) Challenge() string {
+	if s.Header == "" {
+		return "Bearer"
+	}
+	return ""
+}
+
+func (s *TokenAuth) HeaderCredentials() bool {
+	return true
+}
+
+// SessionAuth finds the Principal stored in the session by Login. A plain
+// value under Key, as LoginFilter used, is taken as the user id.
+type SessionAuth struct {
+	Key string
+}
+
+func (s *SessionAuth) Authenticate(c *Action) (*Principal, error) {
+	// don't create a session for every anonymous request
+	session := c.existingSession()
+	if session == nil {
+		return nil, nil
+	}
+	v := session.Get(s.Key)
+	if v == nil || v == "" {
+		return nil, nil
+	}
+	p := &Principal{}
+	if err := c.SessionDecode(s.Key, p); err == nil && p.Id != "" {
+		return p, nil
+	}
+	return &Principal{Id: fmt.Sprint(v)}, nil
+}
+
+func (s *SessionAuth) Challenge() string {
+	return ""
+}
+
+// Login moves the session to a new id before it stores the user, so that
+// a session id known before the login can't be used to act as the user.
+func (s *SessionAuth) Login(c *Action, p *Principal) error {
+	if err := c.regenerateSession(); err != nil {
+		return err
+	}
+	c.user = p
+	return c.SessionEncode(s.Key, p)
+}
+
+// Logout drops the whole session, not only the user, so that its id and
+// its xsrf token are worth nothing afterwards. The request goes on with an
+// empty session under a new id.
+func (s *SessionAuth) Logout(c *Action) {
+	c.user = nil
+	if session := c.existingSession(); session != nil {
+		c.session = c.App.SessionManager.Restart(c.Request, c.ResponseWriter, session)
+	}
+}
+
+// JWTAuth validates bearer JWTs locally. Roles are read from RolesClaim.
+type JWTAuth struct {
+	*jwt.Validator
+	RolesClaim string
+}
+
+func NewJWTAuth(validator *jwt.Validator) *JWTAuth {
+	return &JWTAuth{Validator: validator, RolesClaim: "roles"}
+}
+
+func (s *JWTAuth) Authenticate(c *Action) (*Principal, error) {
+	raw := bearerToken(c.Request)
+	if strings.Count(raw, ".") != 2 {
+		return nil, nil
+	}
+	token, err := s.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	// a Principal without an id would count as nobody in particular
+	sub := token.Claims.String("sub")
+	if sub == "" {
+		return nil, ErrNoSubject
+	}
+	return &Principal{
+		Id:     sub,
+		Name:   token.Claims.String("name"),
+		Roles:  token.Claims.Strings(s.RolesClaim),
+		Claims: token.Claims,
+	}, nil
+}
+
+func (s *JWTAuth) Challenge() string {
+	return "Bearer"
+}
+
+func (s *JWTAuth) HeaderCredentials() bool {
+	return true
+}
+
+// Auth runs the Authenticators for every request. Which routes need a user
+// is decided like LoginFilter did: AskLoginUrls always do, and when there
+// are AnonymousUrls every other route does. A Mapper tagged auth:"required"
+// or auth:"-" overrides the lists.
+type Auth struct {
+	Authenticators []Authenticator
+	LoginUrl       string //html requests are redirected here, others get 401
+	AnonymousUrls  []*regexp.Regexp
+	AskLoginUrls   []*regexp.Regexp
+}
+
+func NewAuth(loginUrl string, authenticators ...Authenticator) *Auth {
+	auth := &Auth{Authenticators: authenticators, LoginUrl: loginUrl,
+		AnonymousUrls: make([]*regexp.Regexp, 0),
+		AskLoginUrls:  make([]*regexp.Regexp, 0),
+	}
+	if loginUrl != "" {
+		auth.AddAnonymousUrls("/favicon.ico", regexp.QuoteMeta(loginUrl))
+	}
+	return auth
+}
+
+func (s *Auth) AddAnonymousUrls(urls ...string) {
+	for _, r := range urls {
+		cr, err := regexp.Compile(r)
+		if err == nil {
+			s.AnonymousUrls = append(s.AnonymousUrls, cr)
+		}
+	}
+}
+
+func (s *Auth) AddAskLoginUrls(urls ...string) {
+	for _, r := range urls {
+		cr, err := regexp.Compile(r)
+		if err == nil {
+			s.AskLoginUrls = append(s.AskLoginUrls, cr)
+		}
+	}
+}
+
+func matchWhole(list []*regexp.Regexp, requestPath string) bool {
+	for _, cr := range list {
+		if loc := cr.FindStringIndex(requestPath); loc != nil && loc[0] == 0 && loc[1] == len(requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Required reports whether the route needs an authenticated user.
+func (s *Auth) Required(requestPath string, tag string) bool {
+	switch tag {
+	case "required", "true":
+		return true
+	case "-", "false", "anonymous":
+		return false
+	}
+	if matchWhole(s.AskLoginUrls, requestPath) {
+		return true
+	}
+	if len(s.AnonymousUrls) == 0 {
+		return false
+	}
+	return !matchWhole(s.AnonymousUrls, requestPath)
+}
+
+// Session returns the SessionAuth among the Authenticators, for Login.
+func (s *Auth) Session() *SessionAuth {
+	for _, a := range s.Authenticators {
+		if sa, ok := a.(*SessionAuth); ok {
+			return sa
+		}
+	}
+	return nil
+}
+
+func (s *Auth) authenticate(c *Action) *Principal {
+	for _, a := range s.Authenticators {
+		p, err := a.Authenticate(c)
+		if err != nil {
+			c.Warnf("authentication by %T failed: %v", a, err)
+			continue
+		}
+		if p != nil {
+			p.Strategy = fmt.Sprintf("%T", a)
+			c.authenticator = a
+			return p
+		}
+	}
+	return nil
+}
+
+// wantsJson reports whether the client can't follow a login redirect
+func (c *Action) wantsJson() bool {
+	return c.ExtensionName == "json" || c.ExtensionName == "xml" || c.IsAjax() ||
+		strings.Contains(c.Request.Header.Get("Accept"), "application/json")
+}
+
+// authenticate sets the user of the request and answers 401 or redirects
+// to the login when the route needs a user but there is none.
+func (a *App) authenticate(c *Action, t reflect.Type, method string) bool {
+	if a.Auth == nil {
+		return true
+	}
+	c.user = a.Auth.authenticate(c)
+	if c.user != nil {
+		return true
+	}
+	if !a.Auth.Required(removeStick(c.Request.URL.Path), a.MapperTag(t, method).Get("auth")) {
+		return true
+	}
+	a.unauthorized(c)
+	return false
+}
+
+// unauthorized redirects html requests to the login, the others get a 401
+// with the challenges of the Authenticators.
+func (a *App) unauthorized(c *Action) {
+	if a.Auth != nil && a.Auth.LoginUrl != "" && !c.wantsJson() {
+		c.StatusCode = 302
+		a.Redirect(c.ResponseWriter, removeStick(c.Request.URL.Path), a.Auth.LoginUrl)
+		return
+	}
+	if a.Auth != nil {
+		for _, auth := range a.Auth.Authenticators {
+			if challenge := auth.Challenge(); challenge != "" {
+				c.ResponseWriter.Header().Add("WWW-Authenticate", challenge)
+			}
+		}
+	}
+	c.StatusCode = http.StatusUnauthorized
+	a.error(c.ResponseWriter, http.StatusUnauthorized, "Unauthorized")
+}
+
+// User returns the authenticated user of the request, nil for anonymous.
+func (c *Action) User() *Principal {
+	return c.user
+}
+
+// headerCredentials reports whether the user of the request was
+// authenticated by HeaderCredentials.
+func (c *Action) headerCredentials() bool {
+	h, ok := c.authenticator.(HeaderCredentials)
+	return ok && c.user != nil && h.HeaderCredentials()
+}
+
+// Login stores the user in the session through the SessionAuth of App.Auth.
+func (c *Action) Login(p *Principal) error {
+	if c.App.Auth == nil || c.App.Auth.Session() == nil {
+		return ErrNoSessionAuth
+	}
+	return c.App.Auth.Session().Login(c, p)
+}
+
+func (c *Action) Logout() {
+	if c.App.Auth != nil && c.App.Auth.Session() != nil {
+		c.App.Auth.Session().Logout(c)
+	}
+}
@@ -0,0 +1,229 @@
+package xweb
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coscms/xweb/httpsession"
+	"github.com/coscms/xweb/lib/jwt"
+	"github.com/coscms/xweb/lib/passwd"
+)
+
+type authAction struct {
+	*Action
+
+	me      Mapper `xweb:"/me" auth:"required"`
+	cart    Mapper `xweb:"/cart"`
+	signIn  Mapper `xweb:"/login"`
+	signOut Mapper `xweb:"GET /logout"`
+}
+
+func (c *authAction) Me() string {
+	return c.User().Id
+}
+
+func (c *authAction) Cart() string {
+	c.SetSession("cart", "3 books")
+	return "ok"
+}
+
+func (c *authAction) SignIn() error {
+	if err := c.Login(&Principal{Id: "alice"}); err != nil {
+		return err
+	}
+	return c.Write(c.GetSessionString("cart"))
+}
+
+func (c *authAction) SignOut() string {
+	c.Logout()
+	return "bye"
+}
+
+func newAuthServer(t *testing.T, authenticators ...Authenticator) *Server {
+	return newTestServer(t, func(a *App) {
+		a.AppConfig.SessionOn = true
+		a.Auth = NewAuth("", authenticators...)
+	}, map[string]interface{}{"/": &authAction{}})
+}
+
+// whoami requests /me with the header and returns the user id, "" when the
+// request was not authenticated.
+func whoami(t *testing.T, tc *testClient, name, value string) string {
+	req, _ := http.NewRequest("GET", "/me", nil)
+	if name != "" {
+		req.Header.Set(name, value)
+	}
+	w := tc.do(req)
+	if w.Code == http.StatusUnauthorized {
+		return ""
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func basic(user, password string) string {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth(user, password)
+	return req.Header.Get("Authorization")
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := passwd.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, auth := range []*BasicAuth{
+		NewBasicAuthUsers("test", map[string]string{"alice": "secret"}),
+		NewBasicAuthHashes("test", map[string]string{"alice": hash}),
+	} {
+		client := newTestClient(newAuthServer(t, auth))
+		if id := whoami(t, client, "Authorization", basic("alice", "secret")); id != "alice" {
+			t.Errorf("valid credentials should authenticate, got %q", id)
+		}
+		if id := whoami(t, client, "Authorization", basic("alice", "guess")); id != "" {
+			t.Errorf("a wrong password should not authenticate, got %q", id)
+		}
+		if id := whoami(t, client, "Authorization", basic("bob", "secret")); id != "" {
+			t.Errorf("an unknown user should not authenticate, got %q", id)
+		}
+		w := client.get("/me")
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != auth.Challenge() {
+			t.Errorf("expected a basic challenge, got %d %v", w.Code, w.Header())
+		}
+		if len(client.cookies) != 0 {
+			t.Errorf("no session should be created, got %v", client.cookies)
+		}
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	lookup := func(token string) (*Principal, error) {
+		if token != "t0ken" {
+			return nil, ErrUnauthorized
+		}
+		return &Principal{Id: "robot"}, nil
+	}
+	client := newTestClient(newAuthServer(t, &TokenAuth{Lookup: lookup}))
+	if id := whoami(t, client, "Authorization", "Bearer t0ken"); id != "robot" {
+		t.Errorf("a valid bearer token should authenticate, got %q", id)
+	}
+	if id := whoami(t, client, "Authorization", "Bearer guess"); id != "" {
+		t.Errorf("an invalid bearer token should not authenticate, got %q", id)
+	}
+	// a browser doesn't send the token by itself, there is no xsrf to check
+	req, _ := http.NewRequest("POST", "/me", nil)
+	req.Header.Set("Authorization", "Bearer t0ken")
+	if w := client.do(req); w.Code != http.StatusOK || w.Body.String() != "robot" {
+		t.Errorf("a POST with a bearer token should not need an xsrf token, got %d", w.Code)
+	}
+	if w := client.get("/me"); w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("expected a bearer challenge, got %v", w.Header())
+	}
+
+	client = newTestClient(newAuthServer(t, &TokenAuth{Header: "X-API-Key", Lookup: lookup}))
+	if id := whoami(t, client, "X-API-Key", "t0ken"); id != "robot" {
+		t.Errorf("a valid api key should authenticate, got %q", id)
+	}
+	if id := whoami(t, client, "Authorization", "Bearer t0ken"); id != "" {
+		t.Errorf("the api key should only be read from its header, got %q", id)
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	key := []byte("secret")
+	client := newTestClient(newAuthServer(t, NewJWTAuth(jwt.NewValidator(key, jwt.HS256))))
+	sign := func(claims jwt.Claims, key []byte) string {
+		claims["exp"] = time.Now().Add(time.Minute).Unix()
+		raw, err := jwt.Sign(jwt.HS256, key, claims, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + raw
+	}
+	if id := whoami(t, client, "Authorization", sign(jwt.Claims{"sub": "alice"}, key)); id != "alice" {
+		t.Errorf("a valid token should authenticate, got %q", id)
+	}
+	if id := whoami(t, client, "Authorization", sign(jwt.Claims{"sub": "alice"}, []byte("other"))); id != "" {
+		t.Errorf("a token signed with another key should not authenticate, got %q", id)
+	}
+	if id := whoami(t, client, "Authorization", sign(jwt.Claims{"name": "alice"}, key)); id != "" {
+		t.Errorf("a token without sub should not authenticate, got %q", id)
+	}
+}
+
+func TestSessionAuthLogin(t *testing.T) {
+	s := newAuthServer(t, &SessionAuth{Key: "user"})
+	client := newTestClient(s)
+	if id := whoami(t, client, "", ""); id != "" || len(client.cookies) != 0 {
+		t.Fatalf("an anonymous request should get neither a user nor a session, got %q %v", id, client.cookies)
+	}
+	client.get("/cart")
+	before := client.Session()
+	if before == nil {
+		t.Fatal("the cart should create a session")
+	}
+
+	if body := client.get("/login").Body.String(); body != "3 books" {
+		t.Errorf("the session values should survive the login, got %q", body)
+	}
+	after := client.Session()
+	if after == nil || after.Id() == before.Id() {
+		t.Fatalf("the login should move the session to a new id, got %v", after)
+	}
+	if s.RootApp.SessionManager.Store().Exist(before.Id()) {
+		t.Error("the session id from before the login should be removed")
+	}
+	if id := whoami(t, client, "", ""); id != "alice" {
+		t.Errorf("the new session should carry the user, got %q", id)
+	}
+
+	// someone who knew the old id gets nothing
+	attacker := newTestClient(s)
+	attacker.cookies[httpsession.DefaultSessionName] = &http.Cookie{
+		Name: httpsession.DefaultSessionName, Value: string(before.Id())}
+	if id := whoami(t, attacker, "", ""); id != "" {
+		t.Errorf("the old session id should not be logged in, got %q", id)
+	}
+}
+
+func TestSessionAuthLogout(t *testing.T) {
+	s := newAuthServer(t, &SessionAuth{Key: "user"})
+	client := newTestClient(s)
+	client.get("/cart")
+	client.get("/login")
+	before := client.Session()
+	if id := whoami(t, client, "", ""); id != "alice" || before == nil {
+		t.Fatalf("expected alice to be logged in, got %q", id)
+	}
+
+	client.get("/logout")
+	if s.RootApp.SessionManager.Store().Exist(before.Id()) {
+		t.Error("the session id from before the logout should be removed")
+	}
+	after := client.Session()
+	if after == nil || after.Id() == before.Id() || after.Get("cart") != nil {
+		t.Errorf("the logout should leave an empty session under a new id, got %v", after)
+	}
+	if id := whoami(t, client, "", ""); id != "" {
+		t.Errorf("the user should be logged out, got %q", id)
+	}
+
+	attacker := newTestClient(s)
+	attacker.cookies[httpsession.DefaultSessionName] = &http.Cookie{
+		Name: httpsession.DefaultSessionName, Value: string(before.Id())}
+	if id := whoami(t, attacker, "", ""); id != "" {
+		t.Errorf("the old session id should be worth nothing, got %q", id)
+	}
+}
+
+func TestBasicAuthChecksXsrf(t *testing.T) {
+	client := newTestClient(newAuthServer(t, NewBasicAuthUsers("test", map[string]string{"alice": "secret"})))
+	req, _ := http.NewRequest("POST", "/me", nil)
+	req.Header.Set("Authorization", basic("alice", "secret"))
+	if w := client.do(req); w.Code != http.StatusForbidden {
+		t.Errorf("a browser sends basic credentials by itself, the xsrf token should be checked, got %d", w.Code)
+	}
+}
@@ -0,0 +1,275 @@
+package xweb
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Requirement is what a route asks of the user: any of the Roles and all
+// of the Permissions.
+type Requirement struct {
+	Roles       []string
+	Permissions []string
+}
+
+func (r *Requirement) Empty() bool {
+	return r == nil || len(r.Roles) == 0 && len(r.Permissions) == 0
+}
+
+func sameSet(a, b []string) bool {
+	set := make(map[string]bool)
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+	}
+	return len(set) == len(uniqueList(b))
+}
+
+func uniqueList(list []string) []string {
+	seen := make(map[string]bool)
+	r := make([]string, 0, len(list))
+	for _, v := range list {
+		if !seen[v] {
+			seen[v] = true
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// merge returns a requirement which asks for both. All the permissions add
+// up, but "any of the roles" of both can't be put in one list, so they have
+// to be the same.
+func (r *Requirement) merge(o *Requirement) (*Requirement, error) {
+	if r.Empty() {
+		return o, nil
+	}
+	roles := r.Roles
+	if len(roles) == 0 {
+		roles = o.Roles
+	} else if len(o.Roles) > 0 && !sameSet(r.Roles, o.Roles) {
+		return nil, fmt.Errorf("required roles %v and %v differ", r.Roles, o.Roles)
+	}
+	return &Requirement{
+		Roles:       roles,
+		Permissions: uniqueList(append(append([]string{}, r.Permissions...), o.Permissions...)),
+	}, nil
+}
+
+func splitList(s string) []string {
+	r := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// Authorizer decides whether a user meets a Requirement.
+type Authorizer interface {
+	Authorize(user *Principal, req *Requirement) bool
+}
+
+// RoleAuthorizer only knows the roles of the Principal, it is used when
+// App.Authorizer is nil and denies every permission.
+type RoleAuthorizer struct{}
+
+func (RoleAuthorizer) Authorize(user *Principal, req *Requirement) bool {
+	if len(req.Permissions) > 0 {
+		return false
+	}
+	for _, role := range req.Roles {
+		if user.HasRole(role) {
+			return true
+		}
+	}
+	return len(req.Roles) == 0
+}
+
+type rbacRole struct {
+	parents     []string
+	permissions map[string]bool
+}
+
+// RBAC grants permissions to roles, a role has the permissions of the roles
+// it inherits from as well.
+//
+//	rbac := xweb.NewRBAC()
+//	rbac.Grant("editor", "article.edit")
+//	rbac.AddRole("admin", "editor")
+//	rbac.Grant("admin", "user.edit")
+type RBAC struct {
+	roles map[string]*rbacRole
+	lock  sync.RWMutex
+}
+
+func NewRBAC() *RBAC {
+	return &RBAC{roles: make(map[string]*rbacRole)}
+}
+
+func (r *RBAC) role(name string) *rbacRole {
+	role, ok := r.roles[name]
+	if !ok {
+		role = &rbacRole{parents: make([]string, 0), permissions: make(map[string]bool)}
+		r.roles[name] = role
+	}
+	return role
+}
+
+// AddRole adds a role which inherits from the parents.
+func (r *RBAC) AddRole(name string, parents ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	role := r.role(name)
+	role.parents = append(role.parents, parents...)
+	for _, parent := range parents {
+		r.role(parent)
+	}
+}
+
+func (r *RBAC) Grant(name string, permissions ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	role := r.role(name)
+	for _, perm := range permissions {
+		role.permissions[perm] = true
+	}
+}
+
+func (r *RBAC) Revoke(name string, permissions ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if role, ok := r.roles[name]; ok {
+		for _, perm := range permissions {
+			delete(role.permissions, perm)
+		}
+	}
+}
+
+// expand returns the roles and all the roles they inherit from, cycles in
+// the inheritance are harmless.
+func (r *RBAC) expand(roles []string) map[string]bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	all := make(map[string]bool)
+	queue := append([]string{}, roles...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if all[name] {
+			continue
+		}
+		all[name] = true
+		if role, ok := r.roles[name]; ok {
+			queue = append(queue, role.parents...)
+		}
+	}
+	return all
+}
+
+func (r *RBAC) HasPermission(roles []string, permission string) bool {
+	all := r.expand(roles)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for name, _ := range all {
+		if role, ok := r.roles[name]; ok && role.permissions[permission] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RBAC) Authorize(user *Principal, req *Requirement) bool {
+	if len(req.Roles) > 0 {
+		all := r.expand(user.Roles)
+		var found bool
+		for _, role := range req.Roles {
+			if all[role] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, perm := range req.Permissions {
+		if !r.HasPermission(user.Roles, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// require adds req to what the method of the action already requires.
+func (a *App) require(t reflect.Type, method string, req *Requirement) {
+	if req.Empty() {
+		return
+	}
+	merged, err := a.requirements[t][method].merge(req)
+	if err != nil {
+		a.Panicf("%v.%v: %v", t.Name(), method, err)
+	}
+	if a.requirements[t] == nil {
+		a.requirements[t] = make(map[string]*Requirement)
+	}
+	a.requirements[t][method] = merged
+}
+
+// addRequirements collects the requirements of the Mapper tags
+//
+//	`roles:"admin,editor" perms:"article.edit"`
+//
+// and of the Authorize method of the action, which returns them by
+// method name. A route has to meet both, the roles of both must be the same.
+func (a *App) addRequirement(t reflect.Type, method string, tag reflect.StructTag) {
+	a.require(t, method, &Requirement{Roles: splitList(tag.Get("roles")), Permissions: splitList(tag.Get("perms"))})
+}
+
+func (a *App) addAuthorize(t reflect.Type, c interface{}) {
+	s, ok := c.(interface {
+		Authorize() map[string]*Requirement
+	})
+	if !ok {
+		return
+	}
+	for method, req := range s.Authorize() {
+		a.require(t, method, req)
+	}
+}
+
+// Requirement returns what the method of the action asks of the user.
+func (a *App) Requirement(t reflect.Type, method string) *Requirement {
+	return a.requirements[t][method]
+}
+
+// authorize asks the Authorizer about the requirement of the route. Without
+// a user the request is treated as not authenticated.
+func (a *App) authorize(c *Action, t reflect.Type, method string) bool {
+	req := a.Requirement(t, method)
+	if req.Empty() {
+		return true
+	}
+	if c.user == nil {
+		a.unauthorized(c)
+		return false
+	}
+	var authorizer Authorizer = RoleAuthorizer{}
+	if a.Authorizer != nil {
+		authorizer = a.Authorizer
+	}
+	if authorizer.Authorize(c.user, req) {
+		return true
+	}
+	c.StatusCode = http.StatusForbidden
+	a.error(c.ResponseWriter, http.StatusForbidden, "Forbidden")
+	return false
+}
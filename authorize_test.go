@@ -0,0 +1,156 @@
+package xweb
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRBACInheritance(t *testing.T) {
+	rbac := NewRBAC()
+	rbac.Grant("editor", "article.edit")
+	rbac.AddRole("admin", "editor")
+	rbac.Grant("admin", "user.edit")
+
+	if !rbac.HasPermission([]string{"admin"}, "article.edit") {
+		t.Error("admin should inherit the permissions of editor")
+	}
+	if rbac.HasPermission([]string{"editor"}, "user.edit") {
+		t.Error("editor should not get the permissions of admin")
+	}
+	admin := &Principal{Id: "alice", Roles: []string{"admin"}}
+	editor := &Principal{Id: "bob", Roles: []string{"editor"}}
+	req := &Requirement{Roles: []string{"editor"}, Permissions: []string{"article.edit"}}
+	if !rbac.Authorize(admin, req) || !rbac.Authorize(editor, req) {
+		t.Error("admin and editor should both be editors")
+	}
+	if rbac.Authorize(editor, &Requirement{Roles: []string{"admin"}}) {
+		t.Error("editor should not be an admin")
+	}
+
+	rbac.Revoke("editor", "article.edit")
+	if rbac.HasPermission([]string{"admin"}, "article.edit") {
+		t.Error("a revoked permission should not be inherited")
+	}
+}
+
+func TestRBACCycle(t *testing.T) {
+	rbac := NewRBAC()
+	rbac.AddRole("a", "b")
+	rbac.AddRole("b", "c")
+	rbac.AddRole("c", "a")
+	rbac.Grant("c", "read")
+
+	if !rbac.HasPermission([]string{"a"}, "read") || !rbac.HasPermission([]string{"b"}, "read") {
+		t.Error("the permission should be inherited around the cycle")
+	}
+	if rbac.HasPermission([]string{"a"}, "write") {
+		t.Error("a missing permission should be denied, not loop")
+	}
+	if !rbac.Authorize(&Principal{Roles: []string{"b"}}, &Requirement{Roles: []string{"a"}}) {
+		t.Error("b inherits a through c")
+	}
+}
+
+type articleAction struct {
+	*Action
+
+	edit   Mapper `xweb:"/edit" perms:"article.edit"`
+	remove Mapper `xweb:"/remove" roles:"admin"`
+}
+
+func (c *articleAction) Edit() string {
+	return "edit"
+}
+
+func (c *articleAction) Remove() string {
+	return "remove"
+}
+
+func (c *articleAction) Authorize() map[string]*Requirement {
+	return map[string]*Requirement{
+		"Edit":   {Roles: []string{"editor"}},
+		"Remove": {Permissions: []string{"article.remove"}},
+	}
+}
+
+type conflictAction struct {
+	*Action
+
+	edit Mapper `xweb:"/edit" roles:"admin"`
+}
+
+func (c *conflictAction) Edit() string {
+	return "edit"
+}
+
+func (c *conflictAction) Authorize() map[string]*Requirement {
+	return map[string]*Requirement{"Edit": {Roles: []string{"editor"}}}
+}
+
+func newArticleServer(t *testing.T) *Server {
+	rbac := NewRBAC()
+	rbac.Grant("editor", "article.edit")
+	rbac.AddRole("admin", "editor")
+	rbac.Grant("admin", "article.remove")
+	lookup := func(token string) (*Principal, error) {
+		return &Principal{Id: token, Roles: []string{token}}, nil
+	}
+	return newTestServer(t, func(a *App) {
+		a.Auth = NewAuth("", &TokenAuth{Lookup: lookup})
+		a.Authorizer = rbac
+	}, map[string]interface{}{"/": &articleAction{}})
+}
+
+func TestRequirementsCombined(t *testing.T) {
+	s := newArticleServer(t)
+	typ := reflect.TypeOf(articleAction{})
+	edit := s.RootApp.Requirement(typ, "Edit")
+	if !reflect.DeepEqual(edit.Roles, []string{"editor"}) || !reflect.DeepEqual(edit.Permissions, []string{"article.edit"}) {
+		t.Errorf("the tag and Authorize should be combined, got %+v", edit)
+	}
+
+	client := newTestClient(s)
+	status := func(url, role string) int {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+role)
+		return client.do(req).Code
+	}
+	for _, c := range []struct {
+		url, role string
+		code      int
+	}{
+		{"/edit", "editor", http.StatusOK},
+		{"/edit", "admin", http.StatusOK},
+		{"/edit", "guest", http.StatusForbidden},
+		{"/remove", "admin", http.StatusOK},
+		{"/remove", "editor", http.StatusForbidden},
+	} {
+		if code := status(c.url, c.role); code != c.code {
+			t.Errorf("%v as %v: expected %d, got %d", c.url, c.role, c.code, code)
+		}
+	}
+
+	nodes := s.RootApp.Nodes()["articleAction"]
+	if remove := strings.Join(nodes["Remove"], " "); !strings.HasSuffix(remove, " role:admin perm:article.remove") {
+		t.Errorf("Nodes should list the required roles after the methods, got %v", remove)
+	}
+	if req := s.RootApp.NodeRequirements()["articleAction"]["Remove"]; req == nil || req.Roles[0] != "admin" {
+		t.Errorf("NodeRequirements should list the requirements, got %+v", req)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("different roles in the tag and Authorize should be refused")
+		}
+	}()
+	s.RootApp.AddRouter("/conflict", &conflictAction{})
+}
+
+func TestAuthorizeChallenge(t *testing.T) {
+	w := newTestClient(newArticleServer(t)).get("/edit")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("an anonymous request should get a 401 with a challenge, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,493 @@
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// TemplateExts are the extensions of the files CheckTemplates takes for
+// templates.
+var TemplateExts = []string{".html", ".htm", ".tpl", ".tmpl"}
+
+// TemplateError is a problem found by a TemplateChecker, in a template or
+// in a Go file which renders a template.
+type TemplateError struct {
+	File string
+	Line int
+	Err  string
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%v:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%v: %v", e.File, e.Err)
+}
+
+// TemplateReport is the result of a TemplateChecker.
+type TemplateReport struct {
+	Templates []string //templates checked
+	Errors    []*TemplateError
+	Unused    []string //templates nothing renders, only known when Sources are given
+}
+
+// Err returns the errors as one, nil when there is none.
+func (r *TemplateReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		msgs[i] = e.Error()
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// TemplateChecker compiles all the templates of an app, instead of waiting
+// for a request to find their errors. Every template is parsed with the
+// functions of the app and of App.TemplateEngine, with the layouts it
+// extends, and the templates it includes or calls have to exist.
+//
+// Sources are Go files or directories. The literal names given to Render
+// and SHOW in them are checked, the functions they Assign are known to
+// the templates, and the templates which are neither rendered nor
+// included nor used as a layout are reported as unused. Use it in a test:
+//
+//	func TestTemplates(t *testing.T) {
+//		app := xweb.NewApp("/", "main")
+//		app.AppConfig.TemplateDir = "templates"
+//		report, err := app.CheckTemplates(".")
+//		if err != nil {
+//			t.Fatal(err)
+//		}
+//		for _, e := range report.Errors {
+//			t.Error(e)
+//		}
+//	}
+//
+// Only the templates of the app are checked, not the ones of its Themes.
+type TemplateChecker struct {
+	App     *App
+	Sources []string
+	Funcs   []string //functions actions assign, besides the ones found in Sources
+	Exts    []string //TemplateExts by default
+}
+
+func NewTemplateChecker(app *App, sources ...string) *TemplateChecker {
+	return &TemplateChecker{App: app, Sources: sources}
+}
+
+// CheckTemplates checks the templates of the app, see TemplateChecker.
+func (a *App) CheckTemplates(sources ...string) (*TemplateReport, error) {
+	return NewTemplateChecker(a, sources...).Check()
+}
+
+// templateRef is where a Go file names a template.
+type templateRef struct {
+	name string
+	file string
+	line int
+}
+
+type templateCheck struct {
+	*TemplateChecker
+	fsys    fs.FS
+	report  *TemplateReport
+	known   map[string]bool
+	uses    map[string][]string //templates a template includes or extends
+	renders []templateRef
+	layouts []string
+	assigns []string
+	seen    map[string]bool //errors already reported, by the layouts of many pages
+}
+
+// Check returns the problems of the templates. The error is for the files
+// which can not be read.
+func (tc *TemplateChecker) Check() (*TemplateReport, error) {
+	check := &templateCheck{
+		TemplateChecker: tc,
+		fsys:            tc.App.templateFS(),
+		report:          &TemplateReport{},
+		known:           make(map[string]bool),
+		uses:            make(map[string][]string),
+		seen:            make(map[string]bool),
+	}
+	for _, src := range tc.Sources {
+		if err := check.scanSources(src); err != nil {
+			return nil, err
+		}
+	}
+	if err := check.list(); err != nil {
+		return nil, err
+	}
+	funcs := check.funcs()
+	for _, name := range check.report.Templates {
+		content, err := fs.ReadFile(check.fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		check.template(name, string(content), funcs)
+	}
+	for _, ref := range check.renders {
+		if check.resolve(ref.name) == "" {
+			check.addError(&TemplateError{ref.file, ref.line, fmt.Sprintf("template %v not found", ref.name)})
+		}
+	}
+	if len(tc.Sources) > 0 {
+		check.unused()
+	}
+	sortTemplateErrors(check.report.Errors)
+	return check.report, nil
+}
+
+// list finds the templates.
+func (check *templateCheck) list() error {
+	exts := check.Exts
+	if len(exts) == 0 {
+		exts = TemplateExts
+	}
+	return fs.WalkDir(check.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		for _, ext := range exts {
+			if path.Ext(name) == ext {
+				check.known[name] = true
+				check.report.Templates = append(check.report.Templates, name)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// resolve returns the template a name refers to, a layout may have no
+// extension.
+func (check *templateCheck) resolve(name string) string {
+	name = fsPath(name)
+	if check.known[name] {
+		return name
+	}
+	if path.Ext(name) == "" {
+		for _, t := range check.report.Templates {
+			if strings.TrimSuffix(t, path.Ext(t)) == name {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// funcs are the functions of a request, with stubs for the ones which
+// actions assign.
+func (check *templateCheck) funcs() template.FuncMap {
+	a := check.App
+	if a.TemplateFuncs() == nil {
+		a.tplLock.Lock()
+		a.publishTemplateVars()
+		a.tplLock.Unlock()
+	}
+	var funcs template.FuncMap
+	switch e := a.TemplateEngine.(type) {
+	case *TplexEngine:
+		funcs = e.loadFuncs(a)
+	case *HtmlTemplateEngine:
+		funcs = e.loadFuncs(a)
+	default:
+		funcs = NewHtmlTemplateEngine(a).loadFuncs(a)
+	}
+	for _, names := range [][]string{check.Funcs, check.assigns} {
+		for _, name := range names {
+			if _, ok := funcs[name]; !ok {
+				funcs[name] = stubFunc
+			}
+		}
+	}
+	return funcs
+}
+
+func (check *templateCheck) template(name, content string, funcs template.FuncMap) {
+	var (
+		files  []templateFile
+		delims [2]string
+		err    error
+	)
+	switch e := check.App.TemplateEngine.(type) {
+	case *TplexEngine:
+		if files, err = e.files(name); err == nil {
+			for _, f := range files[1:] {
+				check.uses[name] = append(check.uses[name], templateFileName(f.Name))
+			}
+		}
+		delims = e.cache.Delims
+	case *HtmlTemplateEngine, nil:
+		// the default layout is left out, a page with it or without it
+		// has the same errors
+		if files, err = check.App.layoutChain(nil, name, content, ""); err == nil {
+			for _, f := range files {
+				if f.Name != name && !strings.Contains(f.Name, "#") {
+					check.uses[name] = append(check.uses[name], f.Name)
+				}
+			}
+		}
+	default:
+		if err = e.Load(name); err != nil {
+			check.templateError(name, err)
+		}
+		return
+	}
+	if err != nil {
+		check.templateError(name, err)
+		return
+	}
+	compiled, err := (&TemplateCache{Delims: delims}).compile(files, funcs)
+	if err != nil {
+		check.templateError(name, err)
+		return
+	}
+	for _, t := range compiled.master.Templates() {
+		if t.Tree != nil {
+			check.walk(compiled.master, t.Tree, t.Tree.Root, name)
+		}
+	}
+}
+
+// walk checks that the templates called and included exist.
+func (check *templateCheck) walk(root *template.Template, tree *parse.Tree, node parse.Node, name string) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	switch n := node.(type) {
+	case *parse.ListNode:
+		for _, child := range n.Nodes {
+			check.walk(root, tree, child, name)
+		}
+	case *parse.ActionNode:
+		check.walk(root, tree, n.Pipe, name)
+	case *parse.PipeNode:
+		for _, cmd := range n.Cmds {
+			check.walk(root, tree, cmd, name)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 2 {
+			ident, ok := n.Args[0].(*parse.IdentifierNode)
+			str, isStr := n.Args[1].(*parse.StringNode)
+			if ok && isStr && ident.Ident == "include" {
+				if check.resolve(str.Text) == "" {
+					check.nodeError(tree, n, fmt.Sprintf("included template %v not found", str.Text))
+				} else {
+					check.uses[name] = append(check.uses[name], str.Text)
+				}
+			}
+		}
+		for _, arg := range n.Args {
+			check.walk(root, tree, arg, name)
+		}
+	case *parse.IfNode:
+		check.walkBranch(root, tree, &n.BranchNode, name)
+	case *parse.RangeNode:
+		check.walkBranch(root, tree, &n.BranchNode, name)
+	case *parse.WithNode:
+		check.walkBranch(root, tree, &n.BranchNode, name)
+	case *parse.TemplateNode:
+		if root.Lookup(n.Name) == nil {
+			check.nodeError(tree, n, fmt.Sprintf("template %q is not defined", n.Name))
+		}
+		check.walk(root, tree, n.Pipe, name)
+	}
+}
+
+func (check *templateCheck) walkBranch(root *template.Template, tree *parse.Tree, n *parse.BranchNode, name string) {
+	check.walk(root, tree, n.Pipe, name)
+	check.walk(root, tree, n.List, name)
+	check.walk(root, tree, n.ElseList, name)
+}
+
+var templateErrorRegexp = regexp.MustCompile(`^(?:html/)?template: ([^:]+):(\d+):(?:\d+:)?\s*(.*)$`)
+
+// templateError splits "template: name:line: message".
+func (check *templateCheck) templateError(name string, err error) {
+	m := templateErrorRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		check.addError(&TemplateError{name, 0, err.Error()})
+		return
+	}
+	line, _ := strconv.Atoi(m[2])
+	check.addError(&TemplateError{templateFileName(m[1]), line, m[3]})
+}
+
+func (check *templateCheck) nodeError(tree *parse.Tree, node parse.Node, msg string) {
+	location, _ := tree.ErrorContext(node)
+	parts := strings.Split(location, ":")
+	line := 0
+	if len(parts) >= 2 {
+		line, _ = strconv.Atoi(parts[1])
+	}
+	check.addError(&TemplateError{templateFileName(parts[0]), line, msg})
+}
+
+// templateFileName drops the suffix of the templates added to a file,
+// page.html#content is page.html.
+func templateFileName(name string) string {
+	if pos := strings.Index(name, "#"); pos >= 0 {
+		return name[:pos]
+	}
+	return name
+}
+
+func (check *templateCheck) addError(e *TemplateError) {
+	if !check.seen[e.Error()] {
+		check.seen[e.Error()] = true
+		check.report.Errors = append(check.report.Errors, e)
+	}
+}
+
+// unused finds the templates which can not be reached from the ones Go
+// files render, the layouts and the error page.
+func (check *templateCheck) unused() {
+	roots := []string{"_error.html", check.App.AppConfig.Layout}
+	roots = append(roots, check.layouts...)
+	for _, ref := range check.renders {
+		roots = append(roots, ref.name)
+	}
+	reached := make(map[string]bool)
+	for len(roots) > 0 {
+		name := check.resolve(roots[0])
+		roots = roots[1:]
+		if name == "" || reached[name] {
+			continue
+		}
+		reached[name] = true
+		roots = append(roots, check.uses[name]...)
+	}
+	for _, name := range check.report.Templates {
+		if !reached[name] {
+			check.report.Unused = append(check.report.Unused, name)
+		}
+	}
+}
+
+// scanSources reads the Go files of src, a file or a directory and its
+// subdirectories.
+func (check *templateCheck) scanSources(src string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			base := info.Name()
+			if file != src && (base == "vendor" || base == "testdata" || strings.HasPrefix(base, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(file) != ".go" {
+			return nil
+		}
+		return check.scanFile(file)
+	})
+}
+
+func (check *templateCheck) scanFile(file string) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, 0)
+	if err != nil {
+		return err
+	}
+	ast.Inspect(f, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || len(n.Args) == 0 {
+				break
+			}
+			name, ok := stringLit(n.Args[0])
+			if !ok {
+				break
+			}
+			switch sel.Sel.Name {
+			case "Render":
+				check.renders = append(check.renders, templateRef{name, file, fset.Position(n.Pos()).Line})
+			case "Assign":
+				check.assigns = append(check.assigns, name)
+			}
+		case *ast.CompositeLit:
+			if !isShowType(n.Type) || len(n.Elts) == 0 {
+				break
+			}
+			for i, elt := range n.Elts {
+				value := elt
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); !ok || key.Name != "Tmpl" {
+						continue
+					}
+					value = kv.Value
+				} else if i > 0 {
+					break
+				}
+				if name, ok := stringLit(value); ok {
+					check.renders = append(check.renders, templateRef{name, file, fset.Position(value.Pos()).Line})
+				}
+			}
+		case *ast.Field:
+			if n.Tag == nil {
+				break
+			}
+			tag, err := strconv.Unquote(n.Tag.Value)
+			if err != nil {
+				break
+			}
+			if layout := reflect.StructTag(tag).Get("layout"); layout != "" && layout != "-" {
+				check.layouts = append(check.layouts, layout)
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+func stringLit(expr ast.Expr) (string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+func isShowType(expr ast.Expr) bool {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name == "SHOW"
+	case *ast.SelectorExpr:
+		return t.Sel.Name == "SHOW"
+	}
+	return false
+}
+
+// sortTemplateErrors orders errors by file and line.
+func sortTemplateErrors(errs []*TemplateError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		return errs[i].Line < errs[j].Line
+	})
+}
@@ -0,0 +1,72 @@
+// Command xwebcheck compiles the templates of an xweb app and reports their
+// errors with file:line, and the templates the Go code never renders.
+//
+//	xwebcheck -templates templates -funcs user,menu ./...
+//
+// The arguments are the Go files or directories to search for Render and
+// SHOW, the current directory by default. Functions registered with
+// App.Assign in code are not known to the command, list them with -funcs;
+// the ones actions Assign are found in the sources. The exit status is 1
+// when a template has errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coscms/xweb"
+	"github.com/coscms/xweb/log"
+)
+
+func main() {
+	templates := flag.String("templates", "templates", "template directory")
+	layout := flag.String("layout", "", "default layout, AppConfig.Layout")
+	funcs := flag.String("funcs", "", "comma separated names of the functions the app assigns")
+	tplex := flag.Bool("tplex", false, "templates are rendered by TplexEngine")
+	unused := flag.Bool("unused", true, "report the templates nothing renders")
+	flag.Parse()
+
+	sources := flag.Args()
+	if len(sources) == 0 {
+		sources = []string{"."}
+	}
+	for i, src := range sources {
+		sources[i] = strings.TrimSuffix(src, "/...")
+	}
+
+	app := xweb.NewApp("/", "check")
+	app.Logger = log.New(os.Stderr, "", 0)
+	app.AppConfig.TemplateDir = *templates
+	app.AppConfig.Layout = *layout
+	if *tplex {
+		app.TemplateEngine = xweb.NewTplexEngine(app)
+	}
+	checker := xweb.NewTemplateChecker(app, sources...)
+	if *funcs != "" {
+		checker.Funcs = strings.Split(*funcs, ",")
+	}
+	report, err := checker.Check()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "xwebcheck:", err)
+		os.Exit(2)
+	}
+
+	for _, e := range report.Errors {
+		if filepath.Ext(e.File) != ".go" {
+			e.File = filepath.Join(*templates, filepath.FromSlash(e.File))
+		}
+		fmt.Println(e)
+	}
+	if *unused {
+		for _, name := range report.Unused {
+			fmt.Printf("%v: unused template\n", filepath.Join(*templates, filepath.FromSlash(name)))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d templates, %d errors\n", len(report.Templates), len(report.Errors))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,232 @@
+package xweb
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cors answers preflight requests and adds the Access-Control-* headers
+// for the origins it allows.
+type Cors struct {
+	// AllowOrigins are origins like https://example.com, * matches any
+	// part of a host, e.g. https://*.example.com, and a single * allows all
+	// unless AllowCredentials is set.
+	AllowOrigins []string
+	// OriginRegexps have to match the whole origin.
+	OriginRegexps []*regexp.Regexp
+	// AllowMethods limits the methods, empty allows the methods which are
+	// registered for the requested path.
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed, empty allows the
+	// headers the preflight asks for.
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int64 //seconds the preflight may be cached
+}
+
+var ErrCorsCredentials = errors.New("cors: AllowOrigins * can not be used with AllowCredentials, it would let every site act as the user")
+
+func NewCors(origins ...string) *Cors {
+	return &Cors{AllowOrigins: origins}
+}
+
+// Validate rejects settings which are not safe, the App checks its Cors and
+// those of its route groups when it starts.
+func (s *Cors) Validate() error {
+	if s.AllowCredentials {
+		for _, o := range s.AllowOrigins {
+			if o == "*" {
+				return ErrCorsCredentials
+			}
+		}
+	}
+	return nil
+}
+
+// AddOriginRegexps compiles the patterns anchored, so they match whole origins.
+func (s *Cors) AddOriginRegexps(patterns ...string) {
+	for _, r := range patterns {
+		cr, err := regexp.Compile("^(?:" + r + ")$")
+		if err == nil {
+			s.OriginRegexps = append(s.OriginRegexps, cr)
+		}
+	}
+}
+
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		pos := strings.Index(s, part)
+		if pos < 0 {
+			return false
+		}
+		s = s[pos+len(part):]
+	}
+	return true
+}
+
+func (s *Cors) OriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, o := range s.AllowOrigins {
+		if o == "*" {
+			// never reflect any origin along with credentials, even if
+			// Validate was not called
+			if !s.AllowCredentials {
+				return true
+			}
+		} else if wildcardMatch(strings.ToLower(o), origin) {
+			return true
+		}
+	}
+	for _, cr := range s.OriginRegexps {
+		if cr.FindString(origin) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Cors) allowAll() bool {
+	return len(s.AllowOrigins) == 1 && s.AllowOrigins[0] == "*" && !s.AllowCredentials
+}
+
+func (s *Cors) setOrigin(header http.Header, origin string) {
+	if s.allowAll() {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	if s.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Preflight answers an OPTIONS preflight request, methods are the methods
+// registered for the path.
+func (s *Cors) Preflight(w http.ResponseWriter, req *http.Request, methods map[string]bool) int {
+	origin := req.Header.Get("Origin")
+	if !s.OriginAllowed(origin) {
+		return http.StatusForbidden
+	}
+	if len(s.AllowMethods) > 0 {
+		allowed := make(map[string]bool)
+		for _, m := range s.AllowMethods {
+			m = strings.ToUpper(m)
+			if methods[m] {
+				allowed[m] = true
+			}
+		}
+		methods = allowed
+	}
+	if methods["GET"] {
+		methods["HEAD"] = true
+	}
+	if !methods[strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))] {
+		return http.StatusForbidden
+	}
+	header := w.Header()
+	s.setOrigin(header, origin)
+	list := make([]string, 0, len(methods))
+	for m, _ := range methods {
+		list = append(list, m)
+	}
+	sort.Strings(list)
+	header.Set("Access-Control-Allow-Methods", strings.Join(list, ", "))
+	if len(s.AllowHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(s.AllowHeaders, ", "))
+	} else if h := req.Header.Get("Access-Control-Request-Headers"); h != "" {
+		header.Set("Access-Control-Allow-Headers", h)
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if s.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.FormatInt(s.MaxAge, 10))
+	}
+	return http.StatusNoContent
+}
+
+// Apply adds the headers of an actual cross origin request
+func (s *Cors) Apply(w http.ResponseWriter, req *http.Request) {
+	origin := req.Header.Get("Origin")
+	if !s.OriginAllowed(origin) {
+		if !s.allowAll() {
+			w.Header().Add("Vary", "Origin")
+		}
+		return
+	}
+	header := w.Header()
+	s.setOrigin(header, origin)
+	if len(s.ExposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(s.ExposeHeaders, ", "))
+	}
+}
+
+// checkCors stops the App from starting with a Cors which is not safe
+func (a *App) checkCors() {
+	if a.Cors != nil {
+		if err := a.Cors.Validate(); err != nil {
+			a.Panic(err)
+		}
+	}
+	for _, g := range a.groups {
+		if g.Cors != nil {
+			if err := g.Cors.Validate(); err != nil {
+				a.Panicf("group %v: %v", g.Prefix, err)
+			}
+		}
+	}
+}
+
+// cors returns the Cors of the route group or the App
+func (a *App) cors(reqPath string) *Cors {
+	if g := a.routeGroup(reqPath); g != nil && g.Cors != nil {
+		return g.Cors
+	}
+	return a.Cors
+}
+
+// handleCors adds the CORS headers, it returns the status when the request
+// was a preflight which has been answered.
+func (a *App) handleCors(w http.ResponseWriter, req *http.Request) int {
+	if req.Header.Get("Origin") == "" {
+		return 0
+	}
+	reqPath := req.URL.Path
+	if epos := strings.LastIndex(reqPath, "."); epos > 0 && epos+1 < len(reqPath) {
+		reqPath = reqPath[0:epos]
+	}
+	reqPath = a.relativePath(reqPath)
+	cors := a.cors(reqPath)
+	if cors == nil {
+		return 0
+	}
+	if req.Method != "OPTIONS" || req.Header.Get("Access-Control-Request-Method") == "" {
+		cors.Apply(w, req)
+		return 0
+	}
+	methods := a.Route.Methods(reqPath)
+	if len(methods) == 0 {
+		return 0
+	}
+	status := cors.Preflight(w, req, methods)
+	w.WriteHeader(status)
+	return status
+}
@@ -0,0 +1,111 @@
+package xweb
+
+import (
+	"net/http"
+	"testing"
+)
+
+type corsAction struct {
+	*Action
+
+	data Mapper `xweb:"GET|POST /data"`
+}
+
+func (c *corsAction) Data() string {
+	return "data"
+}
+
+func newCorsServer(t *testing.T, cors *Cors) *Server {
+	return newTestServer(t, func(a *App) {
+		a.Cors = cors
+	}, map[string]interface{}{"/": &corsAction{}})
+}
+
+func corsRequest(s *Server, method, origin, requestMethod string) http.Header {
+	req, _ := http.NewRequest(method, "/data", nil)
+	req.Header.Set("Origin", origin)
+	if requestMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestMethod)
+		req.Header.Set("Access-Control-Request-Headers", "X-Token")
+	}
+	w := newTestClient(s).do(req)
+	w.Header().Set("X-Status", http.StatusText(w.Code))
+	return w.Header()
+}
+
+func TestCorsPreflight(t *testing.T) {
+	cors := NewCors("https://*.example.com")
+	cors.MaxAge = 600
+	s := newCorsServer(t, cors)
+
+	header := corsRequest(s, "OPTIONS", "https://app.example.com", "POST")
+	if header.Get("X-Status") != "No Content" ||
+		header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		header.Get("Access-Control-Allow-Methods") != "GET, HEAD, POST" ||
+		header.Get("Access-Control-Allow-Headers") != "X-Token" ||
+		header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("unexpected preflight answer %v", header)
+	}
+	if header := corsRequest(s, "OPTIONS", "https://app.example.com", "DELETE"); header.Get("X-Status") != "Forbidden" {
+		t.Errorf("a method which is not registered should be forbidden, got %v", header)
+	}
+	if header := corsRequest(s, "OPTIONS", "https://evil.com", "GET"); header.Get("X-Status") != "Forbidden" {
+		t.Errorf("another origin should be forbidden, got %v", header)
+	}
+	header = corsRequest(s, "GET", "https://evil.com", "")
+	if header.Get("Access-Control-Allow-Origin") != "" || header.Get("Vary") != "Origin" {
+		t.Errorf("another origin should get no CORS headers, got %v", header)
+	}
+}
+
+func TestCorsCredentials(t *testing.T) {
+	all := newCorsServer(t, NewCors("*"))
+	if header := corsRequest(all, "GET", "https://any.com", ""); header.Get("Access-Control-Allow-Origin") != "*" ||
+		header.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("all origins should be allowed without credentials, got %v", header)
+	}
+
+	cors := NewCors("https://app.example.com")
+	cors.AllowCredentials = true
+	header := corsRequest(newCorsServer(t, cors), "GET", "https://app.example.com", "")
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		header.Get("Access-Control-Allow-Credentials") != "true" || header.Get("Vary") != "Origin" {
+		t.Errorf("the origin should be allowed with credentials, got %v", header)
+	}
+
+	unsafe := &Cors{AllowOrigins: []string{"*"}, AllowCredentials: true}
+	if unsafe.Validate() != ErrCorsCredentials {
+		t.Error("* with credentials should not be valid")
+	}
+	if unsafe.OriginAllowed("https://evil.com") {
+		t.Error("* with credentials should allow no origin")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("an app with * and credentials should not start")
+		}
+	}()
+	newCorsServer(t, unsafe)
+}
+
+func TestCorsOriginMatching(t *testing.T) {
+	cors := NewCors("https://*.example.com", "http://localhost:8080")
+	cors.AddOriginRegexps(`https://[a-z]+\.example\.org`)
+	cases := map[string]bool{
+		"https://app.example.com":                 true,
+		"HTTPS://App.Example.com":                 true,
+		"https://example.com":                     false,
+		"http://app.example.com":                  false,
+		"http://localhost:8080":                   true,
+		"http://localhost:8081":                   false,
+		"https://shop.example.org":                true,
+		"https://shop.example.org.evil.com":       false,
+		"https://evil.com/?https://a.example.org": false,
+		"": false,
+	}
+	for origin, allowed := range cases {
+		if cors.OriginAllowed(origin) != allowed {
+			t.Errorf("%q allowed should be %v", origin, allowed)
+		}
+	}
+}
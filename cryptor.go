@@ -4,45 +4,45 @@ import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"encoding/base64"
 	"github.com/coscms/xweb/lib/str"
 	"log"
+	"strings"
 )
 
 type Cryptor interface {
 	Encode(rawData, authKey string) string
-	Decode(cryptedData, authKey string) string
+	// Decode returns an error when cryptedData was not made by Encode
+	// with the same key.
+	Decode(cryptedData, authKey string) (string, error)
 }
 
+// AesCrypto uses AES-CBC without authentication, it is kept for data
+// encrypted by older versions. Use AeadCrypto for anything new.
 type AesCrypto struct {
-	key map[string][]byte
 }
 
-var DefaultCryptor Cryptor = &AesCrypto{key: make(map[string][]byte, 0)}
+// DefaultCryptor is the Cryptor of new apps. It was an AesCrypto before,
+// see AeadCrypto.Legacy to read the data it encrypted.
+var DefaultCryptor Cryptor = &AeadCrypto{}
 
 const (
 	aesKeyLen = 128
 	keyLen    = aesKeyLen / 8
 )
 
+// aesKey folds the key into 16 bytes. It is cheap enough not to be cached,
+// a cache would grow with every client under CookieLimitIP/UA.
 func (c *AesCrypto) aesKey(key []byte) []byte {
-	if c.key == nil {
-		c.key = make(map[string][]byte, 0)
+	if len(key) == keyLen {
+		return key
 	}
-	ckey := string(key)
-	k, ok := c.key[ckey]
-	if !ok {
-		if len(key) == keyLen {
-			return key
+	k := make([]byte, keyLen)
+	copy(k, key)
+	for i := keyLen; i < len(key); {
+		for j := 0; j < keyLen && i < len(key); j, i = j+1, i+1 {
+			k[j] ^= key[i]
 		}
-
-		k = make([]byte, keyLen)
-		copy(k, key)
-		for i := keyLen; i < len(key); {
-			for j := 0; j < keyLen && i < len(key); j, i = j+1, i+1 {
-				k[j] ^= key[i]
-			}
-		}
-		c.key[ckey] = k
 	}
 	return k
 }
@@ -64,25 +64,34 @@ func (c *AesCrypto) Encode(rawData, authKey string) string {
 	return str.Base64Encode(string(crypted))
 }
 
-func (c *AesCrypto) Decode(cryptedData, authKey string) string {
-	cryptedData = str.Base64Decode(cryptedData)
-	if cryptedData == "" {
-		return ""
+func (c *AesCrypto) Decode(cryptedData, authKey string) (string, error) {
+	// Encode trims the base64 padding, which str.Base64Decode can not handle
+	in, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(cryptedData, "="))
+	if err != nil || len(in) == 0 {
+		return "", ErrDecrypt
 	}
-	in := []byte(cryptedData)
 	key := []byte(authKey)
 	key = c.aesKey(key)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		log.Println(err)
-		return ""
+		return "", err
 	}
 	blockSize := block.BlockSize()
+	if len(in)%blockSize != 0 {
+		return "", ErrDecrypt
+	}
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	origData := make([]byte, len(in))
 	blockMode.CryptBlocks(origData, in)
+	// without a MAC the padding is the only thing which can be checked
+	padding := int(origData[len(origData)-1])
+	if padding == 0 || padding > blockSize ||
+		!bytes.Equal(origData[len(origData)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return "", ErrDecrypt
+	}
 	origData = PKCS5UnPadding(origData)
-	return string(origData)
+	return string(origData), nil
 }
 
 func ZeroPadding(ciphertext []byte, blockSize int) []byte {
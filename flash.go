@@ -0,0 +1,112 @@
+package xweb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	FLASH_TAG string = "_flash"
+
+	FlashSuccess = "success"
+	FlashError   = "error"
+	FlashWarning = "warning"
+	FlashInfo    = "info"
+)
+
+type FlashMessage struct {
+	Type    string
+	Message string
+}
+
+// Flash keeps one-shot messages in the session. They survive a redirect
+// and are cleared as soon as they have been read.
+type Flash struct {
+	action *Action
+	read   []*FlashMessage
+}
+
+func NewFlash(c *Action) *Flash {
+	return &Flash{action: c}
+}
+
+func (f *Flash) key() string {
+	return f.action.App.AppConfig.CookiePrefix + FLASH_TAG
+}
+
+// stored messages are json encoded, so that every session store can keep them
+func (f *Flash) load() []*FlashMessage {
+	msgs := make([]*FlashMessage, 0)
+	s, ok := f.action.GetSession(f.key()).(string)
+	if !ok || s == "" {
+		return msgs
+	}
+	if err := json.Unmarshal([]byte(s), &msgs); err != nil {
+		f.action.Warnf("flash messages decode failed: %v", err)
+	}
+	return msgs
+}
+
+func (f *Flash) Add(typ string, message string, args ...interface{}) {
+	if !f.action.App.AppConfig.SessionOn {
+		f.action.Warn("flash messages need the session")
+		return
+	}
+	if len(args) > 0 {
+		message = fmt.Sprintf(message, args...)
+	}
+	msgs := append(f.load(), &FlashMessage{Type: typ, Message: message})
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		f.action.Error(err)
+		return
+	}
+	f.action.SetSession(f.key(), string(b))
+	// the messages read before are gone, Has and Messages see the new ones
+	f.read = nil
+}
+
+func (f *Flash) Success(message string, args ...interface{}) {
+	f.Add(FlashSuccess, message, args...)
+}
+
+func (f *Flash) Error(message string, args ...interface{}) {
+	f.Add(FlashError, message, args...)
+}
+
+func (f *Flash) Warning(message string, args ...interface{}) {
+	f.Add(FlashWarning, message, args...)
+}
+
+func (f *Flash) Info(message string, args ...interface{}) {
+	f.Add(FlashInfo, message, args...)
+}
+
+// Has reports whether there are unread messages, without clearing them.
+func (f *Flash) Has() bool {
+	if f.read != nil {
+		return len(f.read) > 0
+	}
+	if !f.action.App.AppConfig.SessionOn {
+		return false
+	}
+	return len(f.load()) > 0
+}
+
+// Messages returns the pending messages and removes them from the session.
+// Calling it again during the same request returns the same messages,
+// unless messages were added in between.
+func (f *Flash) Messages() []*FlashMessage {
+	if f.read != nil {
+		return f.read
+	}
+	if !f.action.App.AppConfig.SessionOn {
+		f.read = make([]*FlashMessage, 0)
+		return f.read
+	}
+	f.read = f.load()
+	if len(f.read) > 0 {
+		f.action.DelSession(f.key())
+	}
+	return f.read
+}
@@ -0,0 +1,114 @@
+package xweb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type flashAction struct {
+	*Action
+
+	add    Mapper `xweb:"/add"`
+	show   Mapper `xweb:"/show"`
+	typed  Mapper `xweb:"/typed"`
+	decode Mapper `xweb:"/decode"`
+	page   Mapper `xweb:"/page"`
+}
+
+func (c *flashAction) Add() string {
+	c.Flash().Success("saved %d", 1)
+	c.Flash().Error("oops")
+	return "ok"
+}
+
+func flashText(msgs []*FlashMessage) string {
+	texts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		texts[i] = msg.Type + ":" + msg.Message
+	}
+	return strings.Join(texts, ",")
+}
+
+func (c *flashAction) Show() string {
+	first := flashText(c.Flash().Messages())
+	again := flashText(c.Flash().Messages())
+	c.Flash().Info("later")
+	return fmt.Sprintf("%v|%v|%v|%v", first, again, c.Flash().Has(), flashText(c.Flash().Messages()))
+}
+
+func (c *flashAction) Typed() string {
+	c.SetSession("int", 42)
+	c.SetSession("str", "7")
+	c.SetSession("float", 2.9)
+	c.SetSession("bool", "true")
+	c.SetSession("bytes", []byte("raw"))
+	return fmt.Sprintf("%v %v %v %v %v %v %v %q",
+		c.GetSessionInt("int"), c.GetSessionInt("str"), c.GetSessionInt("float"),
+		c.GetSessionBool("bool"), c.GetSessionBool("int"), c.GetSessionBool("missing"),
+		c.GetSessionString("int"), c.GetSessionString("bytes")+c.GetSessionString("missing"))
+}
+
+type cartItem struct {
+	Name  string
+	Count int
+}
+
+func (c *flashAction) Decode() string {
+	var stored, direct cartItem
+	c.SessionEncode("json", &cartItem{"book", 3})
+	c.SetSession("direct", cartItem{"pen", 1})
+	err1 := c.SessionDecode("json", &stored)
+	err2 := c.SessionDecode("direct", &direct)
+	err3 := c.SessionDecode("missing", &direct)
+	return fmt.Sprintf("%v %v %v %v %v", stored, direct, err1, err2, err3 != nil)
+}
+
+func (c *flashAction) Page() error {
+	return c.RenderString(`{{range flashes}}{{.Type}}:{{.Message}} {{end}}`)
+}
+
+func TestFlash(t *testing.T) {
+	s := newTestServer(t, nil, map[string]interface{}{"/": &flashAction{}})
+	client := newTestClient(s)
+
+	client.get("/add")
+	body := client.get("/show").Body.String()
+	if body != "success:saved 1,error:oops|success:saved 1,error:oops|true|info:later" {
+		t.Errorf("unexpected messages %q", body)
+	}
+	if body := client.get("/show").Body.String(); body != "||true|info:later" {
+		t.Errorf("the messages should have been read once, got %q", body)
+	}
+	// the message added by the last request was read by that request
+	if body := client.get("/show").Body.String(); body != "||true|info:later" {
+		t.Errorf("unexpected messages %q", body)
+	}
+}
+
+func TestFlashTemplate(t *testing.T) {
+	client := newTestClient(newTestServer(t, nil, map[string]interface{}{"/": &flashAction{}}))
+	client.get("/add")
+	if body := client.get("/page").Body.String(); body != "success:saved 1 error:oops " {
+		t.Errorf("the template should list the messages, got %q", body)
+	}
+	if body := client.get("/page").Body.String(); body != "" {
+		t.Errorf("the messages should have been shown once, got %q", body)
+	}
+}
+
+func TestSessionDecode(t *testing.T) {
+	s := newTestServer(t, nil, map[string]interface{}{"/": &flashAction{}})
+	body := newTestClient(s).get("/decode").Body.String()
+	if body != "{book 3} {pen 1} <nil> <nil> true" {
+		t.Errorf("unexpected values %q", body)
+	}
+}
+
+func TestTypedSession(t *testing.T) {
+	s := newTestServer(t, nil, map[string]interface{}{"/": &flashAction{}})
+	body := newTestClient(s).get("/typed").Body.String()
+	if body != `42 7 2 true true false 42 "raw"` {
+		t.Errorf("unexpected values %q", body)
+	}
+}
@@ -0,0 +1,139 @@
+package xweb
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Templates and static files are read through a fs.FS, AppConfig.TemplateFS
+// and AppConfig.StaticFS, by default the OSDir of TemplateDir and StaticDir.
+// An embed.FS, a zip archive (*zip.ReadCloser of zip.OpenReader) or an
+// Overlay can be used instead, to ship a single binary:
+//
+//	//go:embed templates
+//	var templates embed.FS
+//
+//	sub, _ := fs.Sub(templates, "templates")
+//	app.AppConfig.TemplateFS = xweb.NewOverlay(xweb.OSDir("theme"), sub)
+//
+// Changed files are reloaded only from OSDirs, the other filesystems are
+// read once.
+
+// OSDir is a directory of the operating system. Unlike os.DirFS it tells
+// where it is, so that its files can be watched.
+type OSDir string
+
+func (d OSDir) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+// Overlay looks for a file in its layers in order, the first layer which
+// has it wins. Directories list the files of all the layers.
+type Overlay struct {
+	Layers []fs.FS
+}
+
+func NewOverlay(layers ...fs.FS) *Overlay {
+	return &Overlay{Layers: layers}
+}
+
+func (o *Overlay) Open(name string) (fs.File, error) {
+	for _, layer := range o.Layers {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (o *Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	var found bool
+	seen := make(map[string]bool)
+	entries := make([]fs.DirEntry, 0)
+	for _, layer := range o.Layers {
+		list, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range list {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// osDirs returns the directories of fsys which can be watched.
+func osDirs(fsys fs.FS) []string {
+	dirs := make([]string, 0)
+	switch v := fsys.(type) {
+	case OSDir:
+		if dirExists(string(v)) {
+			dirs = append(dirs, string(v))
+		}
+	case *Overlay:
+		for _, layer := range v.Layers {
+			dirs = append(dirs, osDirs(layer)...)
+		}
+	}
+	return dirs
+}
+
+func isOSDir(fsys fs.FS, dir string) bool {
+	d, ok := fsys.(OSDir)
+	return ok && string(d) == dir
+}
+
+// fsPath turns a template name or an url into a path of a fs.FS.
+func fsPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+FixDirSeparator(name)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// relName returns the name of a watched file relative to its directory.
+func relName(dirs []string, file string) string {
+	for _, dir := range dirs {
+		if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			return FixDirSeparator(rel)
+		}
+	}
+	return ""
+}
+
+func (a *App) templateFS() fs.FS {
+	if a.AppConfig.TemplateFS != nil {
+		return a.AppConfig.TemplateFS
+	}
+	return OSDir(a.AppConfig.TemplateDir)
+}
+
+func (a *App) staticFS() fs.FS {
+	if a.AppConfig.StaticFS != nil {
+		return a.AppConfig.StaticFS
+	}
+	return OSDir(a.AppConfig.StaticDir)
+}
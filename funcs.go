@@ -0,0 +1,451 @@
+package xweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/coscms/xweb/lib/markdown"
+)
+
+// The helpers of DefaultFuncs which most pages need:
+//
+//	{{Truncate .Title 20}}              first 20 characters and "..."
+//	{{Substr .Name 0 1}}                by characters, not bytes
+//	{{FormatNumber 1234567.891}}        1,234,567.89
+//	{{FormatBytes .Size}}               1.5 MB
+//	{{FormatDuration .Elapsed}}         2h 5m
+//	{{TimeAgo .Created}}                3 minutes ago
+//	<script>var user = {{Json .User}};</script>
+//	{{template "card" Dict "title" .Title "items" (List 1 2 3)}}
+//	{{Pagination .Page .Total 20 "/posts?page={page}"}}
+//	{{.Nickname | Default "anonymous"}}
+//	{{Markdown .Comment}}  {{Nl2br .Address}}
+
+// Truncate cuts s to length characters, adding the suffix, "..." by
+// default, when it is cut.
+func Truncate(s string, length int, suffix ...string) string {
+	if length < 0 || utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	end := "..."
+	if len(suffix) > 0 {
+		end = suffix[0]
+	}
+	return string([]rune(s)[:length]) + end
+}
+
+// Substr returns length characters of s from start. A negative start
+// counts from the end, a negative length takes the rest.
+func Substr(s string, start int, length ...int) string {
+	runes := []rune(s)
+	if start < 0 {
+		start += len(runes)
+		if start < 0 {
+			start = 0
+		}
+	}
+	if start >= len(runes) {
+		return ""
+	}
+	end := len(runes)
+	if len(length) > 0 && length[0] >= 0 && start+length[0] < end {
+		end = start + length[0]
+	}
+	return string(runes[start:end])
+}
+
+// Replace replaces all the old in s by new.
+func Replace(s, old, new string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// Title puts the first letter of every word in upper case.
+func Title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		start := !unicode.IsLetter(prev) && !unicode.IsDigit(prev) && prev != '\''
+		prev = r
+		if start {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+// toFloat converts the numbers, and the strings of numbers, of templates.
+func toFloat(v interface{}) (float64, bool) {
+	if d, ok := v.(time.Duration); ok {
+		return float64(d), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isFloat(v interface{}) bool {
+	k := reflect.ValueOf(v).Kind()
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+// FormatNumber writes a number with thousands separators. The decimals
+// default to 0 for integers and 2 for floats.
+func FormatNumber(v interface{}, decimals ...int) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	prec := 0
+	if len(decimals) > 0 {
+		prec = decimals[0]
+	} else if isFloat(v) {
+		prec = 2
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', prec, 64)
+	intPart, frac := s, ""
+	if pos := strings.IndexByte(s, '.'); pos >= 0 {
+		intPart, frac = s[:pos], s[pos:]
+	}
+	var buf bytes.Buffer
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		buf.WriteByte('-')
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteRune(c)
+	}
+	buf.WriteString(frac)
+	return buf.String()
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB", "PB", "EB"}
+
+// FormatBytes writes a size in bytes with the unit which fits, by powers of
+// 1024: 1536 is 1.5 KB.
+func FormatBytes(v interface{}) string {
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	sign := ""
+	if f < 0 {
+		sign, f = "-", -f
+	}
+	unit := 0
+	for f >= 1024 && unit < len(byteUnits)-1 {
+		f /= 1024
+		unit++
+	}
+	s := strconv.FormatFloat(f, 'f', 1, 64)
+	if unit == 0 || strings.HasSuffix(s, ".0") {
+		s = strconv.FormatFloat(f, 'f', 0, 64)
+	}
+	return sign + s + " " + byteUnits[unit]
+}
+
+// FormatDuration writes a time.Duration, or a number of seconds, with its
+// two largest units: 2d 3h, 5m 12s, 250ms.
+func FormatDuration(v interface{}) string {
+	var d time.Duration
+	switch t := v.(type) {
+	case time.Duration:
+		d = t
+	default:
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Sprint(v)
+		}
+		d = time.Duration(f * float64(time.Second))
+	}
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	if d < time.Second {
+		if d < time.Millisecond {
+			return sign + d.String()
+		}
+		return sign + strconv.FormatInt(int64(d/time.Millisecond), 10) + "ms"
+	}
+	units := []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+	for i, u := range units {
+		n := d / u.size
+		if n == 0 {
+			continue
+		}
+		s := strconv.FormatInt(int64(n), 10) + u.name
+		if i+1 < len(units) {
+			next := units[i+1]
+			if m := (d - n*u.size) / next.size; m > 0 {
+				s += " " + strconv.FormatInt(int64(m), 10) + next.name
+			}
+		}
+		return sign + s
+	}
+	return sign + d.String()
+}
+
+// TimeAgo writes how long ago t was, "3 minutes ago", or "in 2 days" for
+// the future.
+func TimeAgo(t time.Time) string {
+	return timeAgo(t, time.Now())
+}
+
+func timeAgo(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < 45*time.Second {
+		return "just now"
+	}
+	var n int64
+	var unit string
+	switch {
+	case d < 45*time.Minute:
+		n, unit = int64(math.Max(1, math.Round(d.Minutes()))), "minute"
+	case d < 22*time.Hour:
+		n, unit = int64(math.Round(d.Hours())), "hour"
+	case d < 26*24*time.Hour:
+		n, unit = int64(math.Round(d.Hours()/24)), "day"
+	case d < 320*24*time.Hour:
+		n, unit = int64(math.Max(1, math.Round(d.Hours()/24/30))), "month"
+	default:
+		n, unit = int64(math.Max(1, math.Round(d.Hours()/24/365))), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %v", n, unit)
+	}
+	return fmt.Sprintf("%d %v ago", n, unit)
+}
+
+// Json encodes v for a script. <, > and & are escaped, so the JSON can not
+// end the script element, in html/template it is not encoded again.
+func Json(v interface{}) (template.JS, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(b), nil
+}
+
+// Dict builds a map from key and value pairs, to pass many values to a
+// template.
+func Dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("Dict needs key and value pairs")
+	}
+	dict := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("Dict key %v is not a string", pairs[i])
+		}
+		dict[key] = pairs[i+1]
+	}
+	return dict, nil
+}
+
+func List(items ...interface{}) []interface{} {
+	return items
+}
+
+// isEmpty tells whether a value is nil, zero or of length zero.
+func isEmpty(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array, reflect.Chan:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// Default returns value, or def when value is empty:
+// {{.Name | Default "anonymous"}}.
+func Default(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+// Coalesce returns the first value which is not empty.
+func Coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Markdown converts markdown written by users to HTML, their HTML is
+// escaped and only safe links are kept, see lib/markdown.
+func Markdown(s string) template.HTML {
+	return template.HTML(markdown.ToHTML(s))
+}
+
+// Nl2br escapes s and turns its line breaks into <br>.
+func Nl2br(s string) template.HTML {
+	s = strings.Replace(strings.Replace(s, "\r\n", "\n", -1), "\r", "\n", -1)
+	return template.HTML(strings.Replace(html.EscapeString(s), "\n", "<br>\n", -1))
+}
+
+// Pager is the pagination of a list of total items, limit by page.
+type Pager struct {
+	Page  int //current page, from 1
+	Pages int //number of pages, PageSize of total and limit
+	Total int
+	Limit int
+	Url   string //url of the pages, {page} is replaced by the number
+}
+
+// PagerItem is a link of a pagination, Page is 0 for a gap.
+type PagerItem struct {
+	Page    int
+	Url     string
+	Current bool
+}
+
+// PagerWindow is how many pages around the current one a pagination shows.
+var PagerWindow = 2
+
+// Paginate returns the pagination of the page, for templates which render
+// it themselves. The url has {page} for the page number, else the page
+// parameter is added.
+func Paginate(page, total, limit int, url string) *Pager {
+	if limit <= 0 {
+		limit = 1
+	}
+	p := &Pager{Page: page, Total: total, Limit: limit, Url: url, Pages: PageSize(total, limit)}
+	if p.Page > p.Pages {
+		p.Page = p.Pages
+	}
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	return p
+}
+
+func (p *Pager) PageUrl(page int) string {
+	n := strconv.Itoa(page)
+	if strings.Contains(p.Url, "{page}") {
+		return strings.Replace(p.Url, "{page}", n, -1)
+	}
+	u, err := url.Parse(p.Url)
+	if err != nil {
+		return p.Url
+	}
+	query := u.Query()
+	query.Set("page", n)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (p *Pager) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p *Pager) HasNext() bool {
+	return p.Page < p.Pages
+}
+
+// Items are the first and last pages, the ones around the current page
+// and gaps between them.
+func (p *Pager) Items() []PagerItem {
+	items := make([]PagerItem, 0)
+	add := func(page int) {
+		if len(items) > 0 && items[len(items)-1].Page < page-1 {
+			items = append(items, PagerItem{})
+		}
+		items = append(items, PagerItem{page, p.PageUrl(page), page == p.Page})
+	}
+	if p.Pages < 1 {
+		return items
+	}
+	add(1)
+	// only the window is walked, not every page
+	first, last := p.Page-PagerWindow, p.Page+PagerWindow
+	if first < 2 {
+		first = 2
+	}
+	if last > p.Pages-1 {
+		last = p.Pages - 1
+	}
+	for page := first; page <= last; page++ {
+		add(page)
+	}
+	if p.Pages > 1 {
+		add(p.Pages)
+	}
+	return items
+}
+
+// HTML renders the pagination as a list of links, nothing for one page.
+func (p *Pager) HTML() template.HTML {
+	if p.Pages <= 1 {
+		return ""
+	}
+	var buf bytes.Buffer
+	link := func(page int, text, class string) {
+		fmt.Fprintf(&buf, `<li class="%v"><a href="%v">%v</a></li>`,
+			class, html.EscapeString(p.PageUrl(page)), text)
+	}
+	buf.WriteString(`<ul class="pagination">`)
+	if p.HasPrev() {
+		link(p.Page-1, "&laquo;", "prev")
+	}
+	for _, item := range p.Items() {
+		switch {
+		case item.Page == 0:
+			buf.WriteString(`<li class="gap"><span>&hellip;</span></li>`)
+		case item.Current:
+			fmt.Fprintf(&buf, `<li class="active"><span>%d</span></li>`, item.Page)
+		default:
+			link(item.Page, strconv.Itoa(item.Page), "page")
+		}
+	}
+	if p.HasNext() {
+		link(p.Page+1, "&raquo;", "next")
+	}
+	buf.WriteString(`</ul>`)
+	return template.HTML(buf.String())
+}
+
+// Pagination renders the links of the pages, see Paginate.
+func Pagination(page, total, limit int, url string) template.HTML {
+	return Paginate(page, total, limit, url).HTML()
+}
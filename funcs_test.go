@@ -0,0 +1,173 @@
+package xweb
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStringFuncs(t *testing.T) {
+	cases := []struct {
+		got, expected string
+	}{
+		{Truncate("你好世界，xweb", 4), "你好世界..."},
+		{Truncate("short", 10), "short"},
+		{Truncate("abcdef", 3, "…"), "abc…"},
+		{Substr("你好世界", 1, 2), "好世"},
+		{Substr("你好世界", -2), "世界"},
+		{Substr("你好世界", 3, 5), "界"},
+		{Substr("abc", 5, 1), ""},
+		{Replace("a-b-c", "-", "+"), "a+b+c"},
+		{Title("hello wORLD, o'neil x-ray"), "Hello WORLD, O'neil X-Ray"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, c.got)
+		}
+	}
+}
+
+func TestFormatFuncs(t *testing.T) {
+	cases := []struct {
+		got, expected string
+	}{
+		{FormatNumber(1234567), "1,234,567"},
+		{FormatNumber(-1234.5), "-1,234.50"},
+		{FormatNumber(999.999, 1), "1,000.0"},
+		{FormatNumber(uint8(12)), "12"},
+		{FormatNumber("1234"), "1,234"},
+		{FormatNumber(-0.001), "0.00"},
+		{FormatBytes(512), "512 B"},
+		{FormatBytes(1536), "1.5 KB"},
+		{FormatBytes(int64(5) << 30), "5 GB"},
+		{FormatDuration(90 * time.Minute), "1h 30m"},
+		{FormatDuration(26*time.Hour + 5*time.Minute), "1d 2h"},
+		{FormatDuration(2*time.Hour + 30*time.Second), "2h"},
+		{FormatDuration(250 * time.Millisecond), "250ms"},
+		{FormatDuration(75), "1m 15s"},
+		{FormatDuration(-3 * time.Second), "-3s"},
+		{FormatDuration(0), "0s"},
+	}
+	for _, c := range cases {
+		if c.got != c.expected {
+			t.Errorf("expected %q, got %q", c.expected, c.got)
+		}
+	}
+}
+
+func TestTimeAgo(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		ago      time.Duration
+		expected string
+	}{
+		{10 * time.Second, "just now"},
+		{50 * time.Second, "1 minute ago"},
+		{3 * time.Minute, "3 minutes ago"},
+		{-2 * time.Hour, "in 2 hours"},
+		{30 * time.Hour, "1 day ago"},
+		{60 * 24 * time.Hour, "2 months ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+	}
+	for _, c := range cases {
+		if got := timeAgo(now.Add(-c.ago), now); got != c.expected {
+			t.Errorf("%v: expected %q, got %q", c.ago, c.expected, got)
+		}
+	}
+}
+
+func TestDefaultAndCoalesce(t *testing.T) {
+	if v := Default("anonymous", ""); v != "anonymous" {
+		t.Errorf("an empty string should be replaced, got %v", v)
+	}
+	if v := Default("none", []int{}); v != "none" {
+		t.Errorf("an empty slice should be replaced, got %v", v)
+	}
+	if v := Default(1, 5); v != 5 {
+		t.Errorf("a value should be kept, got %v", v)
+	}
+	if v := Default(1, time.Time{}); v != 1 {
+		t.Errorf("a zero time should be replaced, got %v", v)
+	}
+	if v := Coalesce(nil, 0, "", "first", "second"); v != "first" {
+		t.Errorf("expected the first value which is not empty, got %v", v)
+	}
+	if v := Coalesce(nil, ""); v != nil {
+		t.Errorf("expected nil, got %v", v)
+	}
+}
+
+func TestDictAndList(t *testing.T) {
+	dict, err := Dict("a", 1, "b", List("x", "y"))
+	if err != nil || dict["a"] != 1 || len(dict["b"].([]interface{})) != 2 {
+		t.Errorf("unexpected dict %v, %v", dict, err)
+	}
+	if _, err := Dict("a"); err == nil {
+		t.Error("an odd number of arguments should fail")
+	}
+	if _, err := Dict(1, 2); err == nil {
+		t.Error("a key which is not a string should fail")
+	}
+}
+
+func TestPagination(t *testing.T) {
+	p := Paginate(6, 195, 20, "/posts?page={page}")
+	if p.Pages != 10 || !p.HasPrev() || !p.HasNext() {
+		t.Errorf("unexpected pager %+v", p)
+	}
+	pages := make([]string, 0)
+	for _, item := range p.Items() {
+		switch {
+		case item.Page == 0:
+			pages = append(pages, "…")
+		case item.Current:
+			pages = append(pages, "["+item.Url+"]")
+		default:
+			pages = append(pages, strings.TrimPrefix(item.Url, "/posts?page="))
+		}
+	}
+	if got := strings.Join(pages, " "); got != "1 … 4 5 [/posts?page=6] 7 8 … 10" {
+		t.Errorf("unexpected pages %v", got)
+	}
+	if u := Paginate(1, 50, 20, "/search?q=a+b").PageUrl(2); u != "/search?page=2&q=a+b" {
+		t.Errorf("the page parameter should be added, got %v", u)
+	}
+	if p := Paginate(9, 30, 20, "/"); p.Page != 2 || p.HasNext() {
+		t.Errorf("the page should be the last one, got %+v", p)
+	}
+	if items := Paginate(1, 1<<40, 1, "/").Items(); len(items) != 5 || items[4].Page != 1<<40 {
+		t.Errorf("only the window should be listed, got %+v", items)
+	}
+	if html := Pagination(1, 10, 20, "/"); html != "" {
+		t.Errorf("a single page should have no pagination, got %v", html)
+	}
+	expected := `<ul class="pagination"><li class="active"><span>1</span></li>` +
+		`<li class="page"><a href="/?a=1&amp;page=2">2</a></li>` +
+		`<li class="next"><a href="/?a=1&amp;page=2">&raquo;</a></li></ul>`
+	if html := Pagination(1, 30, 20, "/?a=1"); string(html) != expected {
+		t.Errorf("unexpected pagination %v", html)
+	}
+}
+
+func TestHtmlFuncs(t *testing.T) {
+	tmpl := template.Must(template.New("page").Funcs(DefaultFuncs).Parse(
+		`<script>var user = {{Json .User}};</script>` +
+			`<p>{{Nl2br .Address}}</p>{{Markdown .Comment}}`))
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, map[string]interface{}{
+		"User":    map[string]string{"name": "</script><b>"},
+		"Address": "1 <Main> St\r\nSpringfield",
+		"Comment": "**hi** <img src=x onerror=alert(1)>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<script>var user = {"name":"\u003c/script\u003e\u003cb\u003e"};</script>` +
+		"<p>1 &lt;Main&gt; St<br>\nSpringfield</p>" +
+		"<p><strong>hi</strong> &lt;img src=x onerror=alert(1)&gt;</p>\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected page\n got %q\nwant %q", buf.String(), expected)
+	}
+}
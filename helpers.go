@@ -140,10 +140,60 @@ func Slug(s string, sep string) string {
 	return strings.ToLower(slug)
 }
 
+// CookieOptions are the attributes of a cookie. MaxAge is in seconds,
+// zero makes the cookie permanent and a negative value deletes it.
+type CookieOptions struct {
+	MaxAge      int64
+	Path        string
+	Domain      string
+	Secure      bool
+	HttpOnly    bool
+	SameSite    http.SameSite
+	Partitioned bool
+}
+
+func (o *CookieOptions) Cookie(name string, value string) *http.Cookie {
+	cookie := &http.Cookie{Name: name, Value: value, Unparsed: make([]string, 0)}
+	o.Apply(cookie)
+	return cookie
+}
+
+// Apply sets the attributes of the cookie from the options.
+func (o *CookieOptions) Apply(cookie *http.Cookie) {
+	if o.MaxAge == 0 {
+		// 2^31 - 1 seconds (roughly 2038)
+		cookie.Expires = time.Unix(2147483647, 0)
+		cookie.MaxAge = 0
+	} else {
+		cookie.Expires = time.Unix(time.Now().Unix()+o.MaxAge, 0)
+		if o.MaxAge < 0 {
+			cookie.MaxAge = -1
+		} else {
+			cookie.MaxAge = int(o.MaxAge)
+		}
+	}
+	cookie.Path = o.Path
+	cookie.Domain = o.Domain
+	cookie.Secure = o.Secure
+	cookie.HttpOnly = o.HttpOnly
+	cookie.SameSite = o.SameSite
+	cookie.Partitioned = o.Partitioned
+}
+
 // NewCookie is a helper method that returns a new http.Cookie object.
 // Duration is specified in seconds. If the duration is zero, the cookie is permanent.
+// The arguments are either a CookieOptions or the positional
+// maxAge, path, domain, secure and httpOnly.
 // This can be used in conjunction with ctx.SetCookie.
 func NewCookie(name string, value string, args ...interface{}) *http.Cookie {
+	if len(args) > 0 {
+		switch o := args[0].(type) {
+		case *CookieOptions:
+			return o.Cookie(name, value)
+		case CookieOptions:
+			return o.Cookie(name, value)
+		}
+	}
 	var (
 		alen     int = len(args)
 		utctime  time.Time
@@ -0,0 +1,365 @@
+package httpsession
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coscms/xweb/lib/str"
+)
+
+const fileStoreExt = ".session"
+
+// fileNode is what a session file holds, the time of the last access is
+// the modification time of the file.
+type fileNode struct {
+	Id      Id
+	Kvs     map[string]interface{}
+	Version uint64
+}
+
+// FileStore keeps every session in a file of its own under Dir, so the
+// sessions survive a restart. Values are gob encoded, register the types
+// of your own values with gob.Register. Writes take a lock file next to
+// the session file, so that several processes can share Dir.
+type FileStore struct {
+	Dir        string
+	GcInterval time.Duration
+	Debug      bool
+	lock       sync.RWMutex
+	maxAge     time.Duration
+	onExpired  ExpiredFunc
+}
+
+func NewFileStore(dir string, maxAge time.Duration) *FileStore {
+	return &FileStore{Dir: dir, maxAge: maxAge, GcInterval: 10 * time.Second}
+}
+
+var (
+	_ CASStore    = NewFileStore("", 30)
+	_ Iterable    = NewFileStore("", 30)
+	_ Counter     = NewFileStore("", 30)
+	_ Snapshotter = NewFileStore("", 30)
+)
+
+// file returns the name of the session file, ids come from the client so
+// they are never used as a file name themselves.
+func (store *FileStore) file(id Id) string {
+	return filepath.Join(store.Dir, str.Md5(string(id))+fileStoreExt)
+}
+
+const (
+	fileLockRetries = 1000
+	fileLockStale   = 10 * time.Second
+)
+
+// lockFile takes the lock file of a session. A lock which is older than
+// fileLockStale was left behind by a crashed process and is taken over.
+func (store *FileStore) lockFile(id Id) (unlock func(), err error) {
+	name := strings.TrimSuffix(store.file(id), fileStoreExt) + ".lock"
+	for i := 0; ; i++ {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(name); err == nil && time.Since(fi.ModTime()) > fileLockStale {
+			os.Remove(name)
+			continue
+		}
+		if i >= fileLockRetries {
+			return nil, ErrConflict
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (store *FileStore) isExpired(last time.Time) bool {
+	return store.maxAge > 0 && time.Now().Sub(last) > store.maxAge
+}
+
+func (store *FileStore) read(file string) (*fileNode, time.Time, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	node := &fileNode{}
+	if err = gob.NewDecoder(f).Decode(node); err != nil {
+		return nil, time.Time{}, err
+	}
+	if node.Kvs == nil {
+		node.Kvs = make(map[string]interface{})
+	}
+	return node, fi.ModTime(), nil
+}
+
+// write replaces the file at once, readers never see half of it.
+func (store *FileStore) write(node *fileNode) bool {
+	f, err := ioutil.TempFile(store.Dir, "tmp")
+	if err == nil {
+		err = gob.NewEncoder(f).Encode(node)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), store.file(node.Id))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		if store.Debug {
+			log.Println("[FileStore]PutErr: ", err, "Id:", node.Id)
+		}
+		return false
+	}
+	return true
+}
+
+// load returns the session node, nil if there is none. A session which
+// expired is removed and returned as expired, the caller tells the
+// listener once it has released the lock.
+func (store *FileStore) load(id Id) (node *fileNode, expired *fileNode) {
+	file := store.file(id)
+	node, last, err := store.read(file)
+	if err != nil {
+		if store.Debug && !os.IsNotExist(err) {
+			log.Println("[FileStore]GetErr: ", err, "Id:", id)
+		}
+		return nil, nil
+	}
+	if store.isExpired(last) {
+		if os.Remove(file) == nil {
+			return nil, node
+		}
+		return nil, nil
+	}
+	return node, nil
+}
+
+func (store *FileStore) expired(nodes ...*fileNode) {
+	store.lock.RLock()
+	fn := store.onExpired
+	store.lock.RUnlock()
+	if fn == nil {
+		return
+	}
+	for _, node := range nodes {
+		if node != nil {
+			fn(node.Id, node.Kvs)
+		}
+	}
+}
+
+func (store *FileStore) SetMaxAge(maxAge time.Duration) {
+	store.lock.Lock()
+	store.maxAge = maxAge
+	store.lock.Unlock()
+}
+
+func (store *FileStore) Get(id Id, key string) interface{} {
+	store.lock.RLock()
+	node, expired := store.load(id)
+	store.lock.RUnlock()
+	if node == nil {
+		store.expired(expired)
+		return nil
+	}
+	now := time.Now()
+	os.Chtimes(store.file(id), now, now)
+	return node.Kvs[key]
+}
+
+func (store *FileStore) Snapshot(id Id) map[string]interface{} {
+	store.lock.RLock()
+	node, expired := store.load(id)
+	store.lock.RUnlock()
+	if node == nil {
+		store.expired(expired)
+		return nil
+	}
+	return node.Kvs
+}
+
+func (store *FileStore) Load(id Id) (map[string]interface{}, uint64, error) {
+	store.lock.RLock()
+	node, expired := store.load(id)
+	store.lock.RUnlock()
+	store.expired(expired)
+	if node == nil {
+		return make(map[string]interface{}), 0, nil
+	}
+	return node.Kvs, node.Version, nil
+}
+
+func (store *FileStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	return store.swap(id, func(current uint64) (*fileNode, error) {
+		if current != version {
+			return nil, ErrConflict
+		}
+		return &fileNode{Id: id, Kvs: kvs}, nil
+	})
+}
+
+// swap writes the node made by fn under the lock file of the session,
+// with the next version.
+func (store *FileStore) swap(id Id, fn func(version uint64) (*fileNode, error)) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	unlock, err := store.lockFile(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	var version uint64
+	if node, _, err := store.read(store.file(id)); err == nil {
+		version = node.Version
+	}
+	node, err := fn(version)
+	if err != nil {
+		return err
+	}
+	node.Version = version + 1
+	if !store.write(node) {
+		return errors.New("session file could not be written")
+	}
+	return nil
+}
+
+func (store *FileStore) Set(id Id, key string, value interface{}) {
+	err := update(store, id, ConflictRetry, DefaultMaxRetries, func(kvs map[string]interface{}) {
+		kvs[key] = value
+	})
+	if err != nil && store.Debug {
+		log.Println("[FileStore]SetErr: ", err, "Id:", id)
+	}
+}
+
+func (store *FileStore) Add(id Id) {
+	store.swap(id, func(uint64) (*fileNode, error) {
+		return &fileNode{Id: id, Kvs: make(map[string]interface{})}, nil
+	})
+}
+
+func (store *FileStore) Del(id Id, key string) bool {
+	if !store.Exist(id) {
+		return true
+	}
+	err := update(store, id, ConflictRetry, DefaultMaxRetries, func(kvs map[string]interface{}) {
+		delete(kvs, key)
+	})
+	if err != nil && store.Debug {
+		log.Println("[FileStore]DelErr: ", err, "Id:", id)
+	}
+	return err == nil
+}
+
+func (store *FileStore) Exist(id Id) bool {
+	fi, err := os.Stat(store.file(id))
+	return err == nil && !store.isExpired(fi.ModTime())
+}
+
+func (store *FileStore) Clear(id Id) bool {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	err := os.Remove(store.file(id))
+	return err == nil || os.IsNotExist(err)
+}
+
+func (store *FileStore) files() []os.FileInfo {
+	infos, err := ioutil.ReadDir(store.Dir)
+	if err != nil {
+		if store.Debug {
+			log.Println("[FileStore]ReadDirErr: ", err)
+		}
+		return nil
+	}
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), fileStoreExt) {
+			files = append(files, fi)
+		}
+	}
+	return files
+}
+
+// Range visits the sessions which have not expired.
+func (store *FileStore) Range(fn func(info *SessionInfo) bool) {
+	for _, fi := range store.files() {
+		if store.isExpired(fi.ModTime()) {
+			continue
+		}
+		store.lock.RLock()
+		node, last, err := store.read(filepath.Join(store.Dir, fi.Name()))
+		store.lock.RUnlock()
+		if err != nil {
+			continue
+		}
+		if !fn(&SessionInfo{Id: node.Id, Values: node.Kvs, Last: last}) {
+			return
+		}
+	}
+}
+
+func (store *FileStore) Count() int {
+	var n int
+	for _, fi := range store.files() {
+		if !store.isExpired(fi.ModTime()) {
+			n++
+		}
+	}
+	return n
+}
+
+func (store *FileStore) OnExpired(fn ExpiredFunc) error {
+	store.lock.Lock()
+	store.onExpired = fn
+	store.lock.Unlock()
+	return nil
+}
+
+func (store *FileStore) Run() error {
+	if err := os.MkdirAll(store.Dir, 0700); err != nil {
+		return err
+	}
+	time.AfterFunc(store.GcInterval, func() {
+		store.GC()
+		store.Run()
+	})
+	return nil
+}
+
+// GC removes the expired session files.
+func (store *FileStore) GC() {
+	store.lock.Lock()
+	expired := make([]*fileNode, 0)
+	for _, fi := range store.files() {
+		if !store.isExpired(fi.ModTime()) {
+			continue
+		}
+		file := filepath.Join(store.Dir, fi.Name())
+		node, _, err := store.read(file)
+		if os.Remove(file) == nil && err == nil {
+			expired = append(expired, node)
+		}
+	}
+	store.lock.Unlock()
+
+	// notify outside of the lock, listeners may use the store
+	store.expired(expired...)
+}
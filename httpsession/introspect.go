@@ -0,0 +1,144 @@
+package httpsession
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNotSupported = errors.New("the session store does not support this operation")
+
+type SessionInfo struct {
+	Id     Id
+	Values map[string]interface{}
+	Last   time.Time
+}
+
+// Iterable is implemented by stores which can enumerate the active sessions.
+type Iterable interface {
+	// Range calls fn for every active session until fn returns false.
+	Range(fn func(info *SessionInfo) bool)
+}
+
+// Counter is implemented by stores which can count the active sessions.
+type Counter interface {
+	Count() int
+}
+
+// Indexed is implemented by stores which can find sessions by the value
+// of one of their keys, such as the user id of a login.
+type Indexed interface {
+	Lookup(key string, value interface{}) []Id
+}
+
+// Snapshotter is implemented by stores which can read all the values of
+// one session at once. Snapshot returns nil if the session does not exist.
+type Snapshotter interface {
+	Snapshot(id Id) map[string]interface{}
+}
+
+// snapshot returns a copy of the values of the session.
+func (manager *Manager) snapshot(id Id) (map[string]interface{}, error) {
+	switch store := manager.baseStore().(type) {
+	case Snapshotter:
+		return store.Snapshot(id), nil
+	case CASStore:
+		kvs, _, err := store.Load(id)
+		return kvs, err
+	case Iterable:
+		var kvs map[string]interface{}
+		store.Range(func(info *SessionInfo) bool {
+			if info.Id == id {
+				kvs = info.Values
+				return false
+			}
+			return true
+		})
+		return kvs, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// valueEqual compares session values the way the Eq template function does,
+// so an int64 user id matches the string taken from a form.
+func valueEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+// baseStore returns the store below an OptimisticStore.
+func (manager *Manager) baseStore() Store {
+	if store, ok := manager.store.(*OptimisticStore); ok {
+		return store.CASStore
+	}
+	return manager.store
+}
+
+func (manager *Manager) Count() (int, error) {
+	switch store := manager.baseStore().(type) {
+	case Counter:
+		return store.Count(), nil
+	case Iterable:
+		var n int
+		store.Range(func(*SessionInfo) bool {
+			n++
+			return true
+		})
+		return n, nil
+	}
+	return 0, ErrNotSupported
+}
+
+func (manager *Manager) Range(fn func(info *SessionInfo) bool) error {
+	store, ok := manager.baseStore().(Iterable)
+	if !ok {
+		return ErrNotSupported
+	}
+	store.Range(fn)
+	return nil
+}
+
+func (manager *Manager) Lookup(key string, value interface{}) ([]Id, error) {
+	switch store := manager.baseStore().(type) {
+	case Indexed:
+		return store.Lookup(key, value), nil
+	case Iterable:
+		ids := make([]Id, 0)
+		store.Range(func(info *SessionInfo) bool {
+			if valueEqual(info.Values[key], value) {
+				ids = append(ids, info.Id)
+			}
+			return true
+		})
+		return ids, nil
+	}
+	return nil, ErrNotSupported
+}
+
+// Revoke removes the sessions, BeforeReleaseListeners are told as on Invalidate.
+func (manager *Manager) Revoke(ids ...Id) int {
+	var n int
+	for _, id := range ids {
+		if !manager.store.Exist(id) {
+			continue
+		}
+		manager.beforeReleased(NewSession(id, manager.maxAge, manager))
+		if manager.store.Clear(id) {
+			n++
+		}
+	}
+	return n
+}
+
+// RevokeBy removes every session whose key has the given value, e.g. to log
+// a user out on all devices. Each one goes through Revoke, so listeners
+// such as an online counter are told.
+func (manager *Manager) RevokeBy(key string, value interface{}) (int, error) {
+	ids, err := manager.Lookup(key, value)
+	if err != nil {
+		return 0, err
+	}
+	return manager.Revoke(ids...), nil
+}
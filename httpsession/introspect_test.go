@@ -0,0 +1,143 @@
+package httpsession
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestManagerIntrospection(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	manager := NewManager(NewOptimisticStore(store, ConflictRetry),
+		NewSha1Generator("test"), NewCookieTransfer("test", 0, false, "/"))
+	for id, user := range map[Id]int64{"a": 1, "b": 1, "c": 2} {
+		store.Add(id)
+		store.Set(id, "user", user)
+	}
+
+	if n, err := manager.Count(); err != nil || n != 3 {
+		t.Fatalf("expected 3 sessions, got %v %v", n, err)
+	}
+	ids, err := manager.Lookup("user", "1")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("expected 2 sessions of user 1, got %v %v", ids, err)
+	}
+	if n, _ := manager.RevokeBy("user", 1); n != 2 {
+		t.Errorf("expected 2 revoked, got %v", n)
+	}
+	if store.Exist(Id("a")) || !store.Exist(Id("c")) {
+		t.Error("only the sessions of user 1 should be revoked")
+	}
+	if n := manager.Revoke(Id("c"), Id("missing")); n != 1 {
+		t.Errorf("expected 1 revoked, got %v", n)
+	}
+}
+
+// releaseCounter counts the sessions the manager releases
+type releaseCounter struct {
+	expiredCounter
+	released int
+}
+
+func (c *releaseCounter) OnBeforeRelease(*Session) {
+	c.released++
+}
+
+const testMaxAge = 200 * time.Millisecond
+
+// testStore runs the same checks on every store with introspection, the
+// store expires sessions after testMaxAge
+func testStore(t *testing.T, store Store) {
+	manager := NewManager(store, NewSha1Generator("test"), NewCookieTransfer("test", 0, false, "/"))
+	counter := &releaseCounter{}
+	if err := manager.AddListener(counter); err != nil {
+		t.Fatal(err)
+	}
+	for id, user := range map[Id]int64{"a": 1, "b": 1, "c": 2} {
+		store.Add(id)
+		store.Set(id, "user", user)
+	}
+	store.Set(Id("c"), "name", "carol")
+	store.Del(Id("c"), "name")
+	if v := store.Get(Id("a"), "user"); v != int64(1) {
+		t.Errorf("expected user 1, got %#v", v)
+	}
+	if store.Get(Id("c"), "name") != nil || !store.Exist(Id("c")) || store.Exist(Id("missing")) {
+		t.Error("unexpected values after Del")
+	}
+
+	if n, err := manager.Count(); err != nil || n != 3 {
+		t.Fatalf("expected 3 sessions, got %v %v", n, err)
+	}
+	ids, err := manager.Lookup("user", "1")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("expected 2 sessions of user 1, got %v %v", ids, err)
+	}
+	if n, _ := manager.RevokeBy("user", 1); n != 2 || counter.released != 2 {
+		t.Errorf("expected 2 revoked and released, got %v %v", n, counter.released)
+	}
+	if store.Exist(Id("a")) || !store.Exist(Id("c")) {
+		t.Error("only the sessions of user 1 should be revoked")
+	}
+
+	store.Add(Id("d"))
+	store.Set(Id("d"), "cart", "3 books")
+	rw := httptest.NewRecorder()
+	session, err := manager.Regenerate(httptest.NewRequest("GET", "/", nil), rw, NewSession(Id("d"), 0, manager))
+	if err != nil || session.Id() == Id("d") || store.Exist(Id("d")) {
+		t.Fatalf("the session should move to a new id, got %v %v", session, err)
+	}
+	if v := store.Get(session.Id(), "cart"); v != "3 books" || counter.released != 3 {
+		t.Errorf("the values should be moved and the old id released, got %#v %v", v, counter.released)
+	}
+	if cookies := rw.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != string(session.Id()) {
+		t.Errorf("the new id should be sent, got %v", cookies)
+	}
+	manager.Revoke(session.Id())
+
+	time.Sleep(testMaxAge + 50*time.Millisecond)
+	if n, _ := manager.Count(); n != 0 || store.Exist(Id("c")) {
+		t.Errorf("the session should have expired, got %v", n)
+	}
+	if gc, ok := store.(interface {
+		GC()
+	}); ok {
+		gc.GC()
+	}
+	if len(counter.ids) != 1 || counter.ids[0] != "c" || counter.users[0] != int64(2) {
+		t.Errorf("the expired session should be reported, got %v %v", counter.ids, counter.users)
+	}
+}
+
+func TestStoreIntrospection(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testStore(t, NewMemoryStore(testMaxAge))
+	})
+	t.Run("file", func(t *testing.T) {
+		testStore(t, NewFileStore(t.TempDir(), testMaxAge))
+	})
+	t.Run("sql", func(t *testing.T) {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "session.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		store, err := NewSQLStore(db, "", testMaxAge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStore(t, store)
+	})
+}
+
+func TestIntrospectionNotSupported(t *testing.T) {
+	manager := NewManager(NewMemcacheStore(time.Minute, []string{}),
+		NewSha1Generator("test"), NewCookieTransfer("test", 0, false, "/"))
+	if _, err := manager.Count(); err != ErrNotSupported {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
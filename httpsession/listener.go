@@ -10,25 +10,56 @@ type BeforeReleaseListener interface {
 	OnBeforeRelease(*Session)
 }
 
+// OnExpiredListener is told about sessions the store removed because they
+// expired. It gets the values the session had at that time.
+type OnExpiredListener interface {
+	OnExpired(id Id, kvs map[string]interface{})
+}
+
+// AddListener registers listener for every listener interface it implements.
+// Adding an OnExpiredListener fails with ErrExpiryNotObservable if the store
+// can not see sessions expire, the listener is then not registered at all.
 func (manager *Manager) AddListener(listener interface{}) error {
-	switch listener.(type) {
-	case AfterCreatedListener:
-		manager.afterCreatedListeners[listener.(AfterCreatedListener)] = true
-	case BeforeReleaseListener:
-		manager.beforeReleaseListeners[listener.(BeforeReleaseListener)] = true
-	default:
+	created, isCreated := listener.(AfterCreatedListener)
+	release, isRelease := listener.(BeforeReleaseListener)
+	expired, isExpired := listener.(OnExpiredListener)
+	if !isCreated && !isRelease && !isExpired {
 		return errors.New("Unknow listener type")
 	}
+	if isExpired && manager.expiryErr != nil {
+		return manager.expiryErr
+	}
+	if isCreated {
+		manager.afterCreatedListeners[created] = true
+	}
+	if isRelease {
+		manager.beforeReleaseListeners[release] = true
+	}
+	if isExpired {
+		manager.listenerLock.Lock()
+		manager.expiredListeners[expired] = true
+		manager.listenerLock.Unlock()
+	}
 	return nil
 }
 
 func (manager *Manager) RemoveListener(listener interface{}) error {
-	switch listener.(type) {
-	case AfterCreatedListener:
-		delete(manager.afterCreatedListeners, listener.(AfterCreatedListener))
-	case BeforeReleaseListener:
-		delete(manager.beforeReleaseListeners, listener.(BeforeReleaseListener))
-	default:
+	var known bool
+	if l, ok := listener.(AfterCreatedListener); ok {
+		delete(manager.afterCreatedListeners, l)
+		known = true
+	}
+	if l, ok := listener.(BeforeReleaseListener); ok {
+		delete(manager.beforeReleaseListeners, l)
+		known = true
+	}
+	if l, ok := listener.(OnExpiredListener); ok {
+		manager.listenerLock.Lock()
+		delete(manager.expiredListeners, l)
+		manager.listenerLock.Unlock()
+		known = true
+	}
+	if !known {
 		return errors.New("Unknow listener type")
 	}
 	return nil
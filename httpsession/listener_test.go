@@ -0,0 +1,70 @@
+package httpsession
+
+import (
+	"testing"
+	"time"
+)
+
+type expiredCounter struct {
+	ids   []Id
+	users []interface{}
+}
+
+func (c *expiredCounter) OnExpired(id Id, kvs map[string]interface{}) {
+	c.ids = append(c.ids, id)
+	if user, ok := kvs["user"]; ok {
+		c.users = append(c.users, user)
+	}
+}
+
+func TestOnExpiredListener(t *testing.T) {
+	store := NewMemoryStore(time.Millisecond)
+	manager := NewManager(store, NewSha1Generator("test"), NewCookieTransfer("test", 0, false, "/"))
+	counter := &expiredCounter{}
+	if err := manager.AddListener(counter); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Add(Id("gc"))
+	store.Set(Id("gc"), "user", "alice")
+	store.Add(Id("lazy"))
+	time.Sleep(5 * time.Millisecond)
+
+	store.GC()
+	if len(counter.users) != 1 || counter.users[0] != "alice" {
+		t.Fatalf("GC should report the expired session, got %v", counter.ids)
+	}
+	if store.Get(Id("lazy"), "user") != nil {
+		t.Error("expired session should be empty")
+	}
+	if len(counter.ids) != 2 {
+		t.Errorf("both sessions should be reported once, got %v", counter.ids)
+	}
+}
+
+func TestExpiryNotObservable(t *testing.T) {
+	manager := NewManager(NewMemcacheStore(time.Minute, []string{}),
+		NewSha1Generator("test"), NewCookieTransfer("test", 0, false, "/"))
+	if manager.ExpiryObservable() {
+		t.Error("memcache can not observe expiry")
+	}
+	if err := manager.AddListener(&expiredCounter{}); err != ErrExpiryNotObservable {
+		t.Errorf("expected ErrExpiryNotObservable, got %v", err)
+	}
+	listener := &onlineCounter{}
+	if err := manager.AddListener(listener); err != ErrExpiryNotObservable {
+		t.Errorf("expected ErrExpiryNotObservable, got %v", err)
+	}
+	if len(manager.afterCreatedListeners) != 0 || len(manager.beforeReleaseListeners) != 0 {
+		t.Error("a listener which can not be added should not be registered in part")
+	}
+}
+
+// onlineCounter implements all the listener interfaces
+type onlineCounter struct {
+	expiredCounter
+}
+
+func (c *onlineCounter) OnAfterCreated(*Session) {}
+
+func (c *onlineCounter) OnBeforeRelease(*Session) {}
@@ -18,7 +18,10 @@ type Manager struct {
 	transfer               Transfer
 	beforeReleaseListeners map[BeforeReleaseListener]bool
 	afterCreatedListeners  map[AfterCreatedListener]bool
+	expiredListeners       map[OnExpiredListener]bool
+	expiryErr              error
 	lock                   sync.Mutex
+	listenerLock           sync.RWMutex
 }
 
 func Default() *Manager {
@@ -26,15 +29,25 @@ func Default() *Manager {
 	key := string(GenRandKey(16))
 	return NewManager(store,
 		NewSha1Generator(key),
-		NewCookieTransfer("SESSIONID", DefaultMaxAge, false, "/"))
+		NewCookieTransfer(DefaultSessionName, DefaultMaxAge, false, "/"))
 }
 
 func NewManager(store Store, gen IdGenerator, transfer Transfer) *Manager {
-	return &Manager{
-		store:     store,
-		generator: gen,
-		transfer:  transfer,
+	manager := &Manager{
+		store:                  store,
+		generator:              gen,
+		transfer:               transfer,
+		beforeReleaseListeners: make(map[BeforeReleaseListener]bool),
+		afterCreatedListeners:  make(map[AfterCreatedListener]bool),
+		expiredListeners:       make(map[OnExpiredListener]bool),
 	}
+	manager.expiryErr = store.OnExpired(manager.expired)
+	return manager
+}
+
+// ExpiryObservable reports whether OnExpiredListeners will ever be called.
+func (manager *Manager) ExpiryObservable() bool {
+	return manager.expiryErr == nil
 }
 
 func (manager *Manager) SetMaxAge(maxAge time.Duration) {
@@ -43,6 +56,21 @@ func (manager *Manager) SetMaxAge(maxAge time.Duration) {
 	manager.store.SetMaxAge(maxAge)
 }
 
+func (manager *Manager) SetTransfer(transfer Transfer) {
+	if manager.maxAge > 0 {
+		transfer.SetMaxAge(manager.maxAge)
+	}
+	manager.transfer = transfer
+}
+
+func (manager *Manager) Store() Store {
+	return manager.store
+}
+
+func (manager *Manager) Transfer() Transfer {
+	return manager.transfer
+}
+
 func (manager *Manager) Session(req *http.Request, rw http.ResponseWriter) *Session {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
@@ -67,6 +95,52 @@ func (manager *Manager) Session(req *http.Request, rw http.ResponseWriter) *Sess
 	return NewSession(id, manager.maxAge, manager)
 }
 
+// Regenerate moves the values of the session to a new id, removes the old
+// one and sends the new id to the client. Call it when the session gains
+// privileges, e.g. on login, so that an id which was planted or seen before
+// is worth nothing. Listeners are told as if the old session was released
+// and the new one created.
+func (manager *Manager) Regenerate(req *http.Request, rw http.ResponseWriter, session *Session) (*Session, error) {
+	kvs, err := manager.snapshot(session.id)
+	if err != nil {
+		return nil, err
+	}
+
+	manager.lock.Lock()
+	id := manager.generator.Gen(req)
+	manager.store.Add(id)
+	for key, value := range kvs {
+		manager.store.Set(id, key, value)
+	}
+	manager.transfer.Set(req, rw, id)
+	manager.lock.Unlock()
+
+	manager.beforeReleased(session)
+	manager.store.Clear(session.id)
+	regenerated := NewSession(id, manager.maxAge, manager)
+	manager.afterCreated(regenerated)
+	return regenerated, nil
+}
+
+// Restart removes the session and starts an empty one with a new id, e.g.
+// on logout, so that neither the old id nor any of its values is left.
+// Unlike Invalidate it leaves the request a session to use, without one
+// the id still carried by the request would come back on the next write.
+func (manager *Manager) Restart(req *http.Request, rw http.ResponseWriter, session *Session) *Session {
+	manager.beforeReleased(session)
+	manager.store.Clear(session.id)
+
+	manager.lock.Lock()
+	id := manager.generator.Gen(req)
+	manager.store.Add(id)
+	manager.transfer.Set(req, rw, id)
+	manager.lock.Unlock()
+
+	restarted := NewSession(id, manager.maxAge, manager)
+	manager.afterCreated(restarted)
+	return restarted
+}
+
 func (manager *Manager) Invalidate(rw http.ResponseWriter, session *Session) {
 	manager.beforeReleased(session)
 	manager.store.Clear(session.id)
@@ -85,6 +159,26 @@ func (manager *Manager) beforeReleased(session *Session) {
 	}
 }
 
+func (manager *Manager) expired(id Id, kvs map[string]interface{}) {
+	manager.listenerLock.RLock()
+	listeners := make([]OnExpiredListener, 0, len(manager.expiredListeners))
+	for listener, _ := range manager.expiredListeners {
+		listeners = append(listeners, listener)
+	}
+	manager.listenerLock.RUnlock()
+	for _, listener := range listeners {
+		listener.OnExpired(id, kvs)
+	}
+}
+
+// locker returns the per-session lock of the store, if it has one.
+func (manager *Manager) locker() Locker {
+	if l, ok := manager.baseStore().(Locker); ok {
+		return l
+	}
+	return nil
+}
+
 func (manager *Manager) Run() error {
 	return manager.store.Run()
 }
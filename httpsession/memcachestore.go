@@ -11,19 +11,25 @@ import (
 
 var RegNodeToGob bool
 
+// MemcacheStore writes session nodes with memcache's compare-and-swap,
+// so parallel requests of one browser do not lose each other's writes.
 type MemcacheStore struct {
-	c      *memcache.Client
-	maxAge time.Duration
-	Debug  bool
+	c          *memcache.Client
+	maxAge     time.Duration
+	Debug      bool
+	Policy     ConflictPolicy
+	MaxRetries int
 }
 
 func NewMemcacheStore(maxAge time.Duration, conn []string) *MemcacheStore {
 	if !RegNodeToGob {
 		gob.Register(&sessionNode{})
 	}
-	return &MemcacheStore{c: memcache.New(conn...), maxAge: maxAge}
+	return &MemcacheStore{c: memcache.New(conn...), maxAge: maxAge, MaxRetries: DefaultMaxRetries}
 }
 
+var _ CASStore = &MemcacheStore{}
+
 func (store *MemcacheStore) SetMaxAge(maxAge time.Duration) {
 	store.maxAge = maxAge
 }
@@ -37,15 +43,12 @@ func (store *MemcacheStore) Get(id Id, key string) interface{} {
 }
 
 func (store *MemcacheStore) Set(id Id, key string, value interface{}) {
-	v := store.get(id)
-	if v == nil {
-		v = &sessionNode{Kvs: make(map[string]interface{}),
-			Last:   time.Now(),
-			MaxAge: store.maxAge,
-		}
+	err := update(store, id, store.Policy, store.MaxRetries, func(kvs map[string]interface{}) {
+		kvs[key] = value
+	})
+	if err != nil && store.Debug {
+		log.Println("[Memcache]SetErr: ", err, "Key:", key)
 	}
-	v.Set(key, value)
-	store.set(id, v)
 }
 
 func (store *MemcacheStore) Add(id Id) {
@@ -56,13 +59,18 @@ func (store *MemcacheStore) Add(id Id) {
 }
 
 func (store *MemcacheStore) get(id Id) *sessionNode {
+	_, v := store.getItem(id)
+	return v
+}
+
+func (store *MemcacheStore) getItem(id Id) (*memcache.Item, *sessionNode) {
 	key := string(id)
 	val, err := store.c.Get(key)
 	if err != nil || val == nil {
-		if err != nil && store.Debug {
+		if err != nil && err != memcache.ErrCacheMiss && store.Debug {
 			log.Println("[Memcache]GetErr: ", err, "Key:", key)
 		}
-		return nil
+		return nil, nil
 	}
 
 	var v interface{}
@@ -71,10 +79,62 @@ func (store *MemcacheStore) get(id Id) *sessionNode {
 		if store.Debug {
 			log.Println("[Memcache]DecodeErr: ", err, "Key:", key)
 		}
-		return nil
+		return nil, nil
 	}
-	return v.(*sessionNode)
+	return val, v.(*sessionNode)
 }
+
+func (store *MemcacheStore) Load(id Id) (map[string]interface{}, uint64, error) {
+	v := store.get(id)
+	if v == nil {
+		return make(map[string]interface{}), 0, nil
+	}
+	return copyKvs(v.Kvs), v.Version, nil
+}
+
+func (store *MemcacheStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	item, v := store.getItem(id)
+	if v == nil {
+		if version != 0 {
+			return ErrConflict
+		}
+		v = &sessionNode{Kvs: kvs,
+			Last:    time.Now(),
+			MaxAge:  store.maxAge,
+			Version: 1,
+		}
+		val, err := str.Encode(v)
+		if err != nil {
+			return err
+		}
+		err = store.c.Add(&memcache.Item{Key: string(id), Value: val, Expiration: int32(store.maxAge.Seconds())})
+		if err == memcache.ErrNotStored {
+			return ErrConflict
+		}
+		return err
+	}
+	if v.Version != version {
+		return ErrConflict
+	}
+	v.Kvs = kvs
+	v.Last = time.Now()
+	v.Version++
+	val, err := str.Encode(v)
+	if err != nil {
+		return err
+	}
+	item.Value = val
+	item.Expiration = int32(store.maxAge.Seconds())
+	err = store.c.CompareAndSwap(item)
+	if err == memcache.ErrCASConflict || err == memcache.ErrNotStored {
+		return ErrConflict
+	}
+	if err == nil && store.Debug {
+		log.Println("[Memcache]CAS: ", v, "Key", string(id))
+	}
+	return err
+}
+
 func (store *MemcacheStore) set(id Id, v *sessionNode) bool {
 	key := string(id)
 	val, err := str.Encode(v)
@@ -99,18 +159,18 @@ func (store *MemcacheStore) set(id Id, v *sessionNode) bool {
 	return true
 }
 func (store *MemcacheStore) Del(id Id, key string) bool {
-	v := store.get(id)
-	if v == nil {
-		return true
+	err := update(store, id, store.Policy, store.MaxRetries, func(kvs map[string]interface{}) {
+		delete(kvs, key)
+	})
+	if err != nil && store.Debug {
+		log.Println("[Memcache]DelErr: ", err, "Key:", key)
 	}
-	v.Del(key)
-	return store.set(id, v)
+	return err == nil
 }
 
 func (store *MemcacheStore) Exist(id Id) bool {
 	key := string(id)
-	mk := str.Md5(key)
-	val, err := store.c.Get(mk)
+	val, err := store.c.Get(key)
 	if err != nil || val == nil {
 		return false
 	}
@@ -119,7 +179,7 @@ func (store *MemcacheStore) Exist(id Id) bool {
 
 func (store *MemcacheStore) Clear(id Id) bool {
 	key := string(id)
-	err := store.c.Delete(str.Md5(key))
+	err := store.c.Delete(key)
 	if err != nil {
 		if store.Debug {
 			log.Println("[Memcache]DelErr: ", err, "Key:", key)
@@ -132,6 +192,11 @@ func (store *MemcacheStore) Clear(id Id) bool {
 	return true
 }
 
+// OnExpired always fails, memcache drops expired items without telling anyone.
+func (store *MemcacheStore) OnExpired(fn ExpiredFunc) error {
+	return ErrExpiryNotObservable
+}
+
 func (store *MemcacheStore) Run() error {
 	return nil
 }
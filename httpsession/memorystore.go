@@ -8,10 +8,11 @@ import (
 var _ Store = NewMemoryStore(30)
 
 type sessionNode struct {
-	lock   sync.RWMutex
-	Kvs    map[string]interface{}
-	Last   time.Time
-	MaxAge time.Duration
+	lock    sync.RWMutex
+	Kvs     map[string]interface{}
+	Last    time.Time
+	MaxAge  time.Duration
+	Version uint64
 }
 
 func (node *sessionNode) Get(key string) interface{} {
@@ -28,6 +29,7 @@ func (node *sessionNode) Set(key string, v interface{}) {
 	node.lock.Lock()
 	node.Kvs[key] = v
 	node.Last = time.Now()
+	node.Version++
 	node.lock.Unlock()
 }
 
@@ -35,21 +37,37 @@ func (node *sessionNode) Del(key string) {
 	node.lock.Lock()
 	delete(node.Kvs, key)
 	node.Last = time.Now()
+	node.Version++
 	node.lock.Unlock()
 }
 
+type idLock struct {
+	sync.Mutex
+	refs int
+}
+
 type MemoryStore struct {
 	lock       sync.RWMutex
 	nodes      map[Id]*sessionNode
+	locks      map[Id]*idLock
 	GcInterval time.Duration
 	maxAge     time.Duration
+	onExpired  ExpiredFunc
 }
 
 func NewMemoryStore(maxAge time.Duration) *MemoryStore {
 	return &MemoryStore{nodes: make(map[Id]*sessionNode),
+		locks:  make(map[Id]*idLock),
 		maxAge: maxAge, GcInterval: 10 * time.Second}
 }
 
+var (
+	_ CASStore = NewMemoryStore(30)
+	_ Locker   = NewMemoryStore(30)
+	_ Iterable = NewMemoryStore(30)
+	_ Counter  = NewMemoryStore(30)
+)
+
 func (store *MemoryStore) SetMaxAge(maxAge time.Duration) {
 	store.lock.Lock()
 	store.maxAge = maxAge
@@ -64,11 +82,18 @@ func (store *MemoryStore) Get(id Id, key string) interface{} {
 		return nil
 	}
 
-	if store.maxAge > 0 && time.Now().Sub(node.Last) > node.MaxAge {
+	node.lock.RLock()
+	expired := store.isExpired(node)
+	node.lock.RUnlock()
+	if expired {
 		// lazy DELETE expire
 		store.lock.Lock()
+		_, ok = store.nodes[id]
 		delete(store.nodes, id)
 		store.lock.Unlock()
+		if ok {
+			store.expired(id, node)
+		}
 		return nil
 	}
 
@@ -94,8 +119,11 @@ func (store *MemoryStore) Set(id Id, key string, value interface{}) {
 }
 
 func (store *MemoryStore) Add(id Id) {
-	node := &sessionNode{Kvs: make(map[string]interface{}), Last: time.Now()}
 	store.lock.Lock()
+	node := &sessionNode{Kvs: make(map[string]interface{}),
+		Last:   time.Now(),
+		MaxAge: store.maxAge,
+	}
 	store.nodes[id] = node
 	store.lock.Unlock()
 }
@@ -112,9 +140,14 @@ func (store *MemoryStore) Del(id Id, key string) bool {
 
 func (store *MemoryStore) Exist(id Id) bool {
 	store.lock.RLock()
-	defer store.lock.RUnlock()
-	_, ok := store.nodes[id]
-	return ok
+	node, ok := store.nodes[id]
+	store.lock.RUnlock()
+	if !ok {
+		return false
+	}
+	node.lock.RLock()
+	defer node.lock.RUnlock()
+	return !store.isExpired(node)
 }
 
 func (store *MemoryStore) Clear(id Id) bool {
@@ -124,6 +157,135 @@ func (store *MemoryStore) Clear(id Id) bool {
 	return true
 }
 
+func (store *MemoryStore) Load(id Id) (map[string]interface{}, uint64, error) {
+	store.lock.RLock()
+	node, ok := store.nodes[id]
+	store.lock.RUnlock()
+	if !ok {
+		return make(map[string]interface{}), 0, nil
+	}
+	node.lock.RLock()
+	defer node.lock.RUnlock()
+	return copyKvs(node.Kvs), node.Version, nil
+}
+
+func (store *MemoryStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	store.lock.Lock()
+	node, ok := store.nodes[id]
+	if !ok {
+		if version != 0 {
+			store.lock.Unlock()
+			return ErrConflict
+		}
+		store.nodes[id] = &sessionNode{Kvs: kvs,
+			Last:    time.Now(),
+			MaxAge:  store.maxAge,
+			Version: 1,
+		}
+		store.lock.Unlock()
+		return nil
+	}
+	store.lock.Unlock()
+
+	node.lock.Lock()
+	defer node.lock.Unlock()
+	if node.Version != version {
+		return ErrConflict
+	}
+	node.Kvs = kvs
+	node.Last = time.Now()
+	node.Version++
+	return nil
+}
+
+// Lock blocks until no other request holds the session id.
+func (store *MemoryStore) Lock(id Id) {
+	store.lock.Lock()
+	l, ok := store.locks[id]
+	if !ok {
+		l = &idLock{}
+		store.locks[id] = l
+	}
+	l.refs++
+	store.lock.Unlock()
+	l.Lock()
+}
+
+func (store *MemoryStore) Unlock(id Id) {
+	store.lock.Lock()
+	l, ok := store.locks[id]
+	if !ok {
+		store.lock.Unlock()
+		return
+	}
+	l.refs--
+	if l.refs <= 0 {
+		delete(store.locks, id)
+	}
+	store.lock.Unlock()
+	l.Unlock()
+}
+
+func (store *MemoryStore) isExpired(node *sessionNode) bool {
+	return store.maxAge > 0 && time.Now().Sub(node.Last) > node.MaxAge
+}
+
+// Range visits a snapshot of the active sessions.
+func (store *MemoryStore) Range(fn func(info *SessionInfo) bool) {
+	store.lock.RLock()
+	nodes := make(map[Id]*sessionNode, len(store.nodes))
+	for id, node := range store.nodes {
+		nodes[id] = node
+	}
+	store.lock.RUnlock()
+	for id, node := range nodes {
+		node.lock.RLock()
+		if store.isExpired(node) {
+			node.lock.RUnlock()
+			continue
+		}
+		info := &SessionInfo{Id: id, Values: copyKvs(node.Kvs), Last: node.Last}
+		node.lock.RUnlock()
+		if !fn(info) {
+			return
+		}
+	}
+}
+
+func (store *MemoryStore) Count() int {
+	var n int
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	for _, node := range store.nodes {
+		node.lock.RLock()
+		if !store.isExpired(node) {
+			n++
+		}
+		node.lock.RUnlock()
+	}
+	return n
+}
+
+func (store *MemoryStore) OnExpired(fn ExpiredFunc) error {
+	store.lock.Lock()
+	store.onExpired = fn
+	store.lock.Unlock()
+	return nil
+}
+
+func (store *MemoryStore) expired(id Id, node *sessionNode) {
+	store.lock.RLock()
+	fn := store.onExpired
+	store.lock.RUnlock()
+	if fn == nil {
+		return
+	}
+	node.lock.RLock()
+	kvs := copyKvs(node.Kvs)
+	node.lock.RUnlock()
+	fn(id, kvs)
+}
+
 func (store *MemoryStore) Run() error {
 	time.AfterFunc(store.GcInterval, func() {
 		store.GC()
@@ -135,20 +297,27 @@ func (store *MemoryStore) Run() error {
 //随机检查过期时间
 func (store *MemoryStore) GC() {
 	store.lock.Lock()
-	defer store.lock.Unlock()
 	if store.maxAge == 0 {
+		store.lock.Unlock()
 		return
 	}
 	var i, j int
+	expired := make(map[Id]*sessionNode)
 	for k, v := range store.nodes {
 		if j > 20 || i > 5 {
 			break
 		}
 		if time.Now().Sub(v.Last) > v.MaxAge {
 			delete(store.nodes, k)
+			expired[k] = v
 			i = i + 1
 		}
 		j = j + 1
 	}
+	store.lock.Unlock()
 
+	// notify outside of the lock, listeners may use the store
+	for k, v := range expired {
+		store.expired(k, v)
+	}
 }
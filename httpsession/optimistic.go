@@ -0,0 +1,127 @@
+package httpsession
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrConflict = errors.New("session was modified by another request")
+
+// ConflictPolicy decides what a write does when the session node has been
+// changed by someone else since it was read.
+type ConflictPolicy int
+
+const (
+	// ConflictRetry reads the node again and reapplies the change, so
+	// concurrent updates of different keys are merged.
+	ConflictRetry ConflictPolicy = iota
+	// ConflictOverwrite applies the change to the current values at once,
+	// without backing off. The last writer wins for the keys it changes,
+	// the keys written by others are kept.
+	ConflictOverwrite
+	// ConflictFail drops the change and reports ErrConflict.
+	ConflictFail
+)
+
+const DefaultMaxRetries = 10
+
+// CASStore is implemented by stores whose session nodes carry a version
+// number, so that a whole node can be written conditionally.
+type CASStore interface {
+	Store
+	// Load returns a copy of the session values and their version.
+	// A session which does not exist yet has version 0.
+	Load(id Id) (kvs map[string]interface{}, version uint64, err error)
+	// CompareAndSwap stores kvs only if the version is still the given one,
+	// otherwise ErrConflict is returned.
+	CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error
+}
+
+// Locker is implemented by stores which can serialize all the requests of
+// one session.
+type Locker interface {
+	Lock(id Id)
+	Unlock(id Id)
+}
+
+// update runs a read-modify-write of one session node under the given policy.
+func update(store CASStore, id Id, policy ConflictPolicy, maxRetries int,
+	fn func(kvs map[string]interface{})) error {
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	for i := 0; ; i++ {
+		kvs, version, err := store.Load(id)
+		if err != nil {
+			return err
+		}
+		fn(kvs)
+		err = store.CompareAndSwap(id, kvs, version)
+		if err != ErrConflict {
+			return err
+		}
+		switch policy {
+		case ConflictOverwrite:
+			// write the change over the current values, not over the stale
+			// ones, or the keys of the other writer would be lost
+			kvs, version, err = store.Load(id)
+			if err != nil {
+				return err
+			}
+			fn(kvs)
+			if err = store.CompareAndSwap(id, kvs, version); err != ErrConflict {
+				return err
+			}
+		case ConflictFail:
+			return err
+		}
+		if i >= maxRetries {
+			return err
+		}
+		// back off a little, the other request is writing right now
+		time.Sleep(time.Duration(i+1) * time.Millisecond)
+	}
+}
+
+func copyKvs(kvs map[string]interface{}) map[string]interface{} {
+	r := make(map[string]interface{}, len(kvs))
+	for k, v := range kvs {
+		r[k] = v
+	}
+	return r
+}
+
+// OptimisticStore turns every Set and Del of a CASStore into a versioned
+// write, handled according to Policy when two requests collide.
+type OptimisticStore struct {
+	CASStore
+	Policy     ConflictPolicy
+	MaxRetries int
+	Debug      bool
+}
+
+func NewOptimisticStore(store CASStore, policy ConflictPolicy) *OptimisticStore {
+	return &OptimisticStore{CASStore: store, Policy: policy, MaxRetries: DefaultMaxRetries}
+}
+
+var _ Store = &OptimisticStore{}
+
+func (store *OptimisticStore) Set(id Id, key string, value interface{}) {
+	err := update(store.CASStore, id, store.Policy, store.MaxRetries, func(kvs map[string]interface{}) {
+		kvs[key] = value
+	})
+	if err != nil && store.Debug {
+		log.Println("[OptimisticStore]SetErr: ", err, "Key:", key)
+	}
+}
+
+func (store *OptimisticStore) Del(id Id, key string) bool {
+	err := update(store.CASStore, id, store.Policy, store.MaxRetries, func(kvs map[string]interface{}) {
+		delete(kvs, key)
+	})
+	if err != nil && store.Debug {
+		log.Println("[OptimisticStore]DelErr: ", err, "Key:", key)
+	}
+	return err == nil
+}
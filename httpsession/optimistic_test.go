@@ -0,0 +1,179 @@
+package httpsession
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOptimisticStoreConcurrentKeys(t *testing.T) {
+	store := NewOptimisticStore(NewMemoryStore(time.Minute), ConflictRetry)
+	id := Id("concurrent")
+	store.Add(id)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			store.Set(id, fmt.Sprintf("key%d", i), i)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 50; i++ {
+		if v := store.Get(id, fmt.Sprintf("key%d", i)); v != i {
+			t.Fatalf("key%d lost, got %v", i, v)
+		}
+	}
+}
+
+// conflictStore reports a conflict for the first n writes
+type conflictStore struct {
+	*MemoryStore
+	n int
+}
+
+func (store *conflictStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	if store.n > 0 {
+		store.n--
+		return ErrConflict
+	}
+	return store.MemoryStore.CompareAndSwap(id, kvs, version)
+}
+
+func TestOptimisticStorePolicy(t *testing.T) {
+	id := Id("policy")
+
+	fail := NewOptimisticStore(&conflictStore{NewMemoryStore(time.Minute), 1}, ConflictFail)
+	fail.Set(id, "a", 1)
+	if fail.Get(id, "a") != nil {
+		t.Error("ConflictFail should drop the write")
+	}
+
+	retry := NewOptimisticStore(&conflictStore{NewMemoryStore(time.Minute), 3}, ConflictRetry)
+	retry.Set(id, "a", 1)
+	if retry.Get(id, "a") != 1 {
+		t.Error("ConflictRetry should write after retrying")
+	}
+
+	retry = NewOptimisticStore(&conflictStore{NewMemoryStore(time.Minute), 100}, ConflictRetry)
+	retry.MaxRetries = 2
+	if retry.Del(id, "a") {
+		t.Error("Del should fail after MaxRetries conflicts")
+	}
+}
+
+// racingStore lets another writer set a key before the first write
+type racingStore struct {
+	*MemoryStore
+	raced bool
+}
+
+func (store *racingStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	if !store.raced {
+		store.raced = true
+		store.MemoryStore.Set(id, "other", "kept")
+	}
+	return store.MemoryStore.CompareAndSwap(id, kvs, version)
+}
+
+func TestOptimisticStoreOverwrite(t *testing.T) {
+	id := Id("overwrite")
+	base := NewMemoryStore(time.Minute)
+	base.Add(id)
+	base.Set(id, "a", 0)
+
+	store := NewOptimisticStore(&racingStore{MemoryStore: base}, ConflictOverwrite)
+	store.Set(id, "a", 1)
+	if v := store.Get(id, "a"); v != 1 {
+		t.Errorf("the change should be written, got %v", v)
+	}
+	if v := store.Get(id, "other"); v != "kept" {
+		t.Errorf("the key of the other writer should be kept, got %v", v)
+	}
+}
+
+func TestMemoryStoreLock(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	id := Id("locked")
+	store.Lock(id)
+
+	done := make(chan bool)
+	go func() {
+		store.Lock(id)
+		store.Unlock(id)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("second Lock should wait for Unlock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	store.Unlock(id)
+	<-done
+	if len(store.locks) != 0 {
+		t.Error("locks should be released")
+	}
+}
+
+// testCASStore checks that two stores on the same data, like two servers,
+// keep the writes of each other
+func testCASStore(t *testing.T, a, b CASStore) {
+	id := Id("shared")
+	a.Add(id)
+	kvs, version, err := a.Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.CompareAndSwap(id, map[string]interface{}{"b": "first"}, version); err != nil {
+		t.Fatal(err)
+	}
+	kvs["a"] = "stale"
+	if err = a.CompareAndSwap(id, kvs, version); err != ErrConflict {
+		t.Fatalf("a write over an old version should conflict, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			[]CASStore{a, b}[i%2].Set(id, fmt.Sprintf("key%d", i), i)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		if v := a.Get(id, fmt.Sprintf("key%d", i)); fmt.Sprint(v) != fmt.Sprint(i) {
+			t.Errorf("key%d lost, got %v", i, v)
+		}
+	}
+	if v := b.Get(id, "b"); v != "first" {
+		t.Errorf("the first write was lost, got %v", v)
+	}
+}
+
+func TestStoreCompareAndSwap(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		testCASStore(t, NewFileStore(dir, time.Minute), NewFileStore(dir, time.Minute))
+	})
+	t.Run("sql", func(t *testing.T) {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "session.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+		a, err := NewSQLStore(db, "", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := NewSQLStore(db, "", time.Minute)
+		testCASStore(t, a, b)
+	})
+}
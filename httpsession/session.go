@@ -31,6 +31,23 @@ func (session *Session) Del(key string) bool {
 	return session.manager.store.Del(session.id, key)
 }
 
+// Lock makes other requests of this session wait until Unlock is called.
+// It returns false if the store does not support per-session locks.
+func (session *Session) Lock() bool {
+	l := session.manager.locker()
+	if l == nil {
+		return false
+	}
+	l.Lock(session.id)
+	return true
+}
+
+func (session *Session) Unlock() {
+	if l := session.manager.locker(); l != nil {
+		l.Unlock(session.id)
+	}
+}
+
 func (session *Session) Invalidate(rw http.ResponseWriter) {
 	session.manager.Invalidate(rw, session)
 }
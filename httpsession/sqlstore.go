@@ -0,0 +1,333 @@
+package httpsession
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"log"
+	"sync"
+	"time"
+)
+
+// SQLStore keeps the sessions in a table of a database/sql database, so
+// that several servers can share them. Every write checks the version of
+// the row, see CASStore. Values are gob encoded, register
+// the types of your own values with gob.Register. The queries use ?
+// placeholders and the table a blob column, as sqlite and mysql do, other
+// databases such as postgres are not supported.
+type SQLStore struct {
+	db         *sql.DB
+	table      string
+	GcInterval time.Duration
+	Debug      bool
+	lock       sync.RWMutex
+	maxAge     time.Duration
+	onExpired  ExpiredFunc
+}
+
+// NewSQLStore creates the table if it does not exist yet.
+func NewSQLStore(db *sql.DB, table string, maxAge time.Duration) (*SQLStore, error) {
+	if table == "" {
+		table = "session"
+	}
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + table +
+		" (id varchar(128) PRIMARY KEY, data blob, last bigint, version bigint)")
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, table: table, maxAge: maxAge, GcInterval: time.Minute}, nil
+}
+
+var (
+	_ CASStore    = &SQLStore{}
+	_ Iterable    = &SQLStore{}
+	_ Counter     = &SQLStore{}
+	_ Snapshotter = &SQLStore{}
+)
+
+// since returns the oldest last access of a session which has not expired.
+func (store *SQLStore) since() int64 {
+	store.lock.RLock()
+	maxAge := store.maxAge
+	store.lock.RUnlock()
+	if maxAge <= 0 {
+		return 0
+	}
+	return time.Now().Add(-maxAge).UnixNano()
+}
+
+func (store *SQLStore) encode(kvs map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(kvs)
+	return buf.Bytes(), err
+}
+
+func (store *SQLStore) decode(data []byte) (map[string]interface{}, error) {
+	kvs := make(map[string]interface{})
+	if len(data) == 0 {
+		return kvs, nil
+	}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&kvs)
+	return kvs, err
+}
+
+// load returns the values of the session, nil if there is none or it expired.
+func (store *SQLStore) load(id Id) map[string]interface{} {
+	var data []byte
+	var last int64
+	err := store.db.QueryRow("SELECT data, last FROM "+store.table+" WHERE id = ?",
+		string(id)).Scan(&data, &last)
+	if err != nil {
+		if err != sql.ErrNoRows && store.Debug {
+			log.Println("[SQLStore]GetErr: ", err, "Id:", id)
+		}
+		return nil
+	}
+	if last < store.since() {
+		return nil
+	}
+	kvs, err := store.decode(data)
+	if err != nil {
+		if store.Debug {
+			log.Println("[SQLStore]DecodeErr: ", err, "Id:", id)
+		}
+		return nil
+	}
+	return kvs
+}
+
+func (store *SQLStore) save(id Id, kvs map[string]interface{}) bool {
+	data, err := store.encode(kvs)
+	var res sql.Result
+	if err == nil {
+		res, err = store.db.Exec("UPDATE "+store.table+" SET data = ?, last = ?, version = version + 1 WHERE id = ?",
+			data, time.Now().UnixNano(), string(id))
+	}
+	if err == nil {
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err = store.db.Exec("INSERT INTO "+store.table+" (id, data, last, version) VALUES (?, ?, ?, 1)",
+				string(id), data, time.Now().UnixNano())
+		}
+	}
+	if err != nil {
+		if store.Debug {
+			log.Println("[SQLStore]PutErr: ", err, "Id:", id)
+		}
+		return false
+	}
+	return true
+}
+
+func (store *SQLStore) SetMaxAge(maxAge time.Duration) {
+	store.lock.Lock()
+	store.maxAge = maxAge
+	store.lock.Unlock()
+}
+
+func (store *SQLStore) Get(id Id, key string) interface{} {
+	kvs := store.load(id)
+	if kvs == nil {
+		return nil
+	}
+	store.db.Exec("UPDATE "+store.table+" SET last = ? WHERE id = ?", time.Now().UnixNano(), string(id))
+	return kvs[key]
+}
+
+func (store *SQLStore) Snapshot(id Id) map[string]interface{} {
+	return store.load(id)
+}
+
+// Load returns no values for an expired session, but its version, so that
+// the next write replaces the row.
+func (store *SQLStore) Load(id Id) (map[string]interface{}, uint64, error) {
+	var data []byte
+	var last int64
+	var version uint64
+	err := store.db.QueryRow("SELECT data, last, version FROM "+store.table+" WHERE id = ?",
+		string(id)).Scan(&data, &last, &version)
+	if err == sql.ErrNoRows {
+		return make(map[string]interface{}), 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if last < store.since() {
+		return make(map[string]interface{}), version, nil
+	}
+	kvs, err := store.decode(data)
+	return kvs, version, err
+}
+
+func (store *SQLStore) CompareAndSwap(id Id, kvs map[string]interface{}, version uint64) error {
+	data, err := store.encode(kvs)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixNano()
+	if version == 0 {
+		_, err = store.db.Exec("INSERT INTO "+store.table+" (id, data, last, version) VALUES (?, ?, ?, 1)",
+			string(id), data, now)
+		if err != nil && store.exists(id) {
+			// another server inserted the row first
+			return ErrConflict
+		}
+		return err
+	}
+	res, err := store.db.Exec("UPDATE "+store.table+" SET data = ?, last = ?, version = version + 1 WHERE id = ? AND version = ?",
+		data, now, string(id), version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// exists reports whether the session has a row, expired or not.
+func (store *SQLStore) exists(id Id) bool {
+	var n int
+	err := store.db.QueryRow("SELECT COUNT(*) FROM "+store.table+" WHERE id = ?", string(id)).Scan(&n)
+	return err == nil && n > 0
+}
+
+func (store *SQLStore) Set(id Id, key string, value interface{}) {
+	err := update(store, id, ConflictRetry, DefaultMaxRetries, func(kvs map[string]interface{}) {
+		kvs[key] = value
+	})
+	if err != nil && store.Debug {
+		log.Println("[SQLStore]SetErr: ", err, "Id:", id)
+	}
+}
+
+func (store *SQLStore) Add(id Id) {
+	store.save(id, make(map[string]interface{}))
+}
+
+func (store *SQLStore) Del(id Id, key string) bool {
+	if !store.Exist(id) {
+		return true
+	}
+	err := update(store, id, ConflictRetry, DefaultMaxRetries, func(kvs map[string]interface{}) {
+		delete(kvs, key)
+	})
+	if err != nil && store.Debug {
+		log.Println("[SQLStore]DelErr: ", err, "Id:", id)
+	}
+	return err == nil
+}
+
+func (store *SQLStore) Exist(id Id) bool {
+	var last int64
+	err := store.db.QueryRow("SELECT last FROM "+store.table+" WHERE id = ?", string(id)).Scan(&last)
+	return err == nil && last >= store.since()
+}
+
+func (store *SQLStore) Clear(id Id) bool {
+	_, err := store.db.Exec("DELETE FROM "+store.table+" WHERE id = ?", string(id))
+	if err != nil && store.Debug {
+		log.Println("[SQLStore]DelErr: ", err, "Id:", id)
+	}
+	return err == nil
+}
+
+// Range visits the sessions which have not expired.
+func (store *SQLStore) Range(fn func(info *SessionInfo) bool) {
+	rows, err := store.db.Query("SELECT id, data, last FROM "+store.table+" WHERE last >= ?", store.since())
+	if err != nil {
+		if store.Debug {
+			log.Println("[SQLStore]RangeErr: ", err)
+		}
+		return
+	}
+	// read all the rows first, fn may use the store
+	infos := make([]*SessionInfo, 0)
+	for rows.Next() {
+		var id string
+		var data []byte
+		var last int64
+		if rows.Scan(&id, &data, &last) != nil {
+			continue
+		}
+		kvs, err := store.decode(data)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, &SessionInfo{Id: Id(id), Values: kvs, Last: time.Unix(0, last)})
+	}
+	rows.Close()
+	for _, info := range infos {
+		if !fn(info) {
+			return
+		}
+	}
+}
+
+func (store *SQLStore) Count() int {
+	var n int
+	err := store.db.QueryRow("SELECT COUNT(*) FROM "+store.table+" WHERE last >= ?", store.since()).Scan(&n)
+	if err != nil && store.Debug {
+		log.Println("[SQLStore]CountErr: ", err)
+	}
+	return n
+}
+
+func (store *SQLStore) OnExpired(fn ExpiredFunc) error {
+	store.lock.Lock()
+	store.onExpired = fn
+	store.lock.Unlock()
+	return nil
+}
+
+func (store *SQLStore) Run() error {
+	time.AfterFunc(store.GcInterval, func() {
+		store.GC()
+		store.Run()
+	})
+	return nil
+}
+
+// GC deletes the expired sessions. The listener is told about the sessions
+// this server deleted, when several servers share the table each expired
+// session is reported by one of them.
+func (store *SQLStore) GC() {
+	since := store.since()
+	if since == 0 {
+		return
+	}
+	rows, err := store.db.Query("SELECT id, data FROM "+store.table+" WHERE last < ?", since)
+	if err != nil {
+		if store.Debug {
+			log.Println("[SQLStore]GCErr: ", err)
+		}
+		return
+	}
+	type expired struct {
+		id   string
+		data []byte
+	}
+	found := make([]expired, 0)
+	for rows.Next() {
+		var e expired
+		if rows.Scan(&e.id, &e.data) == nil {
+			found = append(found, e)
+		}
+	}
+	rows.Close()
+
+	store.lock.RLock()
+	fn := store.onExpired
+	store.lock.RUnlock()
+	for _, e := range found {
+		res, err := store.db.Exec("DELETE FROM "+store.table+" WHERE id = ? AND last < ?", e.id, since)
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 || fn == nil {
+			continue
+		}
+		if kvs, err := store.decode(e.data); err == nil {
+			fn(Id(e.id), kvs)
+		}
+	}
+}
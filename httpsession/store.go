@@ -1,9 +1,20 @@
 package httpsession
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Id string
 
+// ErrExpiryNotObservable is returned by stores which drop expired sessions
+// without noticing it, e.g. because the backend expires keys by itself.
+var ErrExpiryNotObservable = errors.New("the session store can not observe expiry")
+
+// ExpiredFunc is called with the values of a session the store removed
+// because it was expired.
+type ExpiredFunc func(id Id, kvs map[string]interface{})
+
 type Store interface {
 	Get(id Id, key string) interface{}
 	Set(id Id, key string, value interface{})
@@ -13,4 +24,7 @@ type Store interface {
 	Exist(id Id) bool
 	SetMaxAge(maxAge time.Duration)
 	Run() error
+	// OnExpired sets the callback for expired sessions, a store which
+	// can not observe expiry returns ErrExpiryNotObservable.
+	OnExpired(fn ExpiredFunc) error
 }
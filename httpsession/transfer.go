@@ -3,6 +3,7 @@ package httpsession
 import (
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
@@ -57,28 +58,22 @@ func (transfer *CookieTransfer) Set(req *http.Request, rw http.ResponseWriter, i
 	sid := url.QueryEscape(string(id))
 	transfer.Lock.Lock()
 	defer transfer.Lock.Unlock()
-	cookie, _ := req.Cookie(transfer.Name)
-	if cookie == nil {
-		cookie = &http.Cookie{
-			Name:     transfer.Name,
-			Value:    sid,
-			Path:     transfer.RootPath,
-			Domain:   transfer.Domain,
-			HttpOnly: true,
-			Secure:   transfer.Secure,
-		}
-		if transfer.MaxAge > 0 {
-			cookie.MaxAge = int(transfer.MaxAge / time.Second)
-			//cookie.Expires = time.Now().Add(transfer.maxAge).UTC()
-		}
-
+	cookie := &http.Cookie{
+		Name:     transfer.Name,
+		Value:    sid,
+		Path:     transfer.RootPath,
+		Domain:   transfer.Domain,
+		HttpOnly: true,
+		Secure:   transfer.Secure,
+	}
+	if transfer.MaxAge > 0 {
+		cookie.MaxAge = int(transfer.MaxAge / time.Second)
+		//cookie.Expires = time.Now().Add(transfer.maxAge).UTC()
+	}
+	// the cookie of the request is a copy, its attributes are unknown, so
+	// the response always gets a complete new one
+	if old, _ := req.Cookie(transfer.Name); old == nil {
 		req.AddCookie(cookie)
-	} else {
-		cookie.Value = sid
-		if transfer.MaxAge > 0 {
-			cookie.MaxAge = int(transfer.MaxAge / time.Second)
-			//cookie.Expires = time.Now().Add(transfer.maxAge)
-		}
 	}
 	http.SetCookie(rw, cookie)
 }
@@ -98,26 +93,184 @@ func (transfer *CookieTransfer) Clear(rw http.ResponseWriter) {
 
 var _ Transfer = NewCookieTransfer("test", 0, false, "/")
 
-// CookieRetriever provide sessionid from url
-/*type UrlTransfer struct {
+// UrlTransfer provide sessionid from url query string, a new sessionid is
+// sent back in the response Header.
+type UrlTransfer struct {
+	Name   string
+	Header string
+}
+
+func NewUrlTransfer(name string) *UrlTransfer {
+	return &UrlTransfer{Name: name, Header: DefaultSessionHeader}
+}
+
+func (transfer *UrlTransfer) SetMaxAge(maxAge time.Duration) {
+}
+
+func (transfer *UrlTransfer) Get(req *http.Request) (Id, error) {
+	sessionId := req.URL.Query().Get(transfer.Name)
+	return Id(sessionId), nil
+}
+
+// Set sends the new sessionid in the response header, the client has to
+// carry it on in its urls. It is put into the request url as well, so
+// that the links made by Url during this request have it.
+func (transfer *UrlTransfer) Set(req *http.Request, rw http.ResponseWriter, id Id) {
+	query := req.URL.Query()
+	query.Set(transfer.Name, string(id))
+	req.URL.RawQuery = query.Encode()
+	if transfer.Header != "" {
+		rw.Header().Set(transfer.Header, string(id))
+	}
+}
+
+// Clear sends an empty header, so the client knows to forget the sessionid.
+func (transfer *UrlTransfer) Clear(rw http.ResponseWriter) {
+	if transfer.Header != "" {
+		rw.Header().Set(transfer.Header, "")
+	}
 }
 
-func NewUrlTransfer() *UrlTransfer {
-	return &UrlTransfer{}
+// Url appends the sessionid to u
+func (transfer *UrlTransfer) Url(u string, id Id) string {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	return u + sep + url.QueryEscape(transfer.Name) + "=" + url.QueryEscape(string(id))
 }
 
-func (transfer *UrlTransfer) Get(req *http.Request) (string, error) {
-	return "", nil
+var _ Transfer = NewUrlTransfer("test")
+
+// HeaderTransfer provide sessionid from a request header or from
+// "Authorization: Bearer <id>", and returns it in a response header.
+type HeaderTransfer struct {
+	Name   string
+	Bearer bool
 }
 
-func (transfer *UrlTransfer) Set(rw http.ResponseWriter, id Id) {
+func NewHeaderTransfer(name string, bearer bool) *HeaderTransfer {
+	return &HeaderTransfer{Name: name, Bearer: bearer}
+}
 
+func (transfer *HeaderTransfer) SetMaxAge(maxAge time.Duration) {
 }
 
-var (
-	_ Transfer = NewUrlTransfer()
+func (transfer *HeaderTransfer) Get(req *http.Request) (Id, error) {
+	if sessionId := req.Header.Get(transfer.Name); sessionId != "" {
+		return Id(sessionId), nil
+	}
+	if transfer.Bearer {
+		auth := req.Header.Get("Authorization")
+		if len(auth) > 7 && strings.EqualFold(auth[0:7], "Bearer ") {
+			return Id(strings.TrimSpace(auth[7:])), nil
+		}
+	}
+	return Id(""), nil
+}
+
+func (transfer *HeaderTransfer) Set(req *http.Request, rw http.ResponseWriter, id Id) {
+	rw.Header().Set(transfer.Name, string(id))
+}
+
+// Clear sends an empty header, so the client knows to forget the sessionid.
+func (transfer *HeaderTransfer) Clear(rw http.ResponseWriter) {
+	rw.Header().Set(transfer.Name, "")
+}
+
+var _ Transfer = NewHeaderTransfer("test", true)
+
+// ChainTransfer tries several transfers in order and takes the first sessionid found
+type ChainTransfer struct {
+	Transfers []Transfer
+}
+
+func NewChainTransfer(transfers ...Transfer) *ChainTransfer {
+	return &ChainTransfer{Transfers: transfers}
+}
+
+func (transfer *ChainTransfer) SetMaxAge(maxAge time.Duration) {
+	for _, t := range transfer.Transfers {
+		t.SetMaxAge(maxAge)
+	}
+}
+
+func (transfer *ChainTransfer) Get(req *http.Request) (Id, error) {
+	var lastErr error
+	for _, t := range transfer.Transfers {
+		id, err := t.Get(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if id != "" {
+			return id, nil
+		}
+	}
+	return Id(""), lastErr
+}
+
+// Set hands the sessionid to every transfer, the client keeps the one it uses.
+func (transfer *ChainTransfer) Set(req *http.Request, rw http.ResponseWriter, id Id) {
+	for _, t := range transfer.Transfers {
+		t.Set(req, rw, id)
+	}
+}
+
+func (transfer *ChainTransfer) Clear(rw http.ResponseWriter) {
+	for _, t := range transfer.Transfers {
+		t.Clear(rw)
+	}
+}
+
+var _ Transfer = NewChainTransfer()
+
+const (
+	CookieTransferType    = "cookie"
+	CookieUrlTransferType = "cookie_url"
+	UrlTransferType       = "url"
+	HeaderTransferType    = "header"
+	ChainTransferType     = "chain"
+	// the strict types don't read "Authorization: Bearer" and the query
+	StrictHeaderTransferType = "strict_header"
+	StrictChainTransferType  = "strict_chain"
+
+	DefaultSessionName   = "SESSIONID"
+	DefaultSessionHeader = "X-Session-Token"
 )
-*/
+
+// NewTransfer creates a transfer by its type name. The header type reads
+// the header, then "Authorization: Bearer". The chain type tries the
+// header, then the cookie, then the query string. Apps whose bearer tokens
+// go to TokenAuth or JWTAuth, or which don't want ids in urls, choose the
+// strict_header or strict_chain type: the header only, or the header, then
+// the cookie.
+func NewTransfer(typ string, name string, header string, maxAge time.Duration, secure bool, rootPath string) Transfer {
+	if name == "" {
+		name = DefaultSessionName
+	}
+	if header == "" {
+		header = DefaultSessionHeader
+	}
+	switch typ {
+	case CookieUrlTransferType:
+		return NewCookieUrlTransfer(name, maxAge, secure, rootPath)
+	case UrlTransferType:
+		return &UrlTransfer{Name: name, Header: header}
+	case HeaderTransferType:
+		return NewHeaderTransfer(header, true)
+	case ChainTransferType:
+		return NewChainTransfer(NewHeaderTransfer(header, true),
+			NewCookieTransfer(name, maxAge, secure, rootPath),
+			&UrlTransfer{Name: name, Header: header})
+	case StrictHeaderTransferType:
+		return NewHeaderTransfer(header, false)
+	case StrictChainTransferType:
+		return NewChainTransfer(NewHeaderTransfer(header, false),
+			NewCookieTransfer(name, maxAge, secure, rootPath))
+	}
+	return NewCookieTransfer(name, maxAge, secure, rootPath)
+}
 
 //for SWFUpload ...
 func NewCookieUrlTransfer(name string, maxAge time.Duration, secure bool, rootPath string) *CookieUrlTransfer {
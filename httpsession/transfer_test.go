@@ -0,0 +1,81 @@
+package httpsession
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainTransfer(t *testing.T) {
+	transfer := NewTransfer(ChainTransferType, "", "", 0, true, "/")
+
+	req, _ := http.NewRequest("GET", "/?SESSIONID=fromurl", nil)
+	if id, _ := transfer.Get(req); id != "fromurl" {
+		t.Errorf("expected id from url, got %q", id)
+	}
+
+	req.AddCookie(&http.Cookie{Name: DefaultSessionName, Value: "fromcookie"})
+	if id, _ := transfer.Get(req); id != "fromcookie" {
+		t.Errorf("expected id from cookie, got %q", id)
+	}
+
+	req.Header.Set("Authorization", "Bearer frombearer")
+	if id, _ := transfer.Get(req); id != "frombearer" {
+		t.Errorf("expected id from bearer token, got %q", id)
+	}
+
+	req.Header.Set("X-Session-Token", "fromheader")
+	if id, _ := transfer.Get(req); id != "fromheader" {
+		t.Errorf("expected id from header, got %q", id)
+	}
+
+	rw := httptest.NewRecorder()
+	transfer.Set(req, rw, Id("newid"))
+	if rw.Header().Get("X-Session-Token") != "newid" {
+		t.Error("the response header should carry the new id")
+	}
+	if cookie := rw.Header().Get("Set-Cookie"); !strings.Contains(cookie, "Secure") {
+		t.Errorf("a secure cookie should be set as well, got %q", cookie)
+	}
+}
+
+func TestStrictChainTransfer(t *testing.T) {
+	transfer := NewTransfer(StrictChainTransferType, "", "", 0, false, "/")
+	req, _ := http.NewRequest("GET", "/?SESSIONID=fromurl", nil)
+	req.Header.Set("Authorization", "Bearer frombearer")
+	if id, _ := transfer.Get(req); id != "" {
+		t.Errorf("the url and the bearer token should not carry the id, got %q", id)
+	}
+	req.AddCookie(&http.Cookie{Name: DefaultSessionName, Value: "fromcookie"})
+	if id, _ := transfer.Get(req); id != "fromcookie" {
+		t.Errorf("expected id from cookie, got %q", id)
+	}
+}
+
+func TestHeaderTransferBearer(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer frombearer")
+	if id, _ := NewTransfer(HeaderTransferType, "", "", 0, false, "/").Get(req); id != "frombearer" {
+		t.Errorf("expected id from bearer token, got %q", id)
+	}
+	if id, _ := NewTransfer(StrictHeaderTransferType, "", "", 0, false, "/").Get(req); id != "" {
+		t.Errorf("the strict header should not read the bearer token, got %q", id)
+	}
+}
+
+func TestUrlTransfer(t *testing.T) {
+	transfer := NewUrlTransfer("sid")
+	if u := transfer.Url("/a?b=1", Id("x y")); u != "/a?b=1&sid=x+y" {
+		t.Errorf("unexpected url %v", u)
+	}
+	req, _ := http.NewRequest("GET", "/a", nil)
+	rw := httptest.NewRecorder()
+	transfer.Set(req, rw, Id("abc"))
+	if id, _ := transfer.Get(req); id != "abc" {
+		t.Errorf("expected abc, got %q", id)
+	}
+	if id := rw.Header().Get(DefaultSessionHeader); id != "abc" {
+		t.Errorf("the client should be sent the new id, got %q", id)
+	}
+}
@@ -0,0 +1,123 @@
+package xweb
+
+import (
+	"fmt"
+
+	"github.com/coscms/xweb/lib/i18n"
+	"github.com/coscms/xweb/validation"
+)
+
+// I18n translates the app, set it as App.I18n:
+//
+//	bundle := i18n.NewBundle("en")
+//	if err := bundle.LoadFS(os.DirFS("locales"), "."); err != nil {
+//		...
+//	}
+//	app.I18n = xweb.NewI18n(bundle)
+//
+// The locale of a request is the first the bundle has of the query param,
+// the cookie, the session value, then the Accept-Language header, else
+// Bundle.Default. Leave Param, Cookie or Session empty to skip them.
+//
+// Templates translate with {{T "cart.items" .Count}}, actions with c.Tr,
+// and the messages of validations are looked up as validation.<name>,
+// validation.Range for instance. Only the validations of c.NewValidation
+// and of a Validation *validation.Validation field of the action, which
+// the app sets for each request, are translated; new(validation.Validation)
+// keeps the English MessageTmpls.
+type I18n struct {
+	*i18n.Bundle
+	Param   string
+	Cookie  string
+	Session string
+}
+
+func NewI18n(bundle *i18n.Bundle) *I18n {
+	return &I18n{
+		Bundle:  bundle,
+		Param:   "lang",
+		Cookie:  "lang",
+		Session: "lang",
+	}
+}
+
+// detect looks at the sources in order and stops at the first locale the
+// bundle has. The session is only read when the request has one, a visitor
+// doesn't get a session for the sake of the locale.
+func (t *I18n) detect(c *Action) string {
+	if t.Param != "" {
+		if locale := t.Match(c.Request.URL.Query().Get(t.Param)); locale != "" {
+			return locale
+		}
+	}
+	if t.Cookie != "" {
+		if locale := t.Match(c.Cookie(t.Cookie)); locale != "" {
+			return locale
+		}
+	}
+	if t.Session != "" {
+		if session := c.existingSession(); session != nil {
+			if v, ok := session.Get(t.Session).(string); ok {
+				if locale := t.Match(v); locale != "" {
+					return locale
+				}
+			}
+		}
+	}
+	if locale := t.Match(i18n.ParseAcceptLanguage(c.Header("Accept-Language"))...); locale != "" {
+		return locale
+	}
+	return t.Default
+}
+
+// Locale returns the locale of the request, "" when the app has no I18n.
+func (c *Action) Locale() string {
+	if c.App.I18n == nil {
+		return ""
+	}
+	if c.locale == nil {
+		locale := c.App.I18n.detect(c)
+		c.locale = &locale
+	}
+	return *c.locale
+}
+
+// SetLocale changes the locale of the request. It is not remembered,
+// set the cookie or the session value for the next requests.
+func (c *Action) SetLocale(locale string) {
+	locale = i18n.Normalize(locale)
+	c.locale = &locale
+}
+
+// Tr translates key in the locale of the request, it is the template
+// function T. The first integer of args chooses the plural form. Without
+// App.I18n the key is formatted with args.
+func (c *Action) Tr(key string, args ...interface{}) string {
+	if c.App.I18n == nil {
+		if len(args) == 0 {
+			return key
+		}
+		return fmt.Sprintf(key, args...)
+	}
+	return c.App.I18n.Translate(c.Locale(), key, args...)
+}
+
+// NewValidation returns a validation with the messages of the locale of
+// the request, the catalogs translate them by the keys validation.<name>
+// with the arguments of MessageTmpls. It is the way to build a localized
+// validation, a validation built otherwise has no Messages.
+func (c *Action) NewValidation() *validation.Validation {
+	v := new(validation.Validation)
+	if c.App.I18n == nil {
+		return v
+	}
+	v.Messages = func(name string) string {
+		key := "validation." + name
+		if !c.App.I18n.Has(c.Locale(), key) {
+			return ""
+		}
+		// the arguments are filled by the validation
+		return c.App.I18n.Translate(c.Locale(), key)
+	}
+	return v
+}
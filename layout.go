@@ -0,0 +1,129 @@
+package xweb
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template/parse"
+)
+
+var (
+	extendsRegexp = regexp.MustCompile(`^\s*\{\{-?\s*extends\s+"([^"]+)"\s*-?\}\}`)
+	contentRegexp = regexp.MustCompile(`\{\{-?\s*(define|block)\s+"content"`)
+)
+
+// templateFile is one template of a layout chain.
+type templateFile struct {
+	Name   string
+	Source string
+}
+
+// parseExtends finds {{extends "layout"}}, which has to be the first action
+// of a template. It is replaced by the newlines it spans, so that the lines
+// of errors stay right, line is where it was found.
+func parseExtends(content string) (layout string, body string, line int) {
+	m := extendsRegexp.FindStringSubmatchIndex(content)
+	if m == nil {
+		return "", content, 0
+	}
+	matched := content[m[0]:m[1]]
+	line = strings.Count(content[:m[2]], "\n") + 1
+	return content[m[2]:m[3]], strings.Repeat("\n", strings.Count(matched, "\n")) + content[m[1]:], line
+}
+
+// layoutName adds the extension of the page when the layout has none.
+func layoutName(layout, page string) string {
+	if path.Ext(layout) == "" {
+		return layout + path.Ext(page)
+	}
+	return layout
+}
+
+// layoutChain returns the templates to parse for a page, the outermost
+// layout first. layout is used when the page extends none. BeforeRender
+// is fired for the layouts when there is a request, c may be nil.
+func (a *App) layoutChain(c *Action, name, content, layout string) ([]templateFile, error) {
+	next, body, line := parseExtends(content)
+	if next == "" && layout != "" && layoutName(layout, name) != name {
+		next = layout
+	}
+	files := []templateFile{{name, body}}
+	trail := []string{name}
+	current := name
+	for next != "" {
+		next = layoutName(next, name)
+		for _, seen := range trail {
+			if seen == next {
+				return nil, fmt.Errorf("template: %v:%d: layout cycle %v -> %v",
+					current, line, strings.Join(trail, " -> "), next)
+			}
+		}
+		b, err := a.themeContent(c, next)
+		if err != nil {
+			return nil, fmt.Errorf("template: %v:%d: layout %q: %v", current, line, next, err)
+		}
+		source := string(b)
+		if c != nil {
+			Event("BeforeRender", &ActionInformation{c, &source, nil}, func(_ bool) {})
+		}
+		trail = append(trail, next)
+		current = next
+		files = append(files, templateFile{next, ""})
+		next, files[len(files)-1].Source, line = parseExtends(source)
+	}
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+	if len(files) > 1 {
+		files = withContentDefine(files)
+	}
+	return files, nil
+}
+
+// withContentDefine fills the content block with the body of a page which
+// has no content block of its own, unless the body is only blanks.
+func withContentDefine(files []templateFile) []templateFile {
+	page := files[len(files)-1]
+	if contentRegexp.MatchString(page.Source) {
+		return files
+	}
+	trees := make(map[string]*parse.Tree)
+	tree := parse.New(page.Name)
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(page.Source, "", "", trees); err != nil || blankTree(trees[page.Name]) {
+		// a parse error is reported by the compilation
+		return files
+	}
+	return append(files, templateFile{
+		Name:   page.Name + "#content",
+		Source: fmt.Sprintf(`{{define "content"}}{{template %q .}}{{end}}`, page.Name),
+	})
+}
+
+func blankTree(tree *parse.Tree) bool {
+	if tree == nil || tree.Root == nil {
+		return true
+	}
+	for _, node := range tree.Root.Nodes {
+		text, ok := node.(*parse.TextNode)
+		if !ok || len(bytes.TrimSpace(text.Text)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// layout returns the default layout of a route: the layout tag of its
+// Mapper, or AppConfig.Layout. A layout:"-" tag renders without one.
+func (a *App) layout(t reflect.Type, method string) string {
+	if l := a.MapperTag(t, method).Get("layout"); l != "" {
+		if l == "-" {
+			return ""
+		}
+		return l
+	}
+	return a.AppConfig.Layout
+}
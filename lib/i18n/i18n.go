@@ -0,0 +1,243 @@
+// Package i18n keeps message catalogs by locale and translates with
+// plural rules. Catalogs are read from JSON, YAML or gettext .po files,
+// named after their locale, like zh-CN.json or en.po:
+//
+//	bundle := i18n.NewBundle("en")
+//	err := bundle.LoadFS(os.DirFS("locales"), ".")
+//	bundle.Translate("zh-CN", "cart.items", 3) // 购物车里有3件商品
+//
+// A message is either a string or a set of plural forms, by CLDR category:
+//
+//	{"cart.items": {"one": "%d item in the cart", "other": "%d items in the cart"}}
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a translation, with one text for each plural category.
+// A message without plural forms has only "other".
+type Message map[string]string
+
+// Bundle holds the catalogs of all the locales.
+type Bundle struct {
+	Default  string //locale used for the messages a locale does not have
+	catalogs map[string]map[string]Message
+	lock     sync.RWMutex
+}
+
+func NewBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		Default:  Normalize(defaultLocale),
+		catalogs: make(map[string]map[string]Message),
+	}
+}
+
+// Normalize writes a locale the way the bundle keeps it, zh_cn and ZH-CN
+// become zh-CN.
+func Normalize(locale string) string {
+	parts := strings.Split(strings.Replace(strings.TrimSpace(locale), "_", "-", -1), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// language returns the language of a locale, zh of zh-CN.
+func language(locale string) string {
+	if pos := strings.Index(locale, "-"); pos > 0 {
+		return locale[:pos]
+	}
+	return locale
+}
+
+// Add adds messages to the catalog of a locale, existing keys are replaced.
+func (b *Bundle) Add(locale string, messages map[string]Message) {
+	locale = Normalize(locale)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	catalog, ok := b.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]Message, len(messages))
+		b.catalogs[locale] = catalog
+	}
+	for key, msg := range messages {
+		catalog[key] = msg
+	}
+}
+
+// Locales returns the locales which have a catalog.
+func (b *Bundle) Locales() []string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	locales := make([]string, 0, len(b.catalogs))
+	for locale := range b.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Match returns the first of the wanted locales the bundle has, or "".
+// A locale also matches the catalog of its language and the other
+// catalogs of its language, zh-TW is served by zh or else by zh-CN.
+func (b *Bundle) Match(wanted ...string) string {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, locale := range wanted {
+		if locale == "" {
+			continue
+		}
+		locale = Normalize(locale)
+		if _, ok := b.catalogs[locale]; ok {
+			return locale
+		}
+		lang := language(locale)
+		if _, ok := b.catalogs[lang]; ok {
+			return lang
+		}
+		matches := make([]string, 0)
+		for l := range b.catalogs {
+			if language(l) == lang {
+				matches = append(matches, l)
+			}
+		}
+		if len(matches) > 0 {
+			sort.Strings(matches)
+			return matches[0]
+		}
+	}
+	return ""
+}
+
+func (b *Bundle) lookup(locale, key string) (Message, string) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, l := range []string{locale, language(locale), b.Default} {
+		if msg, ok := b.catalogs[l][key]; ok {
+			return msg, l
+		}
+	}
+	return nil, ""
+}
+
+// Has reports whether the key is translated for the locale, directly or
+// by the default locale.
+func (b *Bundle) Has(locale, key string) bool {
+	msg, _ := b.lookup(Normalize(locale), key)
+	return msg != nil
+}
+
+// Translate returns the message of key in the locale, formatted with args
+// by fmt.Sprintf. The first integer of args chooses the plural form.
+// Messages missing in the locale are taken from its language, then from
+// the default locale, else the key itself is formatted.
+func (b *Bundle) Translate(locale, key string, args ...interface{}) string {
+	msg, found := b.lookup(Normalize(locale), key)
+	text := key
+	if msg != nil {
+		text = msg.form(found, args)
+	}
+	if len(args) == 0 || !strings.Contains(text, "%") {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+func (msg Message) form(locale string, args []interface{}) string {
+	if len(msg) > 1 {
+		if n, ok := count(args); ok {
+			if text, ok := msg[Plural(locale, n)]; ok {
+				return text
+			}
+		}
+	}
+	if text, ok := msg["other"]; ok {
+		return text
+	}
+	for _, category := range Categories {
+		if text, ok := msg[category]; ok {
+			return text
+		}
+	}
+	return ""
+}
+
+// count finds the number which decides the plural form.
+func count(args []interface{}) (int64, bool) {
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			return int64(v), true
+		case int8:
+			return int64(v), true
+		case int16:
+			return int64(v), true
+		case int32:
+			return int64(v), true
+		case int64:
+			return v, true
+		case uint:
+			return int64(v), true
+		case uint8:
+			return int64(v), true
+		case uint16:
+			return int64(v), true
+		case uint32:
+			return int64(v), true
+		case uint64:
+			return int64(v), true
+		case float32:
+			return int64(v), true
+		case float64:
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+// ParseAcceptLanguage returns the locales of an Accept-Language header,
+// the preferred first. The wildcard and the locales with q=0 are left out.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	list := make([]weighted, 0)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		locale := strings.TrimSpace(fields[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+	locales := make([]string, len(list))
+	for i, w := range list {
+		locales[i] = w.locale
+	}
+	return locales
+}
@@ -0,0 +1,103 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+var catalogs = fstest.MapFS{
+	"en.json": {Data: []byte(`{
+		"hello": "Hello %s",
+		"cart": {"items": {"one": "%d item", "other": "%d items"}}
+	}`)},
+	"zh-CN.yaml": {Data: []byte(`# 简体中文
+hello: "你好 %s"
+cart:
+  items:
+    other: 购物车里有%d件商品 # 注释
+`)},
+	"messages.ru.po": {Data: []byte(`msgid ""
+msgstr ""
+"Plural-Forms: nplurals=3; plural=(n%10==1 && n%100!=11 ? 0 : n%10>=2 && n%10<=4 && (n%100<10 || n%100>=20) ? 1 : 2);\n"
+
+msgid "cart.items"
+msgid_plural "%d items"
+msgstr[0] "%d товар"
+msgstr[1] "%d товара"
+msgstr[2] "%d "
+"товаров"
+
+#, fuzzy
+msgid "hello"
+msgstr "Привет %s"
+
+msgctxt "menu"
+msgid "hello"
+msgstr "Меню"
+`)},
+}
+
+func TestTranslate(t *testing.T) {
+	b := NewBundle("en")
+	if err := b.LoadFS(catalogs, "."); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		locale, key string
+		args        []interface{}
+		expected    string
+	}{
+		{"en", "hello", []interface{}{"bob"}, "Hello bob"},
+		{"en-US", "cart.items", []interface{}{1}, "1 item"},
+		{"en", "cart.items", []interface{}{2}, "2 items"},
+		{"zh-cn", "hello", []interface{}{"bob"}, "你好 bob"},
+		{"zh-CN", "cart.items", []interface{}{1}, "购物车里有1件商品"},
+		{"ru", "cart.items", []interface{}{21}, "21 товар"},
+		{"ru", "cart.items", []interface{}{3}, "3 товара"},
+		{"ru", "cart.items", []interface{}{11}, "11 товаров"},
+		{"ru", "hello", []interface{}{"bob"}, "Hello bob"},
+		{"fr", "missing %d", []interface{}{1}, "missing 1"},
+	} {
+		if s := b.Translate(c.locale, c.key, c.args...); s != c.expected {
+			t.Errorf("%v %v: expected %q, got %q", c.locale, c.key, c.expected, s)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	b := NewBundle("en")
+	b.Add("en", map[string]Message{"a": {"other": "a"}})
+	b.Add("zh_CN", map[string]Message{"a": {"other": "a"}})
+	for wanted, expected := range map[string]string{
+		"zh-TW": "zh-CN",
+		"EN-gb": "en",
+		"fr":    "",
+	} {
+		if locale := b.Match(wanted); locale != expected {
+			t.Errorf("%v: expected %q, got %q", wanted, expected, locale)
+		}
+	}
+	if locale := b.Match("fr", "zh"); locale != "zh-CN" {
+		t.Errorf("the second locale should match, got %q", locale)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	locales := ParseAcceptLanguage("fr;q=0.5, zh-CN, en;q=0.8, *;q=0.1, de;q=0")
+	if len(locales) != 3 || locales[0] != "zh-CN" || locales[1] != "en" || locales[2] != "fr" {
+		t.Errorf("unexpected order %v", locales)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, data := range []string{
+		"a:\nb: c",
+		"a: |\n  text",
+		"a:\n  b: c\n d: e",
+		"a: \"open",
+	} {
+		if _, err := ParseYAML([]byte(data)); err == nil {
+			t.Errorf("%q should not parse", data)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package i18n
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// LoadFS loads all the catalogs of a directory of fsys.
+func (b *Bundle) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch path.Ext(entry.Name()) {
+		case ".json", ".yaml", ".yml", ".po":
+			if err := b.LoadFile(fsys, path.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFile loads a catalog, its locale is the last part of the file name
+// before the extension: zh-CN.json and messages.zh-CN.json are zh-CN.
+func (b *Bundle) LoadFile(fsys fs.FS, name string) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	ext := path.Ext(name)
+	locale := strings.TrimSuffix(path.Base(name), ext)
+	if pos := strings.LastIndex(locale, "."); pos >= 0 {
+		locale = locale[pos+1:]
+	}
+	var messages map[string]Message
+	switch ext {
+	case ".json":
+		messages, err = ParseJSON(data)
+	case ".yaml", ".yml":
+		messages, err = ParseYAML(data)
+	case ".po":
+		messages, err = ParsePO(data, locale)
+	default:
+		err = fmt.Errorf("unknown catalog format %v", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("i18n: %v: %v", name, err)
+	}
+	b.Add(locale, messages)
+	return nil
+}
+
+// ParseJSON reads a catalog of JSON objects. Nested objects are joined
+// into keys with dots, unless all their keys are plural categories.
+func ParseJSON(data []byte) (map[string]Message, error) {
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	messages := make(map[string]Message)
+	return messages, flatten("", tree, messages)
+}
+
+func isPlural(tree map[string]interface{}) bool {
+	if len(tree) == 0 {
+		return false
+	}
+	for key, value := range tree {
+		if _, ok := value.(string); !ok {
+			return false
+		}
+		var known bool
+		for _, category := range Categories {
+			if key == category {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return false
+		}
+	}
+	return true
+}
+
+func flatten(prefix string, tree map[string]interface{}, messages map[string]Message) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case string:
+			messages[key] = Message{"other": v}
+		case map[string]interface{}:
+			if isPlural(v) {
+				msg := make(Message, len(v))
+				for category, text := range v {
+					msg[category] = text.(string)
+				}
+				messages[key] = msg
+			} else if err := flatten(key, v, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%v: a message should be a string or an object, not %T", key, value)
+		}
+	}
+	return nil
+}
+
+// ParseYAML reads a catalog written in the subset of YAML which catalogs
+// need: nested mappings of plain or quoted strings, and comments.
+//
+//	cart:
+//	  title: Your cart
+//	  items:
+//	    one: "%d item"
+//	    other: "%d items"
+func ParseYAML(data []byte) (map[string]Message, error) {
+	type level struct {
+		indent int
+		tree   map[string]interface{}
+	}
+	root := make(map[string]interface{})
+	stack := []level{{-1, root}}
+	var pending string //key of a mapping which has no entry yet
+	pendingIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' || line == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can not indent", lineno)
+		}
+		indent := len(line) - len(trimmed)
+		if pending != "" {
+			if indent <= pendingIndent {
+				return nil, fmt.Errorf("line %d: %v has no value", lineno, pending)
+			}
+			tree := make(map[string]interface{})
+			stack[len(stack)-1].tree[pending] = tree
+			stack = append(stack, level{indent, tree})
+			pending = ""
+		}
+		if stack[0].indent < 0 {
+			stack[0].indent = indent
+		}
+		for indent < stack[len(stack)-1].indent && len(stack) > 1 {
+			stack = stack[:len(stack)-1]
+		}
+		if indent != stack[len(stack)-1].indent {
+			return nil, fmt.Errorf("line %d: bad indentation", lineno)
+		}
+
+		key, rest, err := yamlKey(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+		if rest == "" {
+			pending, pendingIndent = key, indent
+			continue
+		}
+		value, err := yamlValue(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+		stack[len(stack)-1].tree[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("%v has no value", pending)
+	}
+	messages := make(map[string]Message)
+	return messages, flatten("", root, messages)
+}
+
+// yamlKey splits "key: value", the key may be quoted.
+func yamlKey(line string) (key, rest string, err error) {
+	if line[0] == '"' || line[0] == '\'' {
+		end := strings.IndexByte(line[1:], line[0])
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated key")
+		}
+		key, rest = line[1:end+1], line[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("missing : after the key")
+		}
+		return key, strings.TrimSpace(rest[1:]), nil
+	}
+	pos := strings.Index(line, ": ")
+	if pos < 0 {
+		if strings.HasSuffix(line, ":") {
+			return strings.TrimSpace(line[:len(line)-1]), "", nil
+		}
+		return "", "", fmt.Errorf("expected key: value")
+	}
+	return strings.TrimSpace(line[:pos]), strings.TrimSpace(line[pos+2:]), nil
+}
+
+func yamlValue(s string) (string, error) {
+	switch s[0] {
+	case '"':
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\\' {
+				end++
+			} else if s[end] == '"' {
+				break
+			}
+		}
+		if end >= len(s) {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if tail := strings.TrimSpace(s[end+1:]); tail != "" && tail[0] != '#' {
+			return "", fmt.Errorf("unexpected %v after the string", tail)
+		}
+		return strconv.Unquote(s[:end+1])
+	case '\'':
+		var buf strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					buf.WriteByte('\'')
+					i++
+					continue
+				}
+				if tail := strings.TrimSpace(s[i+1:]); tail != "" && tail[0] != '#' {
+					return "", fmt.Errorf("unexpected %v after the string", tail)
+				}
+				return buf.String(), nil
+			}
+			buf.WriteByte(s[i])
+		}
+		return "", fmt.Errorf("unterminated string")
+	case '|', '>', '[', '{', '&', '*':
+		return "", fmt.Errorf("unsupported YAML %q, quote the message", s)
+	}
+	if s == "-" || strings.HasPrefix(s, "- ") {
+		return "", fmt.Errorf("unsupported YAML list %q, quote the message", s)
+	}
+	if pos := strings.Index(s, " #"); pos >= 0 {
+		s = strings.TrimSpace(s[:pos])
+	}
+	return s, nil
+}
+
+// ParsePO reads a gettext catalog. The msgid is the key, msgstr[n] are
+// mapped to the plural categories of the locale. Fuzzy and untranslated
+// entries are skipped, and the ones with a msgctxt, which keys can not
+// express.
+func ParsePO(data []byte, locale string) (map[string]Message, error) {
+	messages := make(map[string]Message)
+	forms := Rule(locale).Forms
+
+	var (
+		msgid, plural string
+		strs          map[int]string
+		fuzzy, skip   bool
+		appendTo      func(s string)
+	)
+	flush := func() {
+		if msgid != "" && !fuzzy && !skip {
+			msg := make(Message)
+			for i, text := range strs {
+				if text == "" {
+					continue
+				}
+				if plural == "" {
+					msg["other"] = text
+				} else if i < len(forms) {
+					msg[forms[i]] = text
+				}
+			}
+			if len(msg) > 0 {
+				messages[msgid] = msg
+			}
+		}
+		msgid, plural, strs, fuzzy, skip, appendTo = "", "", nil, false, false, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		if line[0] == '#' {
+			if strings.HasPrefix(line, "#,") {
+				if strs != nil {
+					flush()
+				}
+				fuzzy = strings.Contains(line, "fuzzy")
+			}
+			continue
+		}
+		if line[0] == '"' {
+			if appendTo == nil {
+				return nil, fmt.Errorf("line %d: string without keyword", lineno)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineno, err)
+			}
+			appendTo(s)
+			continue
+		}
+
+		keyword, value := line, ""
+		if pos := strings.IndexByte(line, ' '); pos > 0 {
+			keyword, value = line[:pos], strings.TrimSpace(line[pos+1:])
+		}
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineno, err)
+		}
+		switch {
+		case keyword == "msgctxt" || keyword == "msgid":
+			if strs != nil {
+				flush()
+			}
+			if keyword == "msgctxt" {
+				skip = true
+				appendTo = func(string) {}
+			} else {
+				msgid = s
+				appendTo = func(s string) { msgid += s }
+			}
+		case keyword == "msgid_plural":
+			plural = s
+			appendTo = func(s string) { plural += s }
+		case keyword == "msgstr" || strings.HasPrefix(keyword, "msgstr[") && strings.HasSuffix(keyword, "]"):
+			index := 0
+			if keyword != "msgstr" {
+				if index, err = strconv.Atoi(keyword[7 : len(keyword)-1]); err != nil {
+					return nil, fmt.Errorf("line %d: unknown keyword %v", lineno, keyword)
+				}
+			}
+			if strs == nil {
+				strs = make(map[int]string)
+			}
+			strs[index] = s
+			appendTo = func(s string) { strs[index] += s }
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %v", lineno, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return messages, nil
+}
@@ -0,0 +1,104 @@
+package i18n
+
+// Categories are the CLDR plural categories.
+var Categories = []string{"zero", "one", "two", "few", "many", "other"}
+
+// PluralRule chooses the plural category of a number in a language.
+// Forms are its categories in the order of the msgstr[n] of .po files.
+type PluralRule struct {
+	Forms []string
+	Form  func(n int64) string
+}
+
+var (
+	oneOther = &PluralRule{[]string{"one", "other"}, func(n int64) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}}
+	zeroOneOther = &PluralRule{[]string{"one", "other"}, func(n int64) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	}}
+	otherOnly = &PluralRule{[]string{"other"}, func(n int64) string {
+		return "other"
+	}}
+	slavic = &PluralRule{[]string{"one", "few", "many"}, func(n int64) string {
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	}}
+	polish = &PluralRule{[]string{"one", "few", "many"}, func(n int64) string {
+		switch {
+		case n == 1:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		}
+		return "many"
+	}}
+	czech = &PluralRule{[]string{"one", "few", "other"}, func(n int64) string {
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		}
+		return "other"
+	}}
+	arabic = &PluralRule{[]string{"zero", "one", "two", "few", "many", "other"}, func(n int64) string {
+		switch {
+		case n == 0:
+			return "zero"
+		case n == 1:
+			return "one"
+		case n == 2:
+			return "two"
+		case n%100 >= 3 && n%100 <= 10:
+			return "few"
+		case n%100 >= 11:
+			return "many"
+		}
+		return "other"
+	}}
+)
+
+// PluralRules are the rules by language, the languages which are not
+// listed use the English one.
+var PluralRules = map[string]*PluralRule{
+	"en": oneOther, "de": oneOther, "nl": oneOther, "sv": oneOther,
+	"da": oneOther, "no": oneOther, "nb": oneOther, "fi": oneOther,
+	"it": oneOther, "es": oneOther, "pt": oneOther, "el": oneOther,
+	"hu": oneOther, "tr": oneOther, "bg": oneOther, "et": oneOther,
+	"fr": zeroOneOther, "hi": zeroOneOther,
+	"zh": otherOnly, "ja": otherOnly, "ko": otherOnly, "vi": otherOnly,
+	"th": otherOnly, "id": otherOnly, "ms": otherOnly,
+	"ru": slavic, "uk": slavic, "be": slavic, "sr": slavic, "hr": slavic,
+	"bs": slavic,
+	"pl": polish,
+	"cs": czech, "sk": czech,
+	"ar": arabic,
+}
+
+// Rule returns the plural rule of a locale.
+func Rule(locale string) *PluralRule {
+	if rule, ok := PluralRules[language(Normalize(locale))]; ok {
+		return rule
+	}
+	return oneOther
+}
+
+// Plural returns the plural category of n in the locale.
+func Plural(locale string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	return Rule(locale).Form(n)
+}
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+)
+
+// JWK is a public key of a JSON Web Key Set, RSA and Ed25519 are supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+func NewRSAJWK(kid string, key *rsa.PublicKey) JWK {
+	return JWK{Kty: "RSA", Kid: kid, Use: "sig", Alg: RS256,
+		N: encode(key.N.Bytes()),
+		E: encode(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func NewEd25519JWK(kid string, key ed25519.PublicKey) JWK {
+	return JWK{Kty: "OKP", Kid: kid, Use: "sig", Alg: EdDSA, Crv: "Ed25519", X: encode(key)}
+}
+
+// PublicKey returns *rsa.PublicKey or ed25519.PublicKey.
+func (k *JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, ErrKey
+		}
+		e, err := decode(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, ErrKey
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		x, err := decode(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrKey
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrKey
+}
+
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func ParseKeySet(b []byte) (*KeySet, error) {
+	set := &KeySet{}
+	if err := json.Unmarshal(b, set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// Key finds the key of the kid, a token without kid may use the only key.
+func (s *KeySet) Key(kid string) (interface{}, error) {
+	for i := range s.Keys {
+		k := &s.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if k.Kid == kid || kid == "" && len(s.Keys) == 1 {
+			return k.PublicKey()
+		}
+	}
+	return nil, ErrKey
+}
+
+func (s *KeySet) KeyFunc() KeyFunc {
+	return func(h *Header) (interface{}, error) {
+		return s.Key(h.Kid)
+	}
+}
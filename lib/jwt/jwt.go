@@ -0,0 +1,269 @@
+// Package jwt signs and validates JSON Web Tokens with HS256, RS256 and
+// EdDSA, without talking to any server.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed = errors.New("jwt: malformed token")
+	ErrAlgorithm = errors.New("jwt: algorithm not allowed")
+	ErrSignature = errors.New("jwt: invalid signature")
+	ErrExpired   = errors.New("jwt: token is expired")
+	ErrNotYet    = errors.New("jwt: token is not valid yet")
+	ErrIssuer    = errors.New("jwt: unexpected issuer")
+	ErrAudience  = errors.New("jwt: unexpected audience")
+	ErrKey       = errors.New("jwt: no key for the token")
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings reads a claim which is a string or a list of strings, like aud.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		r := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				r = append(r, s)
+			}
+		}
+		return r
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// Time reads a NumericDate claim like exp.
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+type Token struct {
+	Raw    string
+	Header Header
+	Claims Claims
+}
+
+// KeyFunc returns the key which verifies a token: []byte for HS256,
+// *rsa.PublicKey for RS256 and ed25519.PublicKey for EdDSA.
+type KeyFunc func(header *Header) (interface{}, error)
+
+// Validator checks the signature and the registered claims of tokens.
+type Validator struct {
+	Algorithms []string //allowed algorithms, required
+	KeyFunc    KeyFunc
+	Issuer     string //checked when not empty
+	Audience   string //checked when not empty
+	Leeway     time.Duration
+	Now        func() time.Time
+}
+
+func NewValidator(key interface{}, algorithms ...string) *Validator {
+	return &Validator{
+		Algorithms: algorithms,
+		KeyFunc: func(*Header) (interface{}, error) {
+			return key, nil
+		},
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (v *Validator) Parse(raw string) (*Token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	token := &Token{Raw: raw}
+	b, err := decode(parts[0])
+	if err != nil || json.Unmarshal(b, &token.Header) != nil {
+		return nil, ErrMalformed
+	}
+	var allowed bool
+	for _, alg := range v.Algorithms {
+		if alg == token.Header.Alg {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, ErrAlgorithm
+	}
+	sig, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	key, err := v.KeyFunc(&token.Header)
+	if err != nil {
+		return nil, err
+	}
+	if err = verify(token.Header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	b, err = decode(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err = json.Unmarshal(b, &token.Claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return token, v.validate(token.Claims)
+}
+
+func (v *Validator) validate(claims Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if exp, ok := claims.Time("exp"); ok && !now.Before(exp.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrNotYet
+	}
+	if v.Issuer != "" && claims.String("iss") != v.Issuer {
+		return ErrIssuer
+	}
+	if v.Audience != "" {
+		var found bool
+		for _, aud := range claims.Strings("aud") {
+			if aud == v.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrAudience
+		}
+	}
+	return nil
+}
+
+// verify checks the key type too, so that a public RSA key can never be
+// used as an HMAC secret.
+func verify(alg string, key interface{}, signed string, sig []byte) error {
+	switch alg {
+	case HS256:
+		k, ok := key.([]byte)
+		if !ok {
+			return ErrKey
+		}
+		hm := hmac.New(sha256.New, k)
+		hm.Write([]byte(signed))
+		if !hmac.Equal(hm.Sum(nil), sig) {
+			return ErrSignature
+		}
+	case RS256:
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrKey
+		}
+		sum := sha256.Sum256([]byte(signed))
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) != nil {
+			return ErrSignature
+		}
+	case EdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrKey
+		}
+		if !ed25519.Verify(k, []byte(signed), sig) {
+			return ErrSignature
+		}
+	default:
+		return ErrAlgorithm
+	}
+	return nil
+}
+
+// Sign creates a token. key is []byte for HS256, *rsa.PrivateKey for RS256
+// and ed25519.PrivateKey for EdDSA.
+func Sign(alg string, key interface{}, claims Claims, kid string) (string, error) {
+	h, err := json.Marshal(&Header{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encode(h) + "." + encode(c)
+	var sig []byte
+	switch alg {
+	case HS256:
+		k, ok := key.([]byte)
+		if !ok {
+			return "", ErrKey
+		}
+		hm := hmac.New(sha256.New, k)
+		hm.Write([]byte(signed))
+		sig = hm.Sum(nil)
+	case RS256:
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return "", ErrKey
+		}
+		sum := sha256.Sum256([]byte(signed))
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:]); err != nil {
+			return "", err
+		}
+	case EdDSA:
+		k, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return "", ErrKey
+		}
+		sig = ed25519.Sign(k, []byte(signed))
+	default:
+		return "", ErrAlgorithm
+	}
+	return signed + "." + encode(sig), nil
+}
@@ -0,0 +1,77 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignAndParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	claims := Claims{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix(), "aud": []string{"app"}}
+
+	cases := []struct {
+		alg       string
+		signKey   interface{}
+		verifyKey interface{}
+	}{
+		{HS256, []byte("secret"), []byte("secret")},
+		{RS256, rsaKey, &rsaKey.PublicKey},
+		{EdDSA, edKey, edPub},
+	}
+	for _, c := range cases {
+		raw, err := Sign(c.alg, c.signKey, claims, "")
+		if err != nil {
+			t.Fatal(c.alg, err)
+		}
+		v := NewValidator(c.verifyKey, c.alg)
+		v.Audience = "app"
+		token, err := v.Parse(raw)
+		if err != nil || token.Claims.String("sub") != "alice" {
+			t.Errorf("%s: %v %v", c.alg, token, err)
+		}
+		// the last characters may only carry padding bits, change the first
+		// character of the signature instead
+		sig := strings.LastIndex(raw, ".") + 1
+		forged := raw[:sig] + "A" + raw[sig+1:]
+		if raw[sig] == 'A' {
+			forged = raw[:sig] + "B" + raw[sig+1:]
+		}
+		if _, err = v.Parse(forged); err != ErrSignature {
+			t.Errorf("%s: forged signature gave %v", c.alg, err)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	key := []byte("secret")
+	v := NewValidator(key, HS256)
+
+	raw, _ := Sign(HS256, key, Claims{"exp": time.Now().Add(-time.Minute).Unix()}, "")
+	if _, err := v.Parse(raw); err != ErrExpired {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+	v.Leeway = 2 * time.Minute
+	if _, err := v.Parse(raw); err != nil {
+		t.Errorf("leeway should accept the token, got %v", err)
+	}
+
+	raw, _ = Sign(HS256, key, Claims{"iss": "other"}, "")
+	v.Issuer = "me"
+	if _, err := v.Parse(raw); err != ErrIssuer {
+		t.Errorf("expected ErrIssuer, got %v", err)
+	}
+
+	// an RS256 validator must not accept an HS256 token
+	rs := NewValidator(key, RS256)
+	if _, err := rs.Parse(raw); err != ErrAlgorithm {
+		t.Errorf("expected ErrAlgorithm, got %v", err)
+	}
+}
@@ -0,0 +1,502 @@
+// Package markdown converts the common part of Markdown to HTML which is
+// safe to put in a page, for comments or descriptions written by users.
+// The HTML of the source is escaped, not rendered, and links and images
+// keep only the urls of http, https and mailto, or relative ones.
+//
+// Supported: paragraphs, hard line breaks (two trailing spaces), headings
+// (#), block quotes, lists, fenced and indented code, horizontal rules,
+// emphasis, strong, code spans, links, images, autolinks (<http://...>)
+// and backslash escapes.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingRegexp = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRegexp    = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	bulletRegexp  = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	orderedRegexp = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	fenceRegexp   = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([\\w+#.-]*)")
+	quoteRegexp   = regexp.MustCompile(`^ {0,3}>[ ]?(.*)$`)
+	autoRegexp    = regexp.MustCompile(`^<((?:https?://|mailto:)[^<>\s]+)>`)
+)
+
+// maxDepth bounds the nesting of quotes and lists, and the one of links
+// and emphasis. Deeper ones are left as text, they would make every level
+// go over the text again.
+const maxDepth = 16
+
+// ToHTML converts markdown to HTML.
+func ToHTML(src string) string {
+	src = strings.Replace(strings.Replace(src, "\r\n", "\n", -1), "\r", "\n", -1)
+	var buf strings.Builder
+	blocks(&buf, strings.Split(src, "\n"), 0)
+	return buf.String()
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// blocks writes the blocks of lines, depth is the nesting of quotes and lists.
+func blocks(buf *strings.Builder, lines []string, depth int) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRegexp.MatchString(line):
+			i = fenced(buf, lines, i)
+		case strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"):
+			i = indented(buf, lines, i)
+		case headingRegexp.MatchString(strings.TrimLeft(line, " ")):
+			m := headingRegexp.FindStringSubmatch(strings.TrimLeft(line, " "))
+			level := string(rune('0' + len(m[1])))
+			buf.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+			i++
+		case ruleRegexp.MatchString(line):
+			buf.WriteString("<hr>\n")
+			i++
+		case depth >= maxDepth:
+			i = paragraph(buf, lines, i)
+		case quoteRegexp.MatchString(line):
+			i = quote(buf, lines, i, depth)
+		case bulletRegexp.MatchString(line):
+			i = list(buf, lines, i, depth, bulletRegexp, "ul")
+		case orderedRegexp.MatchString(line):
+			i = list(buf, lines, i, depth, orderedRegexp, "ol")
+		default:
+			i = paragraph(buf, lines, i)
+		}
+	}
+}
+
+// startsBlock tells whether a line ends a paragraph.
+func startsBlock(line string) bool {
+	return isBlank(line) || fenceRegexp.MatchString(line) ||
+		headingRegexp.MatchString(strings.TrimLeft(line, " ")) || ruleRegexp.MatchString(line) ||
+		quoteRegexp.MatchString(line) || bulletRegexp.MatchString(line) || orderedRegexp.MatchString(line)
+}
+
+func paragraph(buf *strings.Builder, lines []string, i int) int {
+	text := make([]string, 0)
+	for ; i < len(lines) && (len(text) == 0 || !startsBlock(lines[i])); i++ {
+		text = append(text, lines[i])
+	}
+	buf.WriteString("<p>" + inlineLines(text) + "</p>\n")
+	return i
+}
+
+// inlineLines joins the lines of a paragraph, two trailing spaces break
+// the line.
+func inlineLines(lines []string) string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		brk := i < len(lines)-1 && strings.HasSuffix(line, "  ")
+		out[i] = inline(strings.TrimSpace(line))
+		if brk {
+			out[i] += "<br>"
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func fenced(buf *strings.Builder, lines []string, i int) int {
+	m := fenceRegexp.FindStringSubmatch(lines[i])
+	fence, lang := m[1], m[2]
+	code := make([]string, 0)
+	for i++; i < len(lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+	buf.WriteString("<pre><code")
+	if lang != "" {
+		buf.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+	}
+	buf.WriteString(">")
+	for _, line := range code {
+		buf.WriteString(html.EscapeString(line) + "\n")
+	}
+	buf.WriteString("</code></pre>\n")
+	return i
+}
+
+func indented(buf *strings.Builder, lines []string, i int) int {
+	code := make([]string, 0)
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "    ") {
+			line = line[4:]
+		} else if strings.HasPrefix(line, "\t") {
+			line = line[1:]
+		} else if !isBlank(line) {
+			break
+		} else {
+			line = ""
+		}
+		code = append(code, line)
+	}
+	for len(code) > 0 && code[len(code)-1] == "" {
+		code = code[:len(code)-1]
+	}
+	buf.WriteString("<pre><code>")
+	for _, line := range code {
+		buf.WriteString(html.EscapeString(line) + "\n")
+	}
+	buf.WriteString("</code></pre>\n")
+	return i
+}
+
+func quote(buf *strings.Builder, lines []string, i, depth int) int {
+	inner := make([]string, 0)
+	for ; i < len(lines); i++ {
+		if m := quoteRegexp.FindStringSubmatch(lines[i]); m != nil {
+			inner = append(inner, m[1])
+		} else if isBlank(lines[i]) || startsBlock(lines[i]) {
+			break
+		} else {
+			// a lazy continuation of the quoted paragraph
+			inner = append(inner, lines[i])
+		}
+	}
+	buf.WriteString("<blockquote>\n")
+	blocks(buf, inner, depth+1)
+	buf.WriteString("</blockquote>\n")
+	return i
+}
+
+// list writes a list, an item goes on with the indented lines after it.
+func list(buf *strings.Builder, lines []string, i, depth int, marker *regexp.Regexp, tag string) int {
+	items := make([][]string, 0)
+	open := "<" + tag + ">"
+	if m := marker.FindStringSubmatch(lines[i]); tag == "ol" && strings.TrimLeft(m[1], "0") != "1" {
+		open = `<ol start="` + strings.TrimLeft(m[1], "0") + `">`
+	}
+	// the lines of an item are indented by two more spaces than its marker
+	indent := leading(lines[i]) + 2
+	var loose, blank bool
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := marker.FindStringSubmatch(line); m != nil && leading(line) < indent {
+			if blank {
+				loose = true
+			}
+			items = append(items, []string{m[len(m)-1]})
+			blank = false
+			continue
+		}
+		if isBlank(line) {
+			blank = true
+			continue
+		}
+		if leading(line) < indent && (blank || startsBlock(line)) {
+			break
+		}
+		if blank {
+			loose = true
+			items[len(items)-1] = append(items[len(items)-1], "")
+		}
+		blank = false
+		items[len(items)-1] = append(items[len(items)-1], unindent(line, indent))
+	}
+	buf.WriteString(open + "\n")
+	for _, item := range items {
+		buf.WriteString("<li>")
+		if loose || len(item) > 1 && hasBlock(item[1:]) {
+			buf.WriteString("\n")
+			blocks(buf, item, depth+1)
+		} else {
+			buf.WriteString(inlineLines(item))
+		}
+		buf.WriteString("</li>\n")
+	}
+	buf.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// leading counts the spaces which indent a line, a tab is four.
+func leading(line string) int {
+	n := 0
+	for _, c := range line {
+		switch c {
+		case ' ':
+			n++
+		case '\t':
+			n += 4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// unindent removes up to n spaces of indentation.
+func unindent(line string, n int) string {
+	for n > 0 && line != "" {
+		switch line[0] {
+		case ' ':
+			n--
+		case '\t':
+			n -= 4
+		default:
+			return line
+		}
+		line = line[1:]
+	}
+	return line
+}
+
+func hasBlock(lines []string) bool {
+	for _, line := range lines {
+		if startsBlock(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeURL keeps relative urls and the ones of http, https and mailto.
+func safeURL(url string) (string, bool) {
+	url = strings.TrimSpace(url)
+	if pos := strings.IndexAny(url, ":/?#"); pos >= 0 && url[pos] == ':' {
+		switch strings.ToLower(url[:pos]) {
+		case "http", "https", "mailto":
+		default:
+			return "", false
+		}
+	}
+	return url, true
+}
+
+// spans finds the spans of a text. Every opener used to look for its
+// closer up to the end of the text, so that a text full of openers took
+// quadratic time. The brackets are matched once, and a delimiter which
+// found no closer is not looked for again: the closers of a later opener
+// are among the ones the earlier opener went through.
+type spans struct {
+	s        string
+	closing  []int //the index of the ] of the [ at i, -1 without one
+	paren    []int //the index of the first ) from i on, len(s) without one
+	noCloser map[string]bool
+}
+
+func newSpans(s string) *spans {
+	return &spans{s: s, noCloser: make(map[string]bool)}
+}
+
+// brackets matches the brackets and finds the parentheses, once.
+func (sp *spans) brackets() {
+	if sp.closing != nil {
+		return
+	}
+	s := sp.s
+	sp.closing = make([]int, len(s))
+	open := make([]int, 0)
+	for i := 0; i < len(s); i++ {
+		sp.closing[i] = -1
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sp.closing[i] = -1
+			}
+		case '[':
+			open = append(open, i)
+		case ']':
+			if len(open) > 0 {
+				sp.closing[open[len(open)-1]] = i
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	sp.paren = make([]int, len(s)+1)
+	sp.paren[len(s)] = len(s)
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == ')' {
+			sp.paren[i] = i
+		} else {
+			sp.paren[i] = sp.paren[i+1]
+		}
+	}
+}
+
+// inline converts the spans of a text.
+func inline(s string) string {
+	return inlineDepth(s, 0)
+}
+
+func inlineDepth(s string, depth int) string {
+	if depth >= maxDepth {
+		return html.EscapeString(s)
+	}
+	sp := newSpans(s)
+	var buf strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!<>|~\"'", s[i+1]) >= 0:
+			buf.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			if n, code, ok := sp.codeSpan(i); ok {
+				buf.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += n
+				continue
+			}
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if n, text, url, ok := sp.link(i + 1); ok {
+				if u, safe := safeURL(url); safe {
+					buf.WriteString(`<img src="` + html.EscapeString(u) + `" alt="` + html.EscapeString(text) + `">`)
+				} else {
+					buf.WriteString(html.EscapeString(text))
+				}
+				i += n + 1
+				continue
+			}
+		case c == '[':
+			if n, text, url, ok := sp.link(i); ok {
+				if u, safe := safeURL(url); safe {
+					buf.WriteString(`<a href="` + html.EscapeString(u) + `">` + inlineDepth(text, depth+1) + `</a>`)
+				} else {
+					buf.WriteString(inlineDepth(text, depth+1))
+				}
+				i += n
+				continue
+			}
+		case c == '<':
+			if m := autoRegexp.FindStringSubmatch(s[i:]); m != nil {
+				u := html.EscapeString(m[1])
+				buf.WriteString(`<a href="` + u + `">` + html.EscapeString(strings.TrimPrefix(m[1], "mailto:")) + `</a>`)
+				i += len(m[0])
+				continue
+			}
+		case c == '*' || c == '_':
+			if n, inner, strong, ok := sp.emphasis(i); ok {
+				if strong {
+					buf.WriteString("<strong>" + inlineDepth(inner, depth+1) + "</strong>")
+				} else {
+					buf.WriteString("<em>" + inlineDepth(inner, depth+1) + "</em>")
+				}
+				i += n
+				continue
+			}
+		}
+		buf.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return buf.String()
+}
+
+// codeSpan matches a code span at s[i], it ends with as many backticks as
+// it starts with, so that the code can have backticks.
+func (sp *spans) codeSpan(i int) (int, string, bool) {
+	s := sp.s[i:]
+	n := 0
+	for n < len(s) && s[n] == '`' {
+		n++
+	}
+	fence := s[:n]
+	if sp.noCloser[fence] {
+		return 0, "", false
+	}
+	for pos := n; pos < len(s); {
+		end := strings.Index(s[pos:], fence)
+		if end < 0 {
+			break
+		}
+		end += pos
+		// the closing run has to have the same length
+		if end+n < len(s) && s[end+n] == '`' {
+			pos = end + n
+			for pos < len(s) && s[pos] == '`' {
+				pos++
+			}
+			continue
+		}
+		code := s[n:end]
+		if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+			code = code[1 : len(code)-1]
+		}
+		return end + n, code, true
+	}
+	sp.noCloser[fence] = true
+	return 0, "", false
+}
+
+// link matches [text](url) or [text](url "title") at s[i], the title is
+// dropped.
+func (sp *spans) link(i int) (int, string, string, bool) {
+	sp.brackets()
+	s := sp.s
+	end := sp.closing[i]
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return 0, "", "", false
+	}
+	paren := sp.paren[end+2]
+	if paren == len(s) {
+		return 0, "", "", false
+	}
+	dest := strings.TrimSpace(s[end+2 : paren])
+	if pos := strings.IndexAny(dest, " \t"); pos >= 0 {
+		dest = dest[:pos]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return paren + 1 - i, s[i+1 : end], dest, true
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// emphasis matches *em*, _em_, **strong** and __strong__ at s[i]. The
+// underscores do not work inside words, like in snake_case.
+func (sp *spans) emphasis(i int) (int, string, bool, bool) {
+	s := sp.s
+	c := s[i]
+	n := 1
+	if i+1 < len(s) && s[i+1] == c {
+		n = 2
+	}
+	delim := s[i : i+n]
+	start := i + n
+	if start >= len(s) || s[start] == ' ' || s[start] == c && n == 2 {
+		return 0, "", false, false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0, "", false, false
+	}
+	if sp.noCloser[delim] {
+		return 0, "", false, false
+	}
+	for pos := start; pos < len(s); {
+		end := strings.Index(s[pos:], delim)
+		if end < 0 {
+			break
+		}
+		end += pos
+		run := 0
+		for end+run < len(s) && s[end+run] == c {
+			run++
+		}
+		after := end + n
+		switch {
+		case end == start || s[end-1] == ' ':
+		case n == 1 && run > 1:
+			// a strong delimiter inside the emphasis
+		case c == '_' && after < len(s) && isWordByte(s[after]):
+		default:
+			return after - i, s[start:end], n == 2, true
+		}
+		pos = end + run
+	}
+	sp.noCloser[delim] = true
+	return 0, "", false, false
+}
@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToHTML(t *testing.T) {
+	cases := []struct {
+		src, html string
+	}{
+		{"hello *world*", "<p>hello <em>world</em></p>\n"},
+		{"**bold** and __strong__ and snake_case_name", "<p><strong>bold</strong> and <strong>strong</strong> and snake_case_name</p>\n"},
+		{"*em **strong** em*", "<p><em>em <strong>strong</strong> em</em></p>\n"},
+		{"2 * 3 * 4", "<p>2 * 3 * 4</p>\n"},
+		{"# Title #\n\n### Sub", "<h1>Title</h1>\n<h3>Sub</h3>\n"},
+		{"#hashtag", "<p>#hashtag</p>\n"},
+		{"line one  \nline two\nline three", "<p>line one<br>\nline two\nline three</p>\n"},
+		{"use `a < b` or ``x ` y``", "<p>use <code>a &lt; b</code> or <code>x ` y</code></p>\n"},
+		{"\\*not em\\*", "<p>*not em*</p>\n"},
+		{"```go\nif a < b {\n}\n```", "<pre><code class=\"language-go\">if a &lt; b {\n}\n</code></pre>\n"},
+		{"    indented <code>\n\npara", "<pre><code>indented &lt;code&gt;\n</code></pre>\n<p>para</p>\n"},
+		{"> quoted\ncontinued\n\nafter", "<blockquote>\n<p>quoted\ncontinued</p>\n</blockquote>\n<p>after</p>\n"},
+		{"- one\n- two\n  more\n* three", "<ul>\n<li>one</li>\n<li>two\nmore</li>\n<li>three</li>\n</ul>\n"},
+		{"3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"- a\n  - b\n  - c", "<ul>\n<li>\n<p>a</p>\n<ul>\n<li>b</li>\n<li>c</li>\n</ul>\n</li>\n</ul>\n"},
+		{"para\n---\n", "<p>para</p>\n<hr>\n"},
+		{"[xweb](https://github.com/coscms/xweb \"title\") <https://example.com>",
+			"<p><a href=\"https://github.com/coscms/xweb\">xweb</a> <a href=\"https://example.com\">https://example.com</a></p>\n"},
+		{"![logo](/img/logo.png)", "<p><img src=\"/img/logo.png\" alt=\"logo\"></p>\n"},
+	}
+	for _, c := range cases {
+		if html := ToHTML(c.src); html != c.html {
+			t.Errorf("ToHTML(%q)\n got %q\nwant %q", c.src, html, c.html)
+		}
+	}
+}
+
+func TestToHTMLIsFast(t *testing.T) {
+	cases := []string{
+		strings.Repeat("*a ", 40000),
+		strings.Repeat("_a ", 40000),
+		strings.Repeat("**a ", 30000),
+		strings.Repeat("[", 100000),
+		strings.Repeat("[", 20000) + "x" + strings.Repeat("](u)", 20000),
+		strings.Repeat("*a _a ", 20000),
+		strings.Repeat("`a ", 40000),
+		strings.Repeat("> ", 20000) + "a",
+	}
+	for _, src := range cases {
+		start := time.Now()
+		ToHTML(src)
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("ToHTML(%q...) took %v", src[:8], d)
+		}
+	}
+}
+
+func TestToHTMLIsSafe(t *testing.T) {
+	cases := []struct {
+		src, html string
+	}{
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"[click](javascript:alert(1))", "<p>click)</p>\n"},
+		{"[click](JavaScript:alert)", "<p>click</p>\n"},
+		{"![x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"[a\"b](/x\"onclick=\"alert)", "<p><a href=\"/x&#34;onclick=&#34;alert\">a&#34;b</a></p>\n"},
+		{"<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{"```\"><script>\n\"><script>\n```", "<pre><code>&#34;&gt;&lt;script&gt;\n</code></pre>\n"},
+	}
+	for _, c := range cases {
+		if html := ToHTML(c.src); html != c.html {
+			t.Errorf("ToHTML(%q)\n got %q\nwant %q", c.src, html, c.html)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package oidc is an OAuth2 authorization code client with PKCE, which
+// validates OpenID Connect ID tokens against the JWKS of the provider.
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coscms/xweb/lib/jwt"
+)
+
+var (
+	ErrState     = errors.New("oidc: state does not match")
+	ErrNonce     = errors.New("oidc: nonce does not match")
+	ErrNoIDToken = errors.New("oidc: token response has no id_token")
+)
+
+// Provider holds the endpoints of an identity provider.
+type Provider struct {
+	Issuer      string `json:"issuer"`
+	AuthURL     string `json:"authorization_endpoint"`
+	TokenURL    string `json:"token_endpoint"`
+	UserInfoURL string `json:"userinfo_endpoint"`
+	JWKSURL     string `json:"jwks_uri"`
+}
+
+func getJSON(client *http.Client, u string, v interface{}) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s: %s", resp.Status, b)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Discover reads the provider from its .well-known/openid-configuration.
+func Discover(client *http.Client, issuer string) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	p := &Provider{}
+	err := getJSON(client, strings.TrimRight(issuer, "/")+"/.well-known/openid-configuration", p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: issuer %q does not match %q", p.Issuer, issuer)
+	}
+	return p, nil
+}
+
+// Token is the answer of the token endpoint.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	ExpiresIn    int64     `json:"expires_in,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Now().After(t.Expiry.Add(-10*time.Second))
+}
+
+// AuthRequest is what has to be kept, in the session, between sending the
+// user to the provider and the callback.
+type AuthRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+	Next     string //where to go after the login
+}
+
+func random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func NewAuthRequest() (*AuthRequest, error) {
+	r := &AuthRequest{}
+	var err error
+	if r.State, err = random(16); err != nil {
+		return nil, err
+	}
+	if r.Nonce, err = random(16); err != nil {
+		return nil, err
+	}
+	if r.Verifier, err = random(32); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Challenge is the S256 PKCE code challenge of the verifier.
+func (r *AuthRequest) Challenge() string {
+	sum := sha256.Sum256([]byte(r.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type Client struct {
+	*Provider
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	HTTPClient   *http.Client
+	Algorithms   []string      //accepted ID token algorithms, default RS256 and EdDSA
+	Leeway       time.Duration //clock skew allowed for exp and nbf
+
+	keys    *jwt.KeySet
+	fetched time.Time
+	lock    sync.Mutex
+}
+
+func NewClient(provider *Provider, clientID, clientSecret, redirectURL string, scopes ...string) *Client {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	return &Client{
+		Provider:     provider,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Algorithms:   []string{jwt.RS256, jwt.EdDSA},
+		Leeway:       time.Minute,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// AuthCodeURL is where the user is sent to log in.
+func (c *Client) AuthCodeURL(r *AuthRequest) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"redirect_uri":          {c.RedirectURL},
+		"scope":                 {strings.Join(c.Scopes, " ")},
+		"state":                 {r.State},
+		"nonce":                 {r.Nonce},
+		"code_challenge":        {r.Challenge()},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(c.AuthURL, "?") {
+		sep = "&"
+	}
+	return c.AuthURL + sep + v.Encode()
+}
+
+func (c *Client) token(v url.Values) (*Token, error) {
+	if c.ClientSecret == "" {
+		v.Set("client_id", c.ClientID)
+	}
+	req, err := http.NewRequest("POST", c.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint: %s: %s", resp.Status, b)
+	}
+	t := &Token{}
+	if err = json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	if t.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// Exchange trades the code of the callback for tokens. The state of the
+// callback has to be checked against r by the caller, see Callback.
+func (c *Client) Exchange(code string, r *AuthRequest) (*Token, error) {
+	return c.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"code_verifier": {r.Verifier},
+	})
+}
+
+// Callback checks the state, exchanges the code and verifies the ID token.
+func (c *Client) Callback(query url.Values, r *AuthRequest) (*Token, jwt.Claims, error) {
+	if e := query.Get("error"); e != "" {
+		return nil, nil, fmt.Errorf("oidc: %s: %s", e, query.Get("error_description"))
+	}
+	if r == nil || r.State == "" || query.Get("state") != r.State {
+		return nil, nil, ErrState
+	}
+	t, err := c.Exchange(query.Get("code"), r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t.IDToken == "" {
+		return nil, nil, ErrNoIDToken
+	}
+	claims, err := c.VerifyIDToken(t.IDToken, r.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, claims, nil
+}
+
+// Refresh gets new tokens with the refresh token. Providers may or may not
+// return a new refresh token, the old one is kept when they don't.
+func (c *Client) Refresh(refreshToken string) (*Token, error) {
+	t, err := c.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+	return t, nil
+}
+
+// keySet returns the JWKS of the provider. It is fetched again for an
+// unknown kid, at most once a minute, to follow key rotations.
+func (c *Client) keySet(kid string) (*jwt.KeySet, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.keys != nil {
+		if _, err := c.keys.Key(kid); err == nil || time.Since(c.fetched) < time.Minute {
+			return c.keys, nil
+		}
+	}
+	keys := &jwt.KeySet{}
+	if err := getJSON(c.httpClient(), c.JWKSURL, keys); err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.fetched = time.Now()
+	return keys, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce.
+func (c *Client) VerifyIDToken(raw string, nonce string) (jwt.Claims, error) {
+	v := &jwt.Validator{
+		Algorithms: c.Algorithms,
+		Issuer:     c.Issuer,
+		Audience:   c.ClientID,
+		Leeway:     c.Leeway,
+		KeyFunc: func(h *jwt.Header) (interface{}, error) {
+			keys, err := c.keySet(h.Kid)
+			if err != nil {
+				return nil, err
+			}
+			return keys.Key(h.Kid)
+		},
+	}
+	token, err := v.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := token.Claims.Time("exp"); !ok {
+		return nil, jwt.ErrExpired
+	}
+	if nonce != "" && token.Claims.String("nonce") != nonce {
+		return nil, ErrNonce
+	}
+	return token.Claims, nil
+}
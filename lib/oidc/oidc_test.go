@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coscms/xweb/lib/jwt"
+)
+
+// fakeProvider is a minimal authorization server, it remembers the code
+// challenge and nonce of the last authorization request.
+type fakeProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	refreshed int
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProvider{key: key}
+	mux := http.NewServeMux()
+	p.Server = httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&Provider{
+			Issuer:   p.URL,
+			AuthURL:  p.URL + "/authorize",
+			TokenURL: p.URL + "/token",
+			JWKSURL:  p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&jwt.KeySet{Keys: []jwt.JWK{jwt.NewRSAJWK("k1", &key.PublicKey)}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "pkce required", 400)
+			return
+		}
+		p.challenge = q.Get("code_challenge")
+		p.nonce = q.Get("nonce")
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=thecode&state="+url.QueryEscape(q.Get("state")), 302)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "app" || secret != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, 401)
+			return
+		}
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if r.PostFormValue("code") != "thecode" ||
+				base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+				http.Error(w, `{"error":"invalid_grant"}`, 400)
+				return
+			}
+		case "refresh_token":
+			if r.PostFormValue("refresh_token") != "refresh" {
+				http.Error(w, `{"error":"invalid_grant"}`, 400)
+				return
+			}
+			p.refreshed++
+		}
+		idToken, _ := jwt.Sign(jwt.RS256, key, jwt.Claims{
+			"iss":   p.URL,
+			"aud":   "app",
+			"sub":   "42",
+			"name":  "Alice",
+			"nonce": p.nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}, "k1")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"token_type":    "Bearer",
+			"refresh_token": "refresh",
+			"id_token":      idToken,
+			"expires_in":    3600,
+		})
+	})
+	return p
+}
+
+func (p *fakeProvider) client(t *testing.T) *Client {
+	provider, err := Discover(nil, p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(provider, "app", "secret", "http://localhost/callback")
+}
+
+// authorize follows the auth code url and returns the callback query.
+func (p *fakeProvider) authorize(t *testing.T, u string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Path != "/callback" {
+		t.Fatalf("unexpected redirect %v", resp.Header.Get("Location"))
+	}
+	return loc.Query()
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	c := p.client(t)
+
+	r, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := p.authorize(t, c.AuthCodeURL(r))
+	token, claims, err := c.Callback(query, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || token.Expired() {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if claims.String("sub") != "42" || claims.String("name") != "Alice" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+
+	token, err = c.Refresh(token.RefreshToken)
+	if err != nil || p.refreshed != 1 || token.AccessToken != "access" {
+		t.Errorf("refresh failed: %v", err)
+	}
+}
+
+func TestCallbackRejects(t *testing.T) {
+	p := newFakeProvider(t)
+	defer p.Close()
+	c := p.client(t)
+
+	r, _ := NewAuthRequest()
+	query := p.authorize(t, c.AuthCodeURL(r))
+	query.Set("state", "forged")
+	if _, _, err := c.Callback(query, r); err != ErrState {
+		t.Errorf("expected ErrState, got %v", err)
+	}
+
+	// another verifier does not match the code challenge
+	other, _ := NewAuthRequest()
+	other.State = r.State
+	query.Set("state", r.State)
+	if _, _, err := c.Callback(query, other); err == nil {
+		t.Error("the exchange should fail without the right verifier")
+	}
+
+	// the provider signed the nonce of r
+	r2 := *r
+	r2.Nonce = "replayed"
+	if _, _, err := c.Callback(query, &r2); err != ErrNonce {
+		t.Errorf("expected ErrNonce, got %v", err)
+	}
+
+	c.ClientID = "other"
+	c.ClientSecret = ""
+	if _, err := c.VerifyIDToken("a.b.c", ""); err == nil {
+		t.Error("a malformed id token should be rejected")
+	}
+}
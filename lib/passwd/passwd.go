@@ -0,0 +1,322 @@
+// Package passwd hashes passwords with argon2id, bcrypt or scrypt. Hashes
+// are PHC strings, which carry the algorithm and its parameters, so that
+// old hashes keep working when the parameters are raised and can be
+// replaced at the next login:
+//
+//	ok, newHash, err := passwd.Verify(password, user.Hash)
+//	if ok && newHash != "" {
+//		user.Hash = newHash // save it
+//	}
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrFormat    = errors.New("passwd: unknown hash format")
+	ErrMalformed = errors.New("passwd: malformed hash")
+)
+
+// Hasher is one password hashing algorithm with its parameters.
+type Hasher interface {
+	// Id is the PHC identifier of the algorithm, such as argon2id.
+	Id() string
+	Hash(password string) (string, error)
+	// Verify compares in constant time.
+	Verify(password string, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with other parameters.
+	NeedsRehash(encoded string) bool
+}
+
+var b64 = base64.RawStdEncoding
+
+func salt(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// phc splits $id$v=19$m=1,t=2$salt$hash, the version part is optional.
+type phc struct {
+	id      string
+	version string
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(encoded string) (*phc, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) < 5 || parts[0] != "" {
+		return nil, ErrMalformed
+	}
+	p := &phc{id: parts[1], params: make(map[string]int)}
+	parts = parts[2:]
+	if strings.HasPrefix(parts[0], "v=") {
+		p.version = parts[0][2:]
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	for _, kv := range strings.Split(parts[0], ",") {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, ErrMalformed
+		}
+		n, err := strconv.Atoi(kv[i+1:])
+		if err != nil || n < 0 {
+			return nil, ErrMalformed
+		}
+		p.params[kv[:i]] = n
+	}
+	var err error
+	if p.salt, err = b64.DecodeString(parts[1]); err != nil {
+		return nil, ErrMalformed
+	}
+	if p.hash, err = b64.DecodeString(parts[2]); err != nil || len(p.hash) == 0 {
+		return nil, ErrMalformed
+	}
+	return p, nil
+}
+
+// Argon2id is the recommended Hasher. Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen int
+}
+
+// NewArgon2id uses the first recommended parameters of RFC 9106 with less
+// memory: 3 passes over 64 MiB.
+func NewArgon2id() *Argon2id {
+	return &Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+}
+
+func (h *Argon2id) Id() string {
+	return "argon2id"
+}
+
+func (h *Argon2id) Hash(password string) (string, error) {
+	s, err := salt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), s, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.Memory, h.Time, h.Threads, b64.EncodeToString(s), b64.EncodeToString(key)), nil
+}
+
+func (h *Argon2id) parse(encoded string) (*phc, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if p.id != "argon2id" {
+		return nil, ErrFormat
+	}
+	if p.version != strconv.Itoa(argon2.Version) || p.params["t"] < 1 ||
+		p.params["m"] < 8 || p.params["p"] < 1 || p.params["p"] > 255 {
+		return nil, ErrMalformed
+	}
+	return p, nil
+}
+
+func (h *Argon2id) Verify(password string, encoded string) (bool, error) {
+	p, err := h.parse(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, uint32(p.params["t"]),
+		uint32(p.params["m"]), uint8(p.params["p"]), uint32(len(p.hash)))
+	return subtle.ConstantTimeCompare(key, p.hash) == 1, nil
+}
+
+func (h *Argon2id) NeedsRehash(encoded string) bool {
+	p, err := h.parse(encoded)
+	return err != nil || uint32(p.params["t"]) != h.Time || uint32(p.params["m"]) != h.Memory ||
+		uint8(p.params["p"]) != h.Threads || uint32(len(p.hash)) != h.KeyLen || len(p.salt) != h.SaltLen
+}
+
+// Scrypt hashes as $scrypt$ln=15,r=8,p=1$salt$hash, where N is 2^ln.
+type Scrypt struct {
+	LogN    int
+	R       int
+	P       int
+	KeyLen  int
+	SaltLen int
+}
+
+func NewScrypt() *Scrypt {
+	return &Scrypt{LogN: 15, R: 8, P: 1, KeyLen: 32, SaltLen: 16}
+}
+
+func (h *Scrypt) Id() string {
+	return "scrypt"
+}
+
+func (h *Scrypt) Hash(password string) (string, error) {
+	s, err := salt(h.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), s, 1<<uint(h.LogN), h.R, h.P, h.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.LogN, h.R, h.P,
+		b64.EncodeToString(s), b64.EncodeToString(key)), nil
+}
+
+func (h *Scrypt) parse(encoded string) (*phc, error) {
+	p, err := parsePHC(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if p.id != "scrypt" {
+		return nil, ErrFormat
+	}
+	if p.params["ln"] < 1 || p.params["ln"] > 30 || p.params["r"] < 1 || p.params["p"] < 1 {
+		return nil, ErrMalformed
+	}
+	return p, nil
+}
+
+func (h *Scrypt) Verify(password string, encoded string) (bool, error) {
+	p, err := h.parse(encoded)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), p.salt, 1<<uint(p.params["ln"]),
+		p.params["r"], p.params["p"], len(p.hash))
+	if err != nil {
+		return false, ErrMalformed
+	}
+	return subtle.ConstantTimeCompare(key, p.hash) == 1, nil
+}
+
+func (h *Scrypt) NeedsRehash(encoded string) bool {
+	p, err := h.parse(encoded)
+	return err != nil || p.params["ln"] != h.LogN || p.params["r"] != h.R ||
+		p.params["p"] != h.P || len(p.hash) != h.KeyLen || len(p.salt) != h.SaltLen
+}
+
+// Bcrypt keeps the usual $2a$cost$... format, which bcrypt verifies in
+// constant time itself. Passwords are cut after 72 bytes by bcrypt.
+type Bcrypt struct {
+	Cost int
+}
+
+func NewBcrypt() *Bcrypt {
+	return &Bcrypt{Cost: 12}
+}
+
+func (h *Bcrypt) Id() string {
+	return "bcrypt"
+}
+
+func (h *Bcrypt) Hash(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(b), err
+}
+
+func (h *Bcrypt) Verify(password string, encoded string) (bool, error) {
+	if !isBcrypt(encoded) {
+		return false, ErrFormat
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, ErrMalformed
+	}
+	return true, nil
+}
+
+func (h *Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// Passwords hashes new passwords with Default and verifies the hashes of
+// all the Hashers.
+type Passwords struct {
+	Default Hasher
+	Hashers []Hasher
+}
+
+func New(def Hasher, others ...Hasher) *Passwords {
+	return &Passwords{Default: def, Hashers: append([]Hasher{def}, others...)}
+}
+
+// DefaultPasswords uses argon2id and still verifies bcrypt and scrypt.
+var DefaultPasswords = New(NewArgon2id(), NewBcrypt(), NewScrypt())
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.Default.Hash(password)
+}
+
+// hasher finds the Hasher of encoded by its identifier.
+func (p *Passwords) hasher(encoded string) Hasher {
+	id := "bcrypt"
+	if !isBcrypt(encoded) {
+		parts := strings.SplitN(encoded, "$", 3)
+		if len(parts) < 3 || parts[0] != "" {
+			return nil
+		}
+		id = parts[1]
+	}
+	for _, h := range p.Hashers {
+		if h.Id() == id {
+			return h
+		}
+	}
+	return nil
+}
+
+// Verify checks password against encoded. When it matches but encoded was
+// not made by Default with its current parameters, newHash is a fresh hash
+// to store instead.
+func (p *Passwords) Verify(password string, encoded string) (ok bool, newHash string, err error) {
+	h := p.hasher(encoded)
+	if h == nil {
+		return false, "", ErrFormat
+	}
+	ok, err = h.Verify(password, encoded)
+	if !ok || err != nil {
+		return false, "", err
+	}
+	if h.Id() != p.Default.Id() || p.Default.NeedsRehash(encoded) {
+		if newHash, err = p.Default.Hash(password); err != nil {
+			return true, "", err
+		}
+	}
+	return true, newHash, nil
+}
+
+func Hash(password string) (string, error) {
+	return DefaultPasswords.Hash(password)
+}
+
+func Verify(password string, encoded string) (ok bool, newHash string, err error) {
+	return DefaultPasswords.Verify(password, encoded)
+}
@@ -0,0 +1,81 @@
+package passwd
+
+import (
+	"strings"
+	"testing"
+)
+
+// cheap parameters, the tests don't need to be slow
+func testPasswords() *Passwords {
+	return New(&Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8},
+		&Bcrypt{Cost: 4}, &Scrypt{LogN: 4, R: 8, P: 1, KeyLen: 16, SaltLen: 8})
+}
+
+func TestHashers(t *testing.T) {
+	p := testPasswords()
+	for _, h := range p.Hashers {
+		encoded, err := h.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encoded, "$") {
+			t.Errorf("%s: %q is not a PHC string", h.Id(), encoded)
+		}
+		if ok, err := h.Verify("secret", encoded); !ok || err != nil {
+			t.Errorf("%s: the password should match: %v", h.Id(), err)
+		}
+		if ok, _ := h.Verify("Secret", encoded); ok {
+			t.Errorf("%s: another password should not match", h.Id())
+		}
+		if h.NeedsRehash(encoded) {
+			t.Errorf("%s: a fresh hash needs no rehash", h.Id())
+		}
+	}
+}
+
+func TestKnownHashes(t *testing.T) {
+	p := testPasswords()
+	// made by the reference argon2 and by python hashlib.scrypt
+	for _, encoded := range []string{
+		"$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		"$scrypt$ln=4,r=8,p=1$c2FsdA$+HYXj5SDfYch7J15Sl5iMoPpJ0qEbcC/2kIzoB17pos",
+	} {
+		if ok, _, err := p.Verify("password", encoded); !ok || err != nil {
+			t.Errorf("%q: %v", encoded, err)
+		}
+	}
+}
+
+func TestRehash(t *testing.T) {
+	p := testPasswords()
+	old, _ := p.Hashers[1].Hash("secret")
+	ok, newHash, err := p.Verify("secret", old)
+	if !ok || err != nil || !strings.HasPrefix(newHash, "$argon2id$") {
+		t.Fatalf("a bcrypt hash should be upgraded, got %q %v", newHash, err)
+	}
+	if ok, again, _ := p.Verify("secret", newHash); !ok || again != "" {
+		t.Error("the new hash is up to date")
+	}
+
+	p.Default.(*Argon2id).Time = 2
+	if _, again, _ := p.Verify("secret", newHash); again == "" {
+		t.Error("changed parameters should rehash")
+	}
+	if ok, again, _ := p.Verify("wrong", newHash); ok || again != "" {
+		t.Error("a wrong password is never rehashed")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	p := testPasswords()
+	for _, encoded := range []string{
+		"", "5f4dcc3b5aa765d61d8327deb882cf99", "$md5$x$y$z",
+		"$argon2id$v=19$m=64,t=1$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$scrypt$ln=4,r=8,p=1$!!$aGFzaA",
+	} {
+		if ok, _, err := p.Verify("password", encoded); ok || err == nil {
+			t.Errorf("%q should be rejected", encoded)
+		}
+	}
+}
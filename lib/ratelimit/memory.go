@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	tokens float64
+	last   time.Time
+
+	window int64
+	curr   int64
+	prev   int64
+
+	expire time.Time
+}
+
+// MemoryStore keeps the counters in the process, it is the default.
+type MemoryStore struct {
+	entries map[string]*memoryEntry
+	lock    sync.Mutex
+	calls   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*memoryEntry)}
+}
+
+// sweep drops the entries nobody has used for long, from time to time
+func (store *MemoryStore) sweep(now time.Time) {
+	store.calls++
+	if store.calls < 1024 {
+		return
+	}
+	store.calls = 0
+	for key, e := range store.entries {
+		if now.After(e.expire) {
+			delete(store.entries, key)
+		}
+	}
+}
+
+func (store *MemoryStore) entry(key string, now time.Time) *memoryEntry {
+	store.sweep(now)
+	e, ok := store.entries[key]
+	if !ok {
+		e = &memoryEntry{window: -1}
+		store.entries[key] = e
+	}
+	return e
+}
+
+func (store *MemoryStore) TakeToken(key string, rate float64, burst int64, now time.Time) (bool, float64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	e := store.entry(key, now)
+	if e.last.IsZero() {
+		e.tokens = float64(burst)
+	} else {
+		e.tokens = math.Min(float64(burst), e.tokens+now.Sub(e.last).Seconds()*rate)
+	}
+	e.last = now
+	e.expire = now.Add(seconds(float64(burst) / rate))
+	if e.tokens < 1 {
+		return false, e.tokens, nil
+	}
+	e.tokens--
+	return true, e.tokens, nil
+}
+
+func (store *MemoryStore) Hit(key string, limit int64, window time.Duration, now time.Time) (bool, float64, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	e := store.entry(key, now)
+	w := now.UnixNano() / int64(window)
+	if e.window != w {
+		if e.window == w-1 {
+			e.prev = e.curr
+		} else {
+			e.prev = 0
+		}
+		e.curr = 0
+		e.window = w
+	}
+	e.expire = now.Add(2 * window)
+	count := windowCount(e.prev, e.curr, window, now)
+	if count+1 > float64(limit) {
+		return false, count, nil
+	}
+	e.curr++
+	return true, count + 1, nil
+}
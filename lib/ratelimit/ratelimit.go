@@ -0,0 +1,95 @@
+// Package ratelimit limits how often a key, such as a client ip, may do
+// something. The counters live in a Store, so that several instances of
+// an application can share them.
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+type Algorithm int
+
+const (
+	// SlidingWindow allows Limit requests in any Period, the count of the
+	// previous window is weighted by how much it overlaps the sliding one.
+	SlidingWindow Algorithm = iota
+	// TokenBucket allows bursts of Limit requests, the bucket is refilled
+	// with Limit tokens per Period.
+	TokenBucket
+)
+
+// Store keeps the counters. Both methods have to be atomic per key.
+type Store interface {
+	// TakeToken takes one token from the bucket of key, which is refilled
+	// with rate tokens per second up to burst. It returns whether a token
+	// was taken and how many are left.
+	TakeToken(key string, rate float64, burst int64, now time.Time) (ok bool, tokens float64, err error)
+	// Hit counts a request in the sliding window of key unless the count
+	// would exceed limit. It returns whether the request was counted and
+	// the weighted count of the window.
+	Hit(key string, limit int64, window time.Duration, now time.Time) (ok bool, count float64, err error)
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration //until the limit is fully available again
+	RetryAfter time.Duration //when a denied request may be retried
+}
+
+type Limiter struct {
+	Algorithm Algorithm
+	Limit     int64
+	Period    time.Duration
+}
+
+func New(algorithm Algorithm, limit int64, period time.Duration) *Limiter {
+	return &Limiter{Algorithm: algorithm, Limit: limit, Period: period}
+}
+
+// Take counts one request of key.
+func (l *Limiter) Take(store Store, key string) (*Result, error) {
+	now := time.Now()
+	r := &Result{Limit: l.Limit}
+	switch l.Algorithm {
+	case TokenBucket:
+		rate := float64(l.Limit) / l.Period.Seconds()
+		ok, tokens, err := store.TakeToken(key, rate, l.Limit, now)
+		if err != nil {
+			return nil, err
+		}
+		r.Allowed = ok
+		r.Remaining = int64(math.Floor(tokens))
+		r.Reset = seconds((float64(l.Limit) - tokens) / rate)
+		if !ok {
+			r.RetryAfter = seconds((1 - tokens) / rate)
+		}
+	default:
+		ok, count, err := store.Hit(key, l.Limit, l.Period, now)
+		if err != nil {
+			return nil, err
+		}
+		r.Allowed = ok
+		r.Remaining = l.Limit - int64(math.Ceil(count))
+		r.Reset = l.Period - time.Duration(now.UnixNano()%int64(l.Period))
+		if !ok {
+			r.RetryAfter = r.Reset
+		}
+	}
+	if r.Remaining < 0 {
+		r.Remaining = 0
+	}
+	return r, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// windowCount weights the previous window by its overlap with the sliding one
+func windowCount(prev, curr int64, window time.Duration, now time.Time) float64 {
+	elapsed := now.UnixNano() % int64(window)
+	return float64(prev)*float64(int64(window)-elapsed)/float64(window) + float64(curr)
+}
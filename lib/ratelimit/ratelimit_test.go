@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	store := NewMemoryStore()
+	window := time.Minute
+	now := time.Unix(0, 0).Add(10 * window)
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := store.Hit("k", 3, window, now); !ok {
+			t.Fatalf("hit %d should be allowed", i)
+		}
+	}
+	if ok, _, _ := store.Hit("k", 3, window, now); ok {
+		t.Fatal("the 4th hit should be denied")
+	}
+	// half way into the next window half of the previous count remains
+	now = now.Add(window + window/2)
+	if ok, count, _ := store.Hit("k", 3, window, now); !ok || count != 2.5 {
+		t.Fatalf("expected an allowed hit with count 2.5, got %v %v", ok, count)
+	}
+	if ok, _, _ := store.Hit("k", 3, window, now); ok {
+		t.Fatal("the window should be full again")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := store.TakeToken("k", 1, 2, now); !ok {
+			t.Fatalf("token %d should be taken", i)
+		}
+	}
+	if ok, _, _ := store.TakeToken("k", 1, 2, now); ok {
+		t.Fatal("the bucket should be empty")
+	}
+	if ok, _, _ := store.TakeToken("k", 1, 2, now.Add(time.Second)); !ok {
+		t.Fatal("a token should be refilled after a second")
+	}
+}
+
+func TestLimiterResult(t *testing.T) {
+	store := NewMemoryStore()
+	l := New(TokenBucket, 1, time.Second)
+	if r, _ := l.Take(store, "k"); !r.Allowed || r.Remaining != 0 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	r, _ := l.Take(store, "k")
+	if r.Allowed || r.RetryAfter <= 0 || r.RetryAfter > time.Second {
+		t.Fatalf("unexpected result %+v", r)
+	}
+}
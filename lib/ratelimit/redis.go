@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Evaler runs a lua script on a redis compatible server. It is small enough
+// to be adapted to any redis client, e.g. for github.com/gomodule/redigo:
+//
+//	func (e evaler) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+//		return redis.NewScript(len(keys), script).Do(e.conn, append(toArgs(keys), args...)...)
+//	}
+type Evaler interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisStore keeps the counters in redis, so that all instances of an
+// application share the limits. Numbers are returned as strings because
+// redis truncates lua numbers to integers.
+type RedisStore struct {
+	Client Evaler
+	Prefix string
+}
+
+func NewRedisStore(client Evaler, prefix string) *RedisStore {
+	return &RedisStore{Client: client, Prefix: prefix}
+}
+
+var errRedisReply = errors.New("ratelimit: unexpected redis reply")
+
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local tokens = tonumber(redis.call('HGET', KEYS[1], 't') or ARGV[2])
+local last = tonumber(redis.call('HGET', KEYS[1], 'l') or ARGV[3])
+tokens = math.min(burst, tokens + (now - last) * rate / 1000)
+local ok = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+end
+redis.call('HMSET', KEYS[1], 't', tostring(tokens), 'l', ARGV[3])
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000))
+return {ok, tostring(tokens)}
+`
+
+const slidingWindowScript = `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local cur = math.floor(now / window)
+local w = tonumber(redis.call('HGET', KEYS[1], 'w') or '-1')
+local c = tonumber(redis.call('HGET', KEYS[1], 'c') or '0')
+local p = tonumber(redis.call('HGET', KEYS[1], 'p') or '0')
+if w ~= cur then
+	if w == cur - 1 then p = c else p = 0 end
+	c = 0
+end
+local count = p * (window - (now - cur * window)) / window + c
+local ok = 0
+if count + 1 <= limit then
+	c = c + 1
+	count = count + 1
+	ok = 1
+end
+redis.call('HMSET', KEYS[1], 'w', cur, 'c', c, 'p', p)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {ok, tostring(count)}
+`
+
+func (store *RedisStore) eval(script, key string, args ...interface{}) (bool, float64, error) {
+	reply, err := store.Client.Eval(script, []string{store.Prefix + key}, args...)
+	if err != nil {
+		return false, 0, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, errRedisReply
+	}
+	allowed, ok := values[0].(int64)
+	if !ok {
+		return false, 0, errRedisReply
+	}
+	var s string
+	switch v := values[1].(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return false, 0, errRedisReply
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return false, 0, errRedisReply
+	}
+	return allowed == 1, n, nil
+}
+
+func millis(t time.Time) string {
+	return fmt.Sprint(t.UnixNano() / int64(time.Millisecond))
+}
+
+func (store *RedisStore) TakeToken(key string, rate float64, burst int64, now time.Time) (bool, float64, error) {
+	return store.eval(tokenBucketScript, key, strconv.FormatFloat(rate, 'f', -1, 64), burst, millis(now))
+}
+
+func (store *RedisStore) Hit(key string, limit int64, window time.Duration, now time.Time) (bool, float64, error) {
+	return store.eval(slidingWindowScript, key, limit, int64(window/time.Millisecond), millis(now))
+}
@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeEvaler records the calls and answers with reply.
+type fakeEvaler struct {
+	reply  interface{}
+	err    error
+	script string
+	keys   []string
+	args   []interface{}
+}
+
+func (e *fakeEvaler) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	e.script, e.keys, e.args = script, keys, args
+	return e.reply, e.err
+}
+
+func TestRedisStoreHit(t *testing.T) {
+	client := &fakeEvaler{reply: []interface{}{int64(1), "2.5"}}
+	store := NewRedisStore(client, "rl:")
+	now := time.Unix(1, int64(500*time.Millisecond))
+	ok, count, err := store.Hit("k", 3, time.Minute, now)
+	if err != nil || !ok || count != 2.5 {
+		t.Fatalf("expected an allowed hit with count 2.5, got %v %v %v", ok, count, err)
+	}
+	if client.script != slidingWindowScript || len(client.keys) != 1 || client.keys[0] != "rl:k" {
+		t.Errorf("unexpected script or keys %v", client.keys)
+	}
+	if len(client.args) != 3 || client.args[0] != int64(3) ||
+		client.args[1] != int64(60000) || client.args[2] != "1500" {
+		t.Errorf("unexpected args %#v", client.args)
+	}
+
+	client.reply = []interface{}{int64(0), []byte("3")}
+	if ok, count, err := store.Hit("k", 3, time.Minute, now); err != nil || ok || count != 3 {
+		t.Errorf("expected a denied hit with count 3, got %v %v %v", ok, count, err)
+	}
+}
+
+func TestRedisStoreTakeToken(t *testing.T) {
+	client := &fakeEvaler{reply: []interface{}{int64(1), "0.5"}}
+	store := NewRedisStore(client, "")
+	ok, tokens, err := store.TakeToken("k", 0.5, 2, time.Unix(2, 0))
+	if err != nil || !ok || tokens != 0.5 {
+		t.Fatalf("expected a token with 0.5 left, got %v %v %v", ok, tokens, err)
+	}
+	if client.script != tokenBucketScript || client.keys[0] != "k" {
+		t.Errorf("unexpected script or keys %v", client.keys)
+	}
+	if len(client.args) != 3 || client.args[0] != "0.5" ||
+		client.args[1] != int64(2) || client.args[2] != "2000" {
+		t.Errorf("unexpected args %#v", client.args)
+	}
+}
+
+func TestRedisStoreBadReply(t *testing.T) {
+	failed := errors.New("connection refused")
+	replies := []interface{}{
+		nil,
+		"OK",
+		[]interface{}{int64(1)},
+		[]interface{}{"1", "2"},
+		[]interface{}{int64(1), int64(2)},
+		[]interface{}{int64(1), "two"},
+	}
+	for _, reply := range replies {
+		store := NewRedisStore(&fakeEvaler{reply: reply}, "")
+		if _, _, err := store.Hit("k", 1, time.Second, time.Now()); err != errRedisReply {
+			t.Errorf("reply %#v: expected errRedisReply, got %v", reply, err)
+		}
+	}
+	store := NewRedisStore(&fakeEvaler{err: failed}, "")
+	if _, _, err := store.TakeToken("k", 1, 1, time.Now()); err != failed {
+		t.Errorf("the error of the client should be returned, got %v", err)
+	}
+}
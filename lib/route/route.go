@@ -117,6 +117,31 @@ func (r *Route) Get(reqPath string, reqMethod string,
 	return nil, "", nil, false, false, false
 }
 
+// Methods returns the request methods registered for the path.
+func (r *Route) Methods(reqPath string) map[string]bool {
+	methods := make(map[string]bool)
+	if route, ok := r.Static[reqPath]; ok {
+		for method, _ := range route.RequestMethod {
+			methods[method] = true
+		}
+	}
+	length := len(reqPath)
+	for _, route := range r.Regexp {
+		if route.StaticLength >= length || reqPath[0:route.StaticLength] != route.StaticPath {
+			continue
+		}
+		part := reqPath[route.StaticLength:]
+		p := route.Regexp.FindStringSubmatch(part)
+		if len(p) < 1 || p[0] != part {
+			continue
+		}
+		for method, _ := range route.RequestMethod {
+			methods[method] = true
+		}
+	}
+	return methods
+}
+
 func (r *Route) Rego(vOriginal string, vNew string) (length int, staticPath string, regexpInstance *regexp.Regexp) {
 	var same []byte = make([]byte, 0)
 	for k, v := range []byte(vNew) {
@@ -15,7 +15,7 @@ import (
 	"strings"
 )
 
-// md5 hash string
+// md5 hash string, never use it for passwords, see lib/passwd
 func Md5(str string) string {
 	m := md5.New()
 	io.WriteString(m, str)
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	htmlTpl "html/template"
+	"io/fs"
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
@@ -61,6 +62,7 @@ type TemplateEx struct {
 	CachedRelation   map[string]string
 	TemplateDir      string
 	TemplateMgr      *TemplateMgr
+	FS               fs.FS //read the templates from FS instead of TemplateDir
 	BeforeRender     func(*string)
 	DelimLeft        string
 	DelimRight       string
@@ -74,24 +76,10 @@ func (self *TemplateEx) Fetch(tmplName string, funcMap htmlTpl.FuncMap, values i
 	tmplName += self.Ext
 	tmpl, ok := self.CachedTemplate[tmplName]
 	if !ok {
-		b, err := self.RawContent(tmplName)
+		content, subcs, err := self.Sources(tmplName)
 		if err != nil {
 			return fmt.Sprintf("RenderTemplate %v read err: %s", tmplName, err)
 		}
-
-		content := string(b)
-		if self.BeforeRender != nil {
-			self.BeforeRender(&content)
-		}
-		subcs := make(map[string]string, 0) //子模板内容
-
-		ident := self.DelimLeft + self.IncludeTag + self.DelimRight
-		if self.cachedRegexIdent != ident || self.incTagRegex == nil {
-			self.incTagRegex = regexp.MustCompile(regexp.QuoteMeta(self.DelimLeft) + self.IncludeTag + `[\s]+"([^"]+)"(?:[\s]+([^` + regexp.QuoteMeta(self.DelimRight[0:1]) + `]+))?[\s]*` + regexp.QuoteMeta(self.DelimRight))
-		}
-
-		content = self.ContainsSubTpl(content, &subcs)
-		//fmt.Println("====>", content)
 		t := htmlTpl.New(tmplName)
 		t.Delims(self.DelimLeft, self.DelimRight)
 		t.Funcs(funcMap)
@@ -113,9 +101,6 @@ func (self *TemplateEx) Fetch(tmplName string, funcMap htmlTpl.FuncMap, values i
 			} else {
 				t = tmpl.New(name)
 			}
-			if self.BeforeRender != nil {
-				self.BeforeRender(&subc)
-			}
 			_, err = t.Parse(subc)
 			if err != nil {
 				return fmt.Sprintf("Parse %v err: %v", name, err)
@@ -127,6 +112,45 @@ func (self *TemplateEx) Fetch(tmplName string, funcMap htmlTpl.FuncMap, values i
 	return self.Parse(tmpl, values)
 }
 
+// Sources returns the content of a template with its include tags turned
+// into template calls, and the defines of the included templates by name.
+// tmplName is the file name, with its extension.
+func (self *TemplateEx) Sources(tmplName string) (string, map[string]string, error) {
+	b, err := self.RawContent(tmplName)
+	if err != nil {
+		return "", nil, err
+	}
+	content := string(b)
+	if self.BeforeRender != nil {
+		self.BeforeRender(&content)
+	}
+	subcs := make(map[string]string, 0) //子模板内容
+
+	ident := self.DelimLeft + self.IncludeTag + self.DelimRight
+	if self.cachedRegexIdent != ident || self.incTagRegex == nil {
+		self.incTagRegex = regexp.MustCompile(regexp.QuoteMeta(self.DelimLeft) + self.IncludeTag + `[\s]+"([^"]+)"(?:[\s]+([^` + regexp.QuoteMeta(self.DelimRight[0:1]) + `]+))?[\s]*` + regexp.QuoteMeta(self.DelimRight))
+		self.cachedRegexIdent = ident
+	}
+
+	content = self.ContainsSubTpl(content, &subcs)
+	if self.BeforeRender != nil {
+		for name, subc := range subcs {
+			self.BeforeRender(&subc)
+			subcs[name] = subc
+		}
+	}
+	return content, subcs, nil
+}
+
+// Reload drops the cached templates.
+func (self *TemplateEx) Reload() {
+	self.CachedTemplate = make(map[string]*htmlTpl.Template)
+	self.CachedRelation = make(map[string]string)
+	if self.TemplateMgr != nil {
+		self.TemplateMgr.ClearCache()
+	}
+}
+
 func (self *TemplateEx) ContainsSubTpl(content string, subcs *map[string]string) string {
 	matches := self.incTagRegex.FindAllStringSubmatch(content, -1)
 	//dump(matches)
@@ -201,6 +225,9 @@ func (self *TemplateEx) Parse(tmpl *htmlTpl.Template, values interface{}) interf
 }
 
 func (self *TemplateEx) RawContent(tmpl string) ([]byte, error) {
+	if self.FS != nil {
+		return fs.ReadFile(self.FS, tmpl)
+	}
 	if self.TemplateMgr != nil && self.TemplateMgr.Caches != nil {
 		return self.TemplateMgr.GetTemplate(tmpl)
 	}
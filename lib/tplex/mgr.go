@@ -257,6 +257,15 @@ func (self *TemplateMgr) CacheTemplate(tmpl string, content []byte) {
 	return
 }
 
+func (self *TemplateMgr) ClearCache() {
+	if self.mutex == nil {
+		return
+	}
+	self.mutex.Lock()
+	self.Caches = make(map[string][]byte)
+	self.mutex.Unlock()
+}
+
 func (self *TemplateMgr) CacheDelete(tmpl string) {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
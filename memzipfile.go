@@ -6,6 +6,7 @@ import (
 	"compress/gzip"
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
@@ -25,7 +26,11 @@ func OpenMemZipFile(path string, zip string) (*MemFile, error) {
 		return nil, e
 	}
 	defer osfile.Close()
+	return openMemZipFile(osfile, path, zip)
+}
 
+// openMemZipFile compresses a file of any fs.FS, path names it in the cache.
+func openMemZipFile(osfile fs.File, path string, zip string) (*MemFile, error) {
 	osfileinfo, e := osfile.Stat()
 	if e != nil {
 		return nil, e
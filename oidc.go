@@ -0,0 +1,148 @@
+package xweb
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/coscms/xweb/lib/jwt"
+	"github.com/coscms/xweb/lib/oidc"
+)
+
+const (
+	OIDC_REQUEST_TAG = "_oidc"
+	OIDC_TOKEN_TAG   = "_oidc_token"
+)
+
+var ErrNoOIDC = errors.New("App.OIDC is not set")
+
+// OIDCLogin logs users in with an OpenID Connect provider, set it as
+// App.OIDC and mount OIDCAction, the RedirectURL of the client is the
+// callback of the action:
+//
+//	provider, err := oidc.Discover(nil, "https://id.example.com")
+//	client := oidc.NewClient(provider, "id", "secret", "https://app/oidc/callback")
+//	app.OIDC = xweb.NewOIDCLogin(client)
+//	app.AddRouter("/oidc", &xweb.OIDCAction{})
+//
+// The user is stored in the session through the SessionAuth of App.Auth.
+type OIDCLogin struct {
+	*oidc.Client
+	SuccessUrl string //where to go after the login when no next was given
+	Principal  func(claims jwt.Claims) *Principal
+}
+
+func NewOIDCLogin(client *oidc.Client) *OIDCLogin {
+	return &OIDCLogin{Client: client, SuccessUrl: "/"}
+}
+
+// principal maps the claims of the ID token to the user, roles are taken
+// from the roles or the groups claim.
+func (o *OIDCLogin) principal(claims jwt.Claims) *Principal {
+	if o.Principal != nil {
+		return o.Principal(claims)
+	}
+	p := &Principal{
+		Id:     claims.String("sub"),
+		Name:   claims.String("name"),
+		Roles:  claims.Strings("roles"),
+		Claims: claims,
+	}
+	if p.Name == "" {
+		p.Name = claims.String("preferred_username")
+	}
+	if len(p.Roles) == 0 {
+		p.Roles = claims.Strings("groups")
+	}
+	return p
+}
+
+// Token returns the tokens of the logged in user, refreshed when the access
+// token has expired.
+func (o *OIDCLogin) Token(c *Action) (*oidc.Token, error) {
+	key := c.App.AppConfig.CookiePrefix + OIDC_TOKEN_TAG
+	t := &oidc.Token{}
+	if err := c.SessionDecode(key, t); err != nil {
+		return nil, err
+	}
+	if !t.Expired() || t.RefreshToken == "" {
+		return t, nil
+	}
+	t, err := o.Refresh(t.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return t, c.SessionEncode(key, t)
+}
+
+// localPath only lets relative redirects after the login through.
+func localPath(next string) bool {
+	return strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") &&
+		!strings.HasPrefix(next, "/\\")
+}
+
+// OIDCAction sends the user to the provider and handles the callback.
+// The state, nonce and PKCE verifier are kept in the session meanwhile.
+type OIDCAction struct {
+	*Action
+
+	login    Mapper `xweb:"GET /login" auth:"-"`
+	callback Mapper `xweb:"GET /callback" auth:"-"`
+}
+
+func (c *OIDCAction) Login() error {
+	if c.App.OIDC == nil {
+		return c.Abort(404, ErrNoOIDC.Error())
+	}
+	if !c.App.AppConfig.SessionOn {
+		return c.Abort(500, "oidc login needs the session")
+	}
+	r, err := oidc.NewAuthRequest()
+	if err != nil {
+		return err
+	}
+	if next := c.GetString("next"); localPath(next) {
+		r.Next = next
+	}
+	if err = c.SessionEncode(c.App.AppConfig.CookiePrefix+OIDC_REQUEST_TAG, r); err != nil {
+		return err
+	}
+	return c.Redirect(c.App.OIDC.AuthCodeURL(r))
+}
+
+func (c *OIDCAction) Callback() error {
+	o := c.App.OIDC
+	if o == nil {
+		return c.Abort(404, ErrNoOIDC.Error())
+	}
+	key := c.App.AppConfig.CookiePrefix + OIDC_REQUEST_TAG
+	r := &oidc.AuthRequest{}
+	if err := c.SessionDecode(key, r); err != nil {
+		return c.Abort(400, "no oidc login in progress")
+	}
+	// the request is good for one callback only
+	c.DelSession(key)
+
+	token, claims, err := o.Callback(c.Request.URL.Query(), r)
+	if err != nil {
+		c.Warnf("oidc callback: %v", err)
+		return c.Abort(401, "Unauthorized")
+	}
+	p := o.principal(claims)
+	if p == nil || p.Id == "" {
+		return c.Abort(403, "Forbidden")
+	}
+	p.Strategy = "oidc"
+	// Login moves the session to a new id, the id which carried the login
+	// request through the provider is not the one of the user
+	if err = c.Action.Login(p); err != nil {
+		return err
+	}
+	if err = c.SessionEncode(c.App.AppConfig.CookiePrefix+OIDC_TOKEN_TAG, token); err != nil {
+		return err
+	}
+	next := r.Next
+	if next == "" {
+		next = o.SuccessUrl
+	}
+	return c.Redirect(next)
+}
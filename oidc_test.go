@@ -0,0 +1,95 @@
+package xweb
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/coscms/xweb/lib/jwt"
+	"github.com/coscms/xweb/lib/oidc"
+)
+
+// newOIDCProvider serves the discovery, the keys and a token endpoint which
+// signs an ID token for the nonce it is given.
+func newOIDCProvider(t *testing.T, nonce *string) *httptest.Server {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&oidc.Provider{
+			Issuer:   s.URL,
+			AuthURL:  s.URL + "/authorize",
+			TokenURL: s.URL + "/token",
+			JWKSURL:  s.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&jwt.KeySet{Keys: []jwt.JWK{jwt.NewEd25519JWK("k1", pub)}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		idToken, _ := jwt.Sign(jwt.EdDSA, key, jwt.Claims{
+			"iss":   s.URL,
+			"aud":   "app",
+			"sub":   "42",
+			"nonce": *nonce,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		}, "k1")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+			"expires_in":   3600,
+		})
+	})
+	return s
+}
+
+func TestOIDCCallbackRotatesSession(t *testing.T) {
+	var nonce string
+	provider := newOIDCProvider(t, &nonce)
+	defer provider.Close()
+	discovered, err := oidc.Discover(nil, provider.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, func(a *App) {
+		a.AppConfig.SessionOn = true
+		a.Auth = NewAuth("", &SessionAuth{Key: "user"})
+		a.OIDC = NewOIDCLogin(oidc.NewClient(discovered, "app", "secret", "http://localhost/oidc/callback"))
+	}, map[string]interface{}{"/oidc": &OIDCAction{}})
+	client := newTestClient(s)
+
+	w := client.get("/oidc/login?next=/home")
+	auth, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || w.Code != http.StatusFound {
+		t.Fatalf("expected a redirect to the provider, got %d %v", w.Code, w.Header())
+	}
+	nonce = auth.Query().Get("nonce")
+	before := client.Session()
+	if before == nil {
+		t.Fatal("the login should keep its state in the session")
+	}
+
+	w = client.get("/oidc/callback?code=thecode&state=" + url.QueryEscape(auth.Query().Get("state")))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/home" {
+		t.Fatalf("expected a redirect to next, got %d %v", w.Code, w.Header())
+	}
+	after := client.Session()
+	if after == nil || after.Id() == before.Id() {
+		t.Fatalf("the callback should move the session to a new id, got %v", after)
+	}
+	if s.RootApp.SessionManager.Store().Exist(before.Id()) {
+		t.Error("the session id from before the login should be removed")
+	}
+	if v, _ := after.Get("user").(string); v == "" {
+		t.Error("the user should be stored in the new session")
+	}
+}
@@ -0,0 +1,155 @@
+package xweb
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coscms/xweb/lib/ratelimit"
+)
+
+const (
+	RateLimitByIP      = "ip"
+	RateLimitBySession = "session"
+)
+
+// RateLimit limits the requests of every client to a route. Clients are
+// told apart by their ip, their session id or KeyFunc. Note that the ip
+// comes from Action.RemoteIP, which believes X-Forwarded-For only when the
+// request came from one of AppConfig.TrustedProxies.
+type RateLimit struct {
+	*ratelimit.Limiter
+	By      string
+	KeyFunc func(c *Action) string
+}
+
+func NewRateLimit(algorithm ratelimit.Algorithm, limit int64, period time.Duration) *RateLimit {
+	return &RateLimit{Limiter: ratelimit.New(algorithm, limit, period), By: RateLimitByIP}
+}
+
+// ParseRateLimit reads the ratelimit tag of a Mapper:
+//
+//	`ratelimit:"100/1m"`                 100 requests per minute and ip
+//	`ratelimit:"10/1s,bucket,session"`   a token bucket per session
+func ParseRateLimit(tag string) (*RateLimit, error) {
+	parts := strings.Split(tag, ",")
+	rate := strings.SplitN(parts[0], "/", 2)
+	if len(rate) != 2 {
+		return nil, errors.New("rate limit should be like 100/1m: " + tag)
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(rate[0]), 10, 64)
+	if err != nil || limit <= 0 {
+		return nil, errors.New("invalid rate limit: " + tag)
+	}
+	unit := strings.TrimSpace(rate[1])
+	period, err := time.ParseDuration(unit)
+	if err != nil {
+		period, err = time.ParseDuration("1" + unit)
+	}
+	if err != nil || period <= 0 {
+		return nil, errors.New("invalid rate limit period: " + tag)
+	}
+	r := NewRateLimit(ratelimit.SlidingWindow, limit, period)
+	for _, opt := range parts[1:] {
+		switch strings.TrimSpace(opt) {
+		case "bucket":
+			r.Algorithm = ratelimit.TokenBucket
+		case "window":
+			r.Algorithm = ratelimit.SlidingWindow
+		case RateLimitByIP:
+			r.By = RateLimitByIP
+		case RateLimitBySession:
+			r.By = RateLimitBySession
+		default:
+			return nil, errors.New("unknown rate limit option " + opt + ": " + tag)
+		}
+	}
+	return r, nil
+}
+
+func (r *RateLimit) key(c *Action) string {
+	if r.KeyFunc != nil {
+		return r.KeyFunc(c)
+	}
+	if r.By == RateLimitBySession && c.App.SessionManager != nil {
+		// don't create a session just to count the request, and don't
+		// believe ids the store doesn't know: a client could send a new
+		// one with every request
+		manager := c.App.SessionManager
+		if id, err := manager.Transfer().Get(c.Request); err == nil && id != "" && manager.Store().Exist(id) {
+			return "s:" + string(id)
+		}
+	}
+	return "ip:" + c.RemoteIP()
+}
+
+// addRateLimit registers the limit of a Mapper tag
+func (a *App) addRateLimit(t reflect.Type, method string, tag string) {
+	if tag == "" || tag == "-" {
+		return
+	}
+	r, err := ParseRateLimit(tag)
+	if err != nil {
+		a.Error(t.Name()+"."+method+":", err)
+		return
+	}
+	if a.rateLimits[t] == nil {
+		a.rateLimits[t] = make(map[string]*RateLimit)
+	}
+	a.rateLimits[t][method] = r
+}
+
+// checkRateLimit counts the request against the limits of its route group
+// and its Mapper. Denied requests get a 429.
+func (a *App) checkRateLimit(c *Action, t reflect.Type, method string) bool {
+	type scoped struct {
+		scope string
+		limit *RateLimit
+	}
+	limits := make([]scoped, 0, 2)
+	if a.MapperTag(t, method).Get("ratelimit") != "-" {
+		if g := a.routeGroup(a.relativePath(c.Request.URL.Path)); g != nil && g.RateLimit != nil {
+			limits = append(limits, scoped{"g:" + g.Prefix, g.RateLimit})
+		}
+	}
+	if r, ok := a.rateLimits[t][method]; ok {
+		limits = append(limits, scoped{"r:" + t.Name() + "." + method, r})
+	}
+	var result *ratelimit.Result
+	for _, l := range limits {
+		r, err := l.limit.Take(a.RateLimitStore, l.scope+"|"+l.limit.key(c))
+		if err != nil {
+			// don't turn a broken counter store into an outage
+			a.Error("rate limit:", err)
+			continue
+		}
+		if result == nil || !r.Allowed || (result.Allowed && r.Remaining < result.Remaining) {
+			result = r
+		}
+		if !r.Allowed {
+			break
+		}
+	}
+	if result == nil {
+		return true
+	}
+	header := c.ResponseWriter.Header()
+	header.Set("RateLimit-Limit", strconv.FormatInt(result.Limit, 10))
+	header.Set("RateLimit-Remaining", strconv.FormatInt(result.Remaining, 10))
+	header.Set("RateLimit-Reset", ceilSeconds(result.Reset))
+	if result.Allowed {
+		return true
+	}
+	header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+	c.StatusCode = http.StatusTooManyRequests
+	a.error(c.ResponseWriter, http.StatusTooManyRequests, "Too Many Requests")
+	return false
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
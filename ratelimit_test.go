@@ -0,0 +1,116 @@
+package xweb
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+type rateLimitAction struct {
+	*Action
+
+	ping  Mapper `xweb:"/ping" ratelimit:"2/1m"`
+	user  Mapper `xweb:"/user" ratelimit:"2/1m,session"`
+	login Mapper `xweb:"/login"`
+}
+
+func (c *rateLimitAction) Ping() string {
+	return "pong"
+}
+
+func (c *rateLimitAction) User() string {
+	return "user"
+}
+
+func (c *rateLimitAction) Login() string {
+	c.SetSession("user", "alice")
+	return "alice"
+}
+
+func newRateLimitServer(t *testing.T, proxies ...string) *Server {
+	return newTestServer(t, func(a *App) {
+		a.AppConfig.SessionOn = true
+		a.AppConfig.TrustedProxies = proxies
+	}, map[string]interface{}{"/": &rateLimitAction{}})
+}
+
+// rateLimited sends the request from remote and returns its status code.
+func rateLimited(tc *testClient, url, remote string, header http.Header) int {
+	req, _ := http.NewRequest("GET", url, nil)
+	req.RemoteAddr = remote
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return tc.do(req).Code
+}
+
+func TestRateLimitIgnoresForwardedFor(t *testing.T) {
+	s := newRateLimitServer(t)
+	client := newTestClient(s)
+	for i := 0; i < 3; i++ {
+		forged := http.Header{
+			"X-Forwarded-For": {"10.0.0." + strconv.Itoa(i)},
+			"X-Real-Ip":       {"10.0.1." + strconv.Itoa(i)},
+		}
+		code := rateLimited(client, "/ping", "192.0.2.1:1234", forged)
+		if i < 2 && code != http.StatusOK {
+			t.Fatalf("request %d should be allowed, got %d", i, code)
+		}
+		if i == 2 && code != http.StatusTooManyRequests {
+			t.Fatalf("forged X-Forwarded-For should not escape the limit, got %d", code)
+		}
+	}
+	if code := rateLimited(client, "/ping", "192.0.2.2:1234", nil); code != http.StatusOK {
+		t.Errorf("another client should have its own limit, got %d", code)
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	s := newRateLimitServer(t, "127.0.0.1", "10.1.0.0/16")
+	client := newTestClient(s)
+	// the client appends a forged hop, the proxies append the real one
+	via := func(ip string) http.Header {
+		return http.Header{"X-Forwarded-For": {"203.0.113.9, " + ip + ", 10.1.2.3"}}
+	}
+	for i := 0; i < 2; i++ {
+		if code := rateLimited(client, "/ping", "127.0.0.1:80", via("198.51.100.1")); code != http.StatusOK {
+			t.Fatalf("request %d should be allowed, got %d", i, code)
+		}
+	}
+	if code := rateLimited(client, "/ping", "127.0.0.1:80", via("198.51.100.1")); code != http.StatusTooManyRequests {
+		t.Errorf("the client behind the proxies should be limited, got %d", code)
+	}
+	if code := rateLimited(client, "/ping", "127.0.0.1:80", via("198.51.100.2")); code != http.StatusOK {
+		t.Errorf("another client behind the proxies should have its own limit, got %d", code)
+	}
+}
+
+func TestRateLimitUnknownSession(t *testing.T) {
+	s := newRateLimitServer(t)
+	client := newTestClient(s)
+	for i := 0; i < 3; i++ {
+		// a new made up session id with every request
+		req, _ := http.NewRequest("GET", "/user", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.AddCookie(&http.Cookie{Name: "SESSIONID", Value: "forged" + strconv.Itoa(i)})
+		code := client.do(req).Code
+		if i == 2 && code != http.StatusTooManyRequests {
+			t.Fatalf("unknown session ids should be limited by ip, got %d", code)
+		}
+	}
+
+	// a real session is limited on its own
+	client = newTestClient(s)
+	if code := rateLimited(client, "/login", "192.0.2.1:1234", nil); code != http.StatusOK {
+		t.Fatalf("login failed: %d", code)
+	}
+	for i := 0; i < 3; i++ {
+		code := rateLimited(client, "/user", "192.0.2.1:1234", nil)
+		if i < 2 && code != http.StatusOK {
+			t.Fatalf("request %d of the session should be allowed, got %d", i, code)
+		}
+		if i == 2 && code != http.StatusTooManyRequests {
+			t.Fatalf("the session should be limited, got %d", code)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package xweb
+
+import (
+	"strings"
+)
+
+// RouteGroup holds the settings shared by all the routes below a path
+// prefix of an App. Settings left nil fall back to those of the App.
+type RouteGroup struct {
+	App             *App
+	Prefix          string
+	SecurityHeaders *SecurityHeaders
+	Cors            *Cors
+	RateLimit       *RateLimit
+}
+
+// Group returns the group of the prefix, creating it on first use.
+//
+//	api := app.Group("/api")
+//	api.SecurityHeaders = &xweb.SecurityHeaders{NoSniff: true}
+//	api.AddRouter("/user", &UserAction{})
+func (a *App) Group(prefix string) *RouteGroup {
+	prefix = removeStick(prefix)
+	for _, g := range a.groups {
+		if g.Prefix == prefix {
+			return g
+		}
+	}
+	g := &RouteGroup{App: a, Prefix: prefix}
+	a.groups = append(a.groups, g)
+	return g
+}
+
+func (g *RouteGroup) AddRouter(url string, c interface{}) {
+	g.App.AddRouter(strings.TrimRight(g.Prefix, "/")+url, c)
+}
+
+// routeGroup returns the group with the longest prefix of the path
+func (a *App) routeGroup(reqPath string) *RouteGroup {
+	var found *RouteGroup
+	for _, g := range a.groups {
+		if g.Prefix != "/" && reqPath != g.Prefix && !strings.HasPrefix(reqPath, g.Prefix+"/") {
+			continue
+		}
+		if found == nil || len(g.Prefix) > len(found.Prefix) {
+			found = g
+		}
+	}
+	return found
+}
+
+// relativePath is the request path below the BasePath of the App
+func (a *App) relativePath(requestPath string) string {
+	reqPath := removeStick(requestPath)
+	if a.Domain == "" && a.BasePath != "/" {
+		reqPath = "/" + strings.TrimPrefix(reqPath, a.BasePath)
+	}
+	return reqPath
+}
@@ -0,0 +1,175 @@
+package xweb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const CSP_NONCE_TAG = "{nonce}"
+
+// SecurityHeaders are added to every response of an App or a RouteGroup.
+// Empty fields are not sent.
+type SecurityHeaders struct {
+	HSTSMaxAge            int64 //seconds, only sent over https
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	NoSniff               bool   //X-Content-Type-Options: nosniff
+	FrameOptions          string //DENY or SAMEORIGIN
+	ReferrerPolicy        string
+	PermissionsPolicy     string
+	CrossOriginOpener     string //Cross-Origin-Opener-Policy
+	CrossOriginEmbedder   string //Cross-Origin-Embedder-Policy
+	CrossOriginResource   string //Cross-Origin-Resource-Policy
+
+	// ContentSecurityPolicy may contain {nonce}, which is replaced by a
+	// new nonce for every request. Templates get it by {{cspNonce}}:
+	//
+	//	script-src 'self' 'nonce-{nonce}'
+	//	<script nonce="{{cspNonce}}">...</script>
+	ContentSecurityPolicy string
+	CSPReportOnly         bool
+}
+
+// NewSecurityHeaders returns headers which suit most sites, no CSP is set
+// because it depends on the pages.
+func NewSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		HSTSMaxAge:        365 * 86400,
+		NoSniff:           true,
+		FrameOptions:      "SAMEORIGIN",
+		ReferrerPolicy:    "strict-origin-when-cross-origin",
+		CrossOriginOpener: "same-origin",
+	}
+}
+
+// Apply sets the headers, nonce replaces {nonce} in the CSP.
+func (h *SecurityHeaders) Apply(w http.ResponseWriter, req *http.Request, nonce string) {
+	header := w.Header()
+	if h.HSTSMaxAge > 0 && (req.TLS != nil || req.URL.Scheme == "https") {
+		v := "max-age=" + strconv.FormatInt(h.HSTSMaxAge, 10)
+		if h.HSTSIncludeSubdomains {
+			v += "; includeSubDomains"
+		}
+		if h.HSTSPreload {
+			v += "; preload"
+		}
+		header.Set("Strict-Transport-Security", v)
+	}
+	if h.NoSniff {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	set := func(key, value string) {
+		if value != "" {
+			header.Set(key, value)
+		}
+	}
+	set("X-Frame-Options", h.FrameOptions)
+	set("Referrer-Policy", h.ReferrerPolicy)
+	set("Permissions-Policy", h.PermissionsPolicy)
+	set("Cross-Origin-Opener-Policy", h.CrossOriginOpener)
+	set("Cross-Origin-Embedder-Policy", h.CrossOriginEmbedder)
+	set("Cross-Origin-Resource-Policy", h.CrossOriginResource)
+	if h.ContentSecurityPolicy != "" {
+		key := "Content-Security-Policy"
+		if h.CSPReportOnly {
+			key += "-Report-Only"
+		}
+		header.Set(key, strings.Replace(h.ContentSecurityPolicy, CSP_NONCE_TAG, nonce, -1))
+	}
+}
+
+// securityHeaderNames are all the headers Apply may set
+var securityHeaderNames = []string{
+	"Strict-Transport-Security",
+	"X-Content-Type-Options",
+	"X-Frame-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+	"Cross-Origin-Opener-Policy",
+	"Cross-Origin-Embedder-Policy",
+	"Cross-Origin-Resource-Policy",
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+}
+
+func (h *SecurityHeaders) NeedNonce() bool {
+	return strings.Contains(h.ContentSecurityPolicy, CSP_NONCE_TAG)
+}
+
+type cspNonceKey struct{}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	// url-safe, so templates write it into attributes unescaped
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// securityHeaders returns the headers of the route group or the App
+func (a *App) securityHeaders(reqPath string) *SecurityHeaders {
+	if g := a.routeGroup(reqPath); g != nil && g.SecurityHeaders != nil {
+		return g.SecurityHeaders
+	}
+	return a.SecurityHeaders
+}
+
+// applySecurityHeaders sets the headers of the path and returns the request
+// carrying the CSP nonce.
+func (a *App) applySecurityHeaders(w http.ResponseWriter, req *http.Request) *http.Request {
+	h := a.securityHeaders(a.relativePath(req.URL.Path))
+	if h == nil {
+		return req
+	}
+	var nonce string
+	if h.NeedNonce() {
+		nonce = newCSPNonce()
+		req = req.WithContext(context.WithValue(req.Context(), cspNonceKey{}, nonce))
+	}
+	h.Apply(w, req, nonce)
+	return req
+}
+
+// routeSecurityHeaders replaces the headers of the App or group by those the
+// Mapper of the method chooses with its headers tag, e.g. for a page which
+// may be framed:
+//
+//	app.RouteSecurityHeaders["embed"] = &xweb.SecurityHeaders{NoSniff: true}
+//	widget Mapper `headers:"embed"`
+func (a *App) routeSecurityHeaders(c *Action, t reflect.Type, method string) {
+	name := a.MapperTag(t, method).Get("headers")
+	if name == "" {
+		return
+	}
+	h, ok := a.RouteSecurityHeaders[name]
+	if name != "-" && !ok {
+		a.Errorf("unknown security headers %q of %v.%v", name, t.Name(), method)
+		return
+	}
+	header := c.ResponseWriter.Header()
+	for _, key := range securityHeaderNames {
+		header.Del(key)
+	}
+	if name == "-" {
+		return
+	}
+	nonce := c.CSPNonce()
+	if nonce == "" && h.NeedNonce() {
+		nonce = newCSPNonce()
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), cspNonceKey{}, nonce))
+	}
+	h.Apply(c.ResponseWriter, c.Request, nonce)
+}
+
+// CSPNonce returns the nonce of the Content-Security-Policy of this request,
+// it is empty when the policy has no {nonce}.
+func (c *Action) CSPNonce() string {
+	nonce, _ := c.Request.Context().Value(cspNonceKey{}).(string)
+	return nonce
+}
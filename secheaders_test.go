@@ -0,0 +1,106 @@
+package xweb
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type secHeadersAction struct {
+	*Action
+
+	page   Mapper `xweb:"/page"`
+	widget Mapper `xweb:"/widget" headers:"embed"`
+	raw    Mapper `xweb:"/raw" headers:"-"`
+	api    Mapper `xweb:"/api/data"`
+}
+
+func (c *secHeadersAction) Page() error {
+	return c.RenderString(`<script nonce="{{cspNonce}}"></script>`)
+}
+
+func (c *secHeadersAction) Widget() error {
+	return c.RenderString(`<script nonce="{{cspNonce}}"></script>`)
+}
+
+func (c *secHeadersAction) Raw() string {
+	return "raw"
+}
+
+func (c *secHeadersAction) Api() string {
+	return "{}"
+}
+
+func newSecHeadersServer(t *testing.T) *Server {
+	return newTestServer(t, func(a *App) {
+		a.SecurityHeaders = NewSecurityHeaders()
+		a.SecurityHeaders.ContentSecurityPolicy = "script-src 'self' 'nonce-{nonce}'"
+		a.RouteSecurityHeaders = map[string]*SecurityHeaders{
+			"embed": {NoSniff: true, ContentSecurityPolicy: "frame-ancestors *; script-src 'nonce-{nonce}'"},
+		}
+		a.Group("/api").SecurityHeaders = &SecurityHeaders{NoSniff: true, CrossOriginResource: "cross-origin"}
+	}, map[string]interface{}{"/": &secHeadersAction{}})
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	client := newTestClient(newSecHeadersServer(t))
+	w := client.get("/page")
+	header := w.Header()
+	if header.Get("X-Frame-Options") != "SAMEORIGIN" || header.Get("X-Content-Type-Options") != "nosniff" ||
+		header.Get("Referrer-Policy") != "strict-origin-when-cross-origin" {
+		t.Errorf("unexpected headers %v", header)
+	}
+	if header.Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS should only be sent over https")
+	}
+
+	req, _ := http.NewRequest("GET", "/page", nil)
+	req.TLS = &tls.ConnectionState{}
+	if hsts := client.do(req).Header().Get("Strict-Transport-Security"); hsts != "max-age=31536000" {
+		t.Errorf("unexpected HSTS %q", hsts)
+	}
+
+	header = client.get("/api/data").Header()
+	if header.Get("X-Frame-Options") != "" || header.Get("Cross-Origin-Resource-Policy") != "cross-origin" {
+		t.Errorf("the headers of the group should be sent, got %v", header)
+	}
+}
+
+func TestCSPNonce(t *testing.T) {
+	client := newTestClient(newSecHeadersServer(t))
+	nonces := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		w := client.get("/page")
+		csp := w.Header().Get("Content-Security-Policy")
+		nonce := strings.TrimSuffix(strings.TrimPrefix(csp, "script-src 'self' 'nonce-"), "'")
+		if nonce == "" || nonce == csp || w.Body.String() != `<script nonce="`+nonce+`"></script>` {
+			t.Fatalf("the page should use the nonce of %q, got %q", csp, w.Body.String())
+		}
+		nonces[nonce] = true
+	}
+	if len(nonces) != 2 {
+		t.Error("every request should get a new nonce")
+	}
+}
+
+func TestRouteSecurityHeaders(t *testing.T) {
+	client := newTestClient(newSecHeadersServer(t))
+	w := client.get("/widget")
+	header := w.Header()
+	if header.Get("X-Frame-Options") != "" || header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("the headers of the route should replace those of the app, got %v", header)
+	}
+	csp := header.Get("Content-Security-Policy")
+	if !strings.HasPrefix(csp, "frame-ancestors *") || !strings.Contains(csp, "'nonce-") ||
+		!strings.Contains(w.Body.String(), strings.TrimSuffix(csp[strings.Index(csp, "'nonce-")+7:], "'")) {
+		t.Errorf("the page should use the nonce of the route policy %q, got %q", csp, w.Body.String())
+	}
+
+	header = client.get("/raw").Header()
+	for _, key := range securityHeaderNames {
+		if header.Get(key) != "" {
+			t.Errorf("%v should not be sent by a route tagged headers:\"-\"", key)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package xweb
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
 	"net/http"
@@ -46,7 +47,7 @@ type Server struct {
 	Domain2App     map[string]string //r["www.coscms.com"]="root"
 	AppsNamePath   map[string]string //r["root"]="/"
 	Name           string
-	SessionManager *httpsession.Manager
+	SessionManager *httpsession.Manager //shared by all apps, their AppConfig.Session* fields are then ignored
 	RootApp        *App
 	Logger         *log.Logger
 	Env            map[string]interface{}
@@ -160,11 +161,12 @@ type ServerInformation struct {
 // Process invokes the routing system for server s
 // non-root app's route will override root app's if there is same path
 func (s *Server) Process(w http.ResponseWriter, req *http.Request) {
-	s.RootApp.RequestTime = time.Now()
+	start := time.Now()
+	req = req.WithContext(context.WithValue(req.Context(), requestStartKey{}, start))
 
 	//set some default headers
 	w.Header().Set("Server", "xweb v"+Version)
-	w.Header().Set("Date", webTime(s.RootApp.RequestTime.UTC()))
+	w.Header().Set("Date", webTime(start.UTC()))
 
 	Event("ServerProcess", &ServerInformation{s, w, req}, func(result bool) {
 		if !result {
@@ -210,7 +212,6 @@ func (s *Server) Process(w http.ResponseWriter, req *http.Request) {
 			}
 			if appName != "" {
 				if app := s.App(appName); app != nil {
-					app.RequestTime = s.RootApp.RequestTime
 					app.routeHandler(req, w)
 					return
 				}
@@ -218,7 +219,6 @@ func (s *Server) Process(w http.ResponseWriter, req *http.Request) {
 		}
 		for _, app := range s.Apps {
 			if app != s.RootApp && strings.HasPrefix(req.URL.Path, app.BasePath) {
-				app.RequestTime = s.RootApp.RequestTime
 				app.routeHandler(req, w)
 				return
 			}
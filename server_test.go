@@ -0,0 +1,103 @@
+package xweb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coscms/xweb/httpsession"
+	"github.com/coscms/xweb/log"
+)
+
+// newTestServer returns a server with the routes, configure changes the
+// root app before the server is initialized.
+func newTestServer(t *testing.T, configure func(*App), routes map[string]interface{}) *Server {
+	s := NewServer(fmt.Sprintf("test%p", t))
+	s.RootApp.Logger = log.New(ioutil.Discard, "", 0)
+	if configure != nil {
+		configure(s.RootApp)
+	}
+	for path, action := range routes {
+		s.AddRouter(path, action)
+	}
+	s.initServer()
+	return s
+}
+
+// testClient keeps the cookies the server sets, like a browser.
+type testClient struct {
+	s       *Server
+	cookies map[string]*http.Cookie
+}
+
+func newTestClient(s *Server) *testClient {
+	return &testClient{s: s, cookies: make(map[string]*http.Cookie)}
+}
+
+func (tc *testClient) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range tc.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	tc.s.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(tc.cookies, cookie.Name)
+		} else {
+			tc.cookies[cookie.Name] = cookie
+		}
+	}
+	return w
+}
+
+// Session returns the stored session of the client, nil if it has none.
+func (tc *testClient) Session() *httpsession.Session {
+	manager := tc.s.RootApp.SessionManager
+	cookie, ok := tc.cookies[httpsession.DefaultSessionName]
+	if !ok || !manager.Store().Exist(httpsession.Id(cookie.Value)) {
+		return nil
+	}
+	return httpsession.NewSession(httpsession.Id(cookie.Value), 0, manager)
+}
+
+func (tc *testClient) get(url string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	return tc.do(req)
+}
+
+type sessionLockAction struct {
+	*Action
+
+	hello Mapper `xweb:"/hello"`
+	login Mapper `xweb:"/login"`
+}
+
+func (c *sessionLockAction) Hello() string {
+	return "hello"
+}
+
+func (c *sessionLockAction) Login() string {
+	c.SetSession("user", "alice")
+	return c.GetSessionString("user")
+}
+
+func TestSessionLockKeepsAnonymousRequests(t *testing.T) {
+	s := newTestServer(t, func(a *App) {
+		a.AppConfig.SessionOn = true
+		a.AppConfig.SessionLock = true
+	}, map[string]interface{}{"/": &sessionLockAction{}})
+
+	client := newTestClient(s)
+	w := client.get("/hello")
+	if w.Body.String() != "hello" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("no session should be created, got %q %v", w.Body.String(), w.Result().Cookies())
+	}
+	if body := client.get("/login").Body.String(); body != "alice" || len(client.cookies) != 1 {
+		t.Errorf("the session should be created by the action, got %q %v", body, client.cookies)
+	}
+	if body := client.get("/hello").Body.String(); body != "hello" {
+		t.Errorf("a request with a session should be served, got %q", body)
+	}
+}
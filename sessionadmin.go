@@ -0,0 +1,168 @@
+package xweb
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coscms/xweb/httpsession"
+	"github.com/coscms/xweb/lib/str"
+)
+
+// SessionAdminAction lists the active sessions and revokes them. Mount it
+// behind your own access control:
+//
+//	app.AddRouter("/admin/sessions", &xweb.SessionAdminAction{})
+//
+// Sessions are shown by a fingerprint of their id, so the page never
+// leaks ids which could be used to take a session over.
+type SessionAdminAction struct {
+	*Action
+
+	// Keys are the session keys shown on the admin page, such as the user
+	// id of a login, no values are shown when it is empty. The xsrf and
+	// oidc tokens are never shown. Set it on the action given to AddRouter:
+	//
+	//	app.AddRouter("/admin/sessions", &xweb.SessionAdminAction{Keys: []string{"user"}})
+	Keys []string
+
+	index  Mapper `xweb:"/"`
+	revoke Mapper `xweb:"POST /revoke"`
+}
+
+type SessionAdminInfo struct {
+	Fingerprint string
+	Values      map[string]interface{}
+	Last        time.Time
+}
+
+func sessionFingerprint(id httpsession.Id) string {
+	return str.Md5(string(id))[:16]
+}
+
+// keys returns the Keys of the registered action, every request gets an
+// action of its own. The keys of tokens are left out, their values would
+// let an admin take the session over.
+func (c *SessionAdminAction) keys() []string {
+	a, ok := c.App.Action("SessionAdminAction").(*SessionAdminAction)
+	if !ok {
+		return nil
+	}
+	prefix := c.App.AppConfig.CookiePrefix
+	keys := make([]string, 0, len(a.Keys))
+	for _, k := range a.Keys {
+		switch k {
+		case prefix + XSRF_TAG, prefix + OIDC_TOKEN_TAG, prefix + OIDC_REQUEST_TAG:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (c *SessionAdminAction) manager() *httpsession.Manager {
+	if !c.App.AppConfig.SessionOn {
+		return nil
+	}
+	return c.App.SessionManager
+}
+
+func (c *SessionAdminAction) Index() error {
+	manager := c.manager()
+	if manager == nil {
+		return c.Abort(404, "session is off")
+	}
+	keys := c.keys()
+	sessions := make([]*SessionAdminInfo, 0)
+	err := manager.Range(func(info *httpsession.SessionInfo) bool {
+		if strings.HasPrefix(string(info.Id), ThrottleIdPrefix) {
+			return true
+		}
+		s := &SessionAdminInfo{
+			Fingerprint: sessionFingerprint(info.Id),
+			Values:      make(map[string]interface{}),
+			Last:        info.Last,
+		}
+		for _, k := range keys {
+			if v, ok := info.Values[k]; ok {
+				s.Values[k] = v
+			}
+		}
+		sessions = append(sessions, s)
+		return true
+	})
+	if err != nil {
+		return c.Abort(501, err.Error())
+	}
+	sort.Sort(byLastAccess(sessions))
+	c.T["sessions"] = sessions
+	c.T["count"] = len(sessions)
+	if c.ExtensionName == "json" || c.ExtensionName == "xml" {
+		return nil
+	}
+	c.T["revokeUrl"] = path.Join(c.Request.URL.Path, "revoke")
+	return c.RenderString(sessionAdminTmpl)
+}
+
+// Revoke removes the session given by its fingerprint, or all the sessions
+// whose key has the given value.
+func (c *SessionAdminAction) Revoke() error {
+	manager := c.manager()
+	if manager == nil {
+		return c.Abort(404, "session is off")
+	}
+	var n int
+	var err error
+	if fp := c.GetString("fingerprint"); fp != "" {
+		ids := make([]httpsession.Id, 0)
+		err = manager.Range(func(info *httpsession.SessionInfo) bool {
+			if sessionFingerprint(info.Id) == fp {
+				ids = append(ids, info.Id)
+				return false
+			}
+			return true
+		})
+		n = manager.Revoke(ids...)
+	} else if key := c.GetString("key"); key != "" {
+		n, err = manager.RevokeBy(key, c.GetString("value"))
+	}
+	if err != nil {
+		return c.Abort(501, err.Error())
+	}
+	if c.ExtensionName == "json" || c.ExtensionName == "xml" {
+		c.T["revoked"] = n
+		return nil
+	}
+	c.Flash().Success("%d session(s) revoked", n)
+	return c.Redirect(path.Dir(c.Request.URL.Path) + "/")
+}
+
+type byLastAccess []*SessionAdminInfo
+
+func (s byLastAccess) Len() int           { return len(s) }
+func (s byLastAccess) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLastAccess) Less(i, j int) bool { return s[i].Last.After(s[j].Last) }
+
+var sessionAdminTmpl = `<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8" /><title>Sessions</title></head>
+<body>
+{{range flashes}}<p class="{{.Type}}">{{.Message}}</p>{{end}}
+<h1>{{.T.count}} active sessions</h1>
+<form method="post" action="{{.T.revokeUrl}}">{{XsrfFormHtml}}
+	key <input name="key" /> value <input name="value" /> <button>Revoke all</button>
+</form>
+<table>
+<tr><th>Session</th><th>Last access</th><th>Values</th><th></th></tr>
+{{range .T.sessions}}<tr>
+	<td>{{.Fingerprint}}</td>
+	<td>{{.Last.Format "2006-01-02 15:04:05"}}</td>
+	<td>{{range $k, $v := .Values}}{{$k}}={{$v}} {{end}}</td>
+	<td><form method="post" action="{{$.T.revokeUrl}}">{{XsrfFormHtml}}
+		<input type="hidden" name="fingerprint" value="{{.Fingerprint}}" /><button>Revoke</button>
+	</form></td>
+</tr>{{end}}
+</table>
+</body>
+</html>`
@@ -0,0 +1,65 @@
+package xweb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSessionAdmin(t *testing.T) {
+	s := newTestServer(t, func(a *App) {
+		a.AppConfig.SessionOn = true
+		a.AppConfig.CheckXsrf = false
+	}, map[string]interface{}{
+		"/":               &sessionLockAction{},
+		"/admin/sessions": &SessionAdminAction{Keys: []string{"user"}},
+	})
+	user := newTestClient(s)
+	user.get("/login")
+	user.Session().Set("secret", "x")
+
+	admin := newTestClient(s)
+	body := admin.get("/admin/sessions/").Body.String()
+	if !strings.Contains(body, `action="/admin/sessions/revoke"`) {
+		t.Errorf("the form should post to /admin/sessions/revoke, got %s", body)
+	}
+	if !strings.Contains(body, "user=alice") || strings.Contains(body, "secret") {
+		t.Errorf("only the keys of the action should be shown, got %s", body)
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/sessions/revoke",
+		strings.NewReader(url.Values{"key": {"user"}, "value": {"alice"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := admin.do(req)
+	if location := w.Header().Get("Location"); location != "/admin/sessions/" {
+		t.Errorf("expected a redirect to the list, got %v %q", w.Code, location)
+	}
+	if user.Session() != nil {
+		t.Error("the session of alice should be revoked")
+	}
+}
+
+func TestSessionAdminHidesSecrets(t *testing.T) {
+	for _, keys := range [][]string{nil, {XSRF_TAG, OIDC_TOKEN_TAG, OIDC_REQUEST_TAG}} {
+		s := newTestServer(t, func(a *App) {
+			a.AppConfig.SessionOn = true
+			a.AppConfig.CheckXsrf = false
+		}, map[string]interface{}{
+			"/":               &sessionLockAction{},
+			"/admin/sessions": &SessionAdminAction{Keys: keys},
+		})
+		user := newTestClient(s)
+		user.get("/login")
+		user.Session().Set(XSRF_TAG, "xsrf-token")
+		user.Session().Set(OIDC_TOKEN_TAG, "access-token")
+		user.Session().Set(OIDC_REQUEST_TAG, "pkce-verifier")
+
+		body := newTestClient(s).get("/admin/sessions/").Body.String()
+		for _, secret := range []string{"alice", "xsrf-token", "access-token", "pkce-verifier"} {
+			if strings.Contains(body, secret) {
+				t.Errorf("Keys %v: %q should not be shown, got %s", keys, secret, body)
+			}
+		}
+	}
+}
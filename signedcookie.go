@@ -0,0 +1,141 @@
+package xweb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coscms/xweb/lib/str"
+)
+
+var (
+	ErrCookieSignature = errors.New("the cookie signature is invalid")
+	ErrCookieExpired   = errors.New("the signed cookie is expired")
+)
+
+const (
+	signedCookieVersion    = "v1"
+	DefaultSignedCookieAge = 31 * 24 * time.Hour
+)
+
+// SignedCookieCodec signs cookie values with HMAC-SHA256. The signed value
+// is
+//
+//	v1|key id|timestamp|base64 value|signature
+//
+// and the signature covers the cookie name too, so a value can not be
+// moved to another cookie. The first of the Keys signs, all of them verify.
+type SignedCookieCodec struct {
+	Keys   []string
+	MaxAge time.Duration
+}
+
+func NewSignedCookieCodec(keys ...string) *SignedCookieCodec {
+	return &SignedCookieCodec{Keys: keys, MaxAge: DefaultSignedCookieAge}
+}
+
+func signedCookieKeyId(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+func (s *SignedCookieCodec) sign(key, name, payload string, context []string) string {
+	hm := hmac.New(sha256.New, []byte(key))
+	hm.Write([]byte(name))
+	hm.Write([]byte{'|'})
+	hm.Write([]byte(payload))
+	for _, v := range context {
+		hm.Write([]byte{'|'})
+		hm.Write([]byte(v))
+	}
+	return base64.RawURLEncoding.EncodeToString(hm.Sum(nil))
+}
+
+// Encode signs value for the cookie name, the context (such as the client
+// ip) has to be the same when decoding.
+func (s *SignedCookieCodec) Encode(name, value string, context ...string) string {
+	if len(s.Keys) == 0 {
+		return ""
+	}
+	key := s.Keys[0]
+	payload := strings.Join([]string{
+		signedCookieVersion,
+		signedCookieKeyId(key),
+		strconv.FormatInt(time.Now().Unix(), 10),
+		base64.RawURLEncoding.EncodeToString([]byte(value)),
+	}, "|")
+	return payload + "|" + s.sign(key, name, payload, context)
+}
+
+func (s *SignedCookieCodec) Decode(name, signed string, context ...string) (string, error) {
+	parts := strings.Split(signed, "|")
+	if len(parts) != 5 || parts[0] != signedCookieVersion {
+		return "", ErrCookieSignature
+	}
+	payload := signed[:len(signed)-len(parts[4])-1]
+	var valid bool
+	for _, key := range s.Keys {
+		if signedCookieKeyId(key) == parts[1] &&
+			hmac.Equal([]byte(s.sign(key, name, payload, context)), []byte(parts[4])) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrCookieSignature
+	}
+	if err := s.checkAge(parts[2]); err != nil {
+		return "", err
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", ErrCookieSignature
+	}
+	return string(value), nil
+}
+
+func (s *SignedCookieCodec) checkAge(timestamp string) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrCookieSignature
+	}
+	maxAge := s.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultSignedCookieAge
+	}
+	if time.Now().Unix()-int64(maxAge/time.Second) > ts {
+		return ErrCookieExpired
+	}
+	return nil
+}
+
+// IsLegacySignedCookie reports whether the value was signed by the old
+// value|timestamp|token format of SetSecureCookie.
+func IsLegacySignedCookie(signed string) bool {
+	return strings.Count(signed, "|") == 2
+}
+
+// DecodeLegacy reads a value signed by the old format, authKey is what
+// Action.CookieAuthKey returned when it was signed.
+func (s *SignedCookieCodec) DecodeLegacy(signed, authKey string) (string, error) {
+	parts := strings.SplitN(signed, "|", 3)
+	if len(parts) < 3 {
+		return "", ErrCookieSignature
+	}
+	if !hmac.Equal([]byte(str.Token(authKey, []byte(parts[0]), parts[1])), []byte(parts[2])) {
+		return "", ErrCookieSignature
+	}
+	if err := s.checkAge(parts[1]); err != nil {
+		return "", err
+	}
+	value, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return "", ErrCookieSignature
+	}
+	return string(value), nil
+}
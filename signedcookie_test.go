@@ -0,0 +1,136 @@
+package xweb
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coscms/xweb/lib/str"
+)
+
+func TestSignedCookieCodec(t *testing.T) {
+	codec := NewSignedCookieCodec("secret")
+	signed := codec.Encode("user", "alice|admin", "10.0.0.1")
+	if v, err := codec.Decode("user", signed, "10.0.0.1"); err != nil || v != "alice|admin" {
+		t.Errorf("expected alice|admin, got %q %v", v, err)
+	}
+	if _, err := codec.Decode("other", signed, "10.0.0.1"); err != ErrCookieSignature {
+		t.Errorf("the value should not be valid for another cookie, got %v", err)
+	}
+	if _, err := codec.Decode("user", signed, "10.0.0.2"); err != ErrCookieSignature {
+		t.Errorf("the value should not be valid in another context, got %v", err)
+	}
+	parts := strings.Split(signed, "|")
+	parts[3] = "Ym9i" // bob
+	if _, err := codec.Decode("user", strings.Join(parts, "|"), "10.0.0.1"); err != ErrCookieSignature {
+		t.Errorf("a changed value should be rejected, got %v", err)
+	}
+	parts = strings.Split(signed, "|")
+	parts[2] = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	if _, err := codec.Decode("user", strings.Join(parts, "|"), "10.0.0.1"); err != ErrCookieSignature {
+		t.Errorf("a changed timestamp should be rejected, got %v", err)
+	}
+
+	codec.MaxAge = time.Second
+	parts = strings.Split(codec.Encode("user", "alice"), "|")
+	parts[2] = strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	payload := strings.Join(parts[:4], "|")
+	old := payload + "|" + codec.sign("secret", "user", payload, nil)
+	if _, err := codec.Decode("user", old); err != ErrCookieExpired {
+		t.Errorf("expected ErrCookieExpired, got %v", err)
+	}
+}
+
+func TestSignedCookieKeyRotation(t *testing.T) {
+	signed := NewSignedCookieCodec("old").Encode("user", "alice")
+	if v, err := NewSignedCookieCodec("new", "old").Decode("user", signed); err != nil || v != "alice" {
+		t.Errorf("the old key should still verify, got %q %v", v, err)
+	}
+	if _, err := NewSignedCookieCodec("new").Decode("user", signed); err != ErrCookieSignature {
+		t.Errorf("a dropped key should not verify, got %v", err)
+	}
+}
+
+// legacyCookie signs value the way SetSecureCookie did before the codec
+func legacyCookie(value, authKey string, at time.Time) string {
+	vs := str.Base64Encode(value)
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return vs + "|" + timestamp + "|" + str.Token(authKey, []byte(vs), timestamp)
+}
+
+type secureCookieAction struct {
+	*Action
+
+	get     Mapper `xweb:"/get"`
+	options Mapper `xweb:"/options"`
+}
+
+func (c *secureCookieAction) Options() string {
+	o := c.CookieOptions()
+	c.SetCookie(c.NewCookie("default", "1", o))
+	c.SetCookie(c.NewCookie("strict", "1", &CookieOptions{MaxAge: 60, Secure: true,
+		SameSite: http.SameSiteStrictMode, Partitioned: true}))
+	c.SetCookie(c.NewCookie("positional", "1", int64(60), "/app"))
+	return "ok"
+}
+
+func (c *secureCookieAction) Get() string {
+	v, _ := c.GetSecureCookie("user")
+	return v
+}
+
+func TestCookieOptions(t *testing.T) {
+	s := newTestServer(t, func(a *App) {
+		a.AppConfig.SessionTimeout = time.Hour
+		a.AppConfig.CookieSameSite = http.SameSiteLaxMode
+		a.AppConfig.CookieDomain = "example.com"
+	}, map[string]interface{}{"/": &secureCookieAction{}})
+	cookies := newTestClient(s).get("/options").Header()["Set-Cookie"]
+	if len(cookies) != 3 {
+		t.Fatalf("expected 3 cookies, got %v", cookies)
+	}
+	for i, attrs := range [][]string{
+		{"default=1", "Max-Age=3600", "Domain=example.com", "HttpOnly", "SameSite=Lax"},
+		{"strict=1", "Max-Age=60", "Path=/", "Domain=example.com", "Secure", "SameSite=Strict", "Partitioned"},
+		{"positional=1", "Expires=", "Path=/app"},
+	} {
+		for _, attr := range attrs {
+			if !strings.Contains(cookies[i], attr) {
+				t.Errorf("%q should have %q", cookies[i], attr)
+			}
+		}
+	}
+}
+
+func TestLegacySecureCookie(t *testing.T) {
+	var app *App
+	s := newTestServer(t, func(a *App) {
+		a.AppConfig.CookieSecret = "secret"
+		app = a
+	}, map[string]interface{}{"/": &secureCookieAction{}})
+	if until := app.AppConfig.LegacyCookieUntil; until.IsZero() || until.After(time.Now().Add(DefaultSignedCookieAge)) {
+		t.Fatalf("legacy cookies should be read for one cookie lifetime, until %v", until)
+	}
+
+	get := func(value string) string {
+		req, _ := http.NewRequest("GET", "/get", nil)
+		req.AddCookie(&http.Cookie{Name: "user", Value: value})
+		return newTestClient(s).do(req).Body.String()
+	}
+	legacy := legacyCookie("alice", "secret", time.Now())
+	if v := get(legacy); v != "alice" {
+		t.Errorf("a legacy cookie should be read, got %q", v)
+	}
+	if v := get(legacyCookie("alice", "guess", time.Now())); v != "" {
+		t.Errorf("a forged legacy cookie should be rejected, got %q", v)
+	}
+	app.AppConfig.LegacyCookieUntil = time.Now().Add(-time.Second)
+	if v := get(legacy); v != "" {
+		t.Errorf("legacy cookies should be rejected after LegacyCookieUntil, got %q", v)
+	}
+	if v := get(app.CookieCodec.Encode("user", "bob")); v != "bob" {
+		t.Errorf("expected bob, got %q", v)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"crypto/md5"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sync"
 	"time"
@@ -20,6 +22,7 @@ type StaticVerMgr struct {
 	Combines      map[string]bool
 	mutex         *sync.Mutex
 	Path          string
+	FS            fs.FS //where the files are read, AppConfig.StaticFS or Path
 	Ignores       map[string]bool
 	app           *App
 	timerCallback func() bool
@@ -27,7 +30,8 @@ type StaticVerMgr struct {
 	initialized   bool
 }
 
-func (self *StaticVerMgr) Moniter(staticPath string) error {
+// Moniter watches the directories on disk of the FS.
+func (self *StaticVerMgr) Moniter(staticPaths ...string) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -44,6 +48,13 @@ func (self *StaticVerMgr) Moniter(staticPath string) error {
 				if _, ok := self.Ignores[filepath.Base(ev.Name)]; ok {
 					break
 				}
+				url := relName(staticPaths, ev.Name)
+				if ev.IsDelete() || ev.IsRename() {
+					watcher.RemoveWatch(ev.Name)
+					self.CacheDelete(url)
+					self.DeleteCombined(url)
+					break
+				}
 				d, err := os.Stat(ev.Name)
 				if err != nil {
 					break
@@ -53,32 +64,14 @@ func (self *StaticVerMgr) Moniter(staticPath string) error {
 					if d.IsDir() {
 						watcher.Watch(ev.Name)
 					} else {
-						url := ev.Name[len(self.Path)+1:]
 						self.CacheItem(url)
 					}
-				} else if ev.IsDelete() {
-					if d.IsDir() {
-						watcher.RemoveWatch(ev.Name)
-					} else {
-						url := ev.Name[len(self.Path)+1:]
-						self.CacheDelete(url)
-						self.DeleteCombined(url)
-					}
 				} else if ev.IsModify() {
 					if d.IsDir() {
 					} else {
-						url := ev.Name[len(staticPath)+1:]
 						self.CacheItem(url)
 						self.DeleteCombined(url)
 					}
-				} else if ev.IsRename() {
-					if d.IsDir() {
-						watcher.RemoveWatch(ev.Name)
-					} else {
-						url := ev.Name[len(staticPath)+1:]
-						self.CacheDelete(url)
-						self.DeleteCombined(url)
-					}
 				}
 			case err := <-watcher.Error:
 				self.app.Errorf("error: %v", err)
@@ -93,16 +86,18 @@ func (self *StaticVerMgr) Moniter(staticPath string) error {
 		}
 	}()
 
-	err = filepath.Walk(staticPath, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return watcher.Watch(f)
-		}
-		return nil
-	})
+	for _, staticPath := range staticPaths {
+		err = filepath.Walk(staticPath, func(f string, info os.FileInfo, err error) error {
+			if info.IsDir() {
+				return watcher.Watch(f)
+			}
+			return nil
+		})
 
-	if err != nil {
-		fmt.Println(err)
-		return err
+		if err != nil {
+			fmt.Println(err)
+			return err
+		}
 	}
 
 	<-done
@@ -115,7 +110,7 @@ func (self *StaticVerMgr) defaultTimerCallback() func() bool {
 			return self.TimerCallback()
 		}
 		//更改模板主题后，关闭当前监控，重新监控新目录
-		if self.app.AppConfig.StaticDir == self.Path {
+		if self.app.AppConfig.StaticDir == self.Path || !isOSDir(self.FS, self.Path) {
 			return true
 		}
 		for f, _ := range self.Combines {
@@ -125,7 +120,8 @@ func (self *StaticVerMgr) defaultTimerCallback() func() bool {
 		self.Combined = make(map[string][]string)
 		self.Combines = make(map[string]bool)
 		self.Path = self.app.AppConfig.StaticDir
-		go self.Moniter(self.Path)
+		self.FS = OSDir(self.Path)
+		go self.Moniter(osDirs(self.FS)...)
 		return false
 	}
 }
@@ -145,8 +141,16 @@ func (self *StaticVerMgr) Close() {
 }
 
 func (self *StaticVerMgr) Init(app *App, staticPath string) error {
+	fsys := app.AppConfig.StaticFS
+	if fsys == nil {
+		fsys = OSDir(staticPath)
+	}
+	return self.initFS(app, staticPath, fsys)
+}
+
+func (self *StaticVerMgr) initFS(app *App, staticPath string, fsys fs.FS) error {
 	if self.initialized {
-		if staticPath == self.Path {
+		if staticPath == self.Path && isOSDir(fsys, staticPath) && isOSDir(self.FS, staticPath) {
 			return nil
 		} else {
 			self.TimerCallback = func() bool {
@@ -162,6 +166,7 @@ func (self *StaticVerMgr) Init(app *App, staticPath string) error {
 		}
 	}
 	self.Path = staticPath
+	self.FS = fsys
 	self.Caches = make(map[string]string)
 	self.Combined = make(map[string][]string)
 	self.Combines = make(map[string]bool)
@@ -169,32 +174,19 @@ func (self *StaticVerMgr) Init(app *App, staticPath string) error {
 	self.Ignores = map[string]bool{".DS_Store": true}
 	self.app = app
 
-	if dirExists(staticPath) {
+	if dirs := osDirs(fsys); len(dirs) > 0 {
 		//self.CacheAll(staticPath)
 		self.timerCallback = self.defaultTimerCallback()
-		go self.Moniter(staticPath)
+		go self.Moniter(dirs...)
 	}
 	self.initialized = true
 	return nil
 }
 
 func (self *StaticVerMgr) getFileVer(url string) string {
-	//content, err := ioutil.ReadFile(path.Join(self.Path, url))
-	fPath := filepath.Join(self.Path, url)
+	fPath := fsPath(url)
 	self.app.Debug("loaded static ", fPath)
-	f, err := os.Open(fPath)
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-
-	fInfo, err := f.Stat()
-	if err != nil {
-		return ""
-	}
-
-	content := make([]byte, int(fInfo.Size()))
-	_, err = f.Read(content)
+	content, err := fs.ReadFile(self.FS, fPath)
 	if err == nil {
 		h := md5.New()
 		io.WriteString(h, string(content))
@@ -203,17 +195,19 @@ func (self *StaticVerMgr) getFileVer(url string) string {
 	return ""
 }
 
+// CacheAll gets the versions of all the files of the FS.
 func (self *StaticVerMgr) CacheAll(staticPath string) error {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	fmt.Print("Getting static file version number, please wait... ")
-	err := filepath.Walk(staticPath, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+	err := fs.WalkDir(self.FS, ".", func(rp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
 			return nil
 		}
-		rp := f[len(staticPath)+1:]
-		rp = FixDirSeparator(rp)
-		if _, ok := self.Ignores[filepath.Base(rp)]; !ok {
+		if _, ok := self.Ignores[path.Base(rp)]; !ok {
 			self.Caches[rp] = self.getFileVer(rp)
 		}
 		return nil
@@ -223,6 +217,7 @@ func (self *StaticVerMgr) CacheAll(staticPath string) error {
 }
 
 func (self *StaticVerMgr) GetVersion(url string) string {
+	url = fsPath(url)
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	if ver, ok := self.Caches[url]; ok {
@@ -237,7 +232,7 @@ func (self *StaticVerMgr) GetVersion(url string) string {
 }
 
 func (self *StaticVerMgr) CacheDelete(url string) {
-	url = FixDirSeparator(url)
+	url = fsPath(url)
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	if _, ok := self.Caches[url]; ok {
@@ -247,7 +242,7 @@ func (self *StaticVerMgr) CacheDelete(url string) {
 }
 
 func (self *StaticVerMgr) CacheItem(url string) {
-	url = FixDirSeparator(url)
+	url = fsPath(url)
 	ver := self.getFileVer(url)
 	if ver != "" {
 		self.mutex.Lock()
@@ -44,6 +44,7 @@ var statusText = map[int]string{
 	http.StatusUnsupportedMediaType:         "Unsupported Media Type",
 	http.StatusRequestedRangeNotSatisfiable: "Requested Range Not Satisfiable",
 	http.StatusExpectationFailed:            "Expectation Failed",
+	http.StatusTooManyRequests:              "Too Many Requests",
 
 	http.StatusInternalServerError:     "Internal Server Error",
 	http.StatusNotImplemented:          "Not Implemented",
@@ -0,0 +1,133 @@
+package xweb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultStreamBuffer is how many bytes a streamed render keeps before the
+// response is sent, see AppConfig.StreamBuffer.
+var DefaultStreamBuffer = 4096
+
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// streamWriter holds the output of a streamed render until the buffer is
+// full or the template calls flush. Then the headers are sent and the rest
+// of the body goes out in chunks, compressed if the client accepts it.
+// Until that moment the response can still become an error page.
+type streamWriter struct {
+	c       *Action
+	buf     bytes.Buffer
+	limit   int
+	out     io.Writer
+	encoder flushWriteCloser
+	flushed bool
+}
+
+func newStreamWriter(c *Action) *streamWriter {
+	limit := c.App.AppConfig.StreamBuffer
+	if limit <= 0 {
+		limit = DefaultStreamBuffer
+	}
+	return &streamWriter{c: c, limit: limit}
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.flushed {
+		n, err := s.out.Write(p)
+		s.c.ResponseSize += int64(n)
+		return n, err
+	}
+	s.buf.Write(p)
+	if s.buf.Len() >= s.limit {
+		if err := s.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends the headers the first time, then what has been written.
+func (s *streamWriter) Flush() error {
+	if !s.flushed {
+		s.flushed = true
+		// no Content-Length, the body is sent chunked
+		s.c.ResponseWriter.Header().Del("Content-Length")
+		s.out = s.c.ResponseWriter
+		if s.encoder = s.c.contentEncoder(); s.encoder != nil {
+			s.out = s.encoder
+		}
+		n, err := s.out.Write(s.buf.Bytes())
+		s.c.ResponseSize += int64(n)
+		s.buf.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	if s.encoder != nil {
+		if err := s.encoder.Flush(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := s.c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Close ends the body. A render which never flushed is sent like a
+// buffered one, with Content-Length.
+func (s *streamWriter) Close() error {
+	if !s.flushed {
+		return s.c.SetBody(s.buf.Bytes())
+	}
+	if s.encoder != nil {
+		return s.encoder.Close()
+	}
+	return nil
+}
+
+// streamBody runs exec straight into the response. BeforeRender is fired
+// as usual, AfterRender is not, the body is gone when the template ends.
+// An error before anything was sent gives the normal 500 page, after that
+// the status is out already and the error is only logged.
+func (c *Action) streamBody(exec func(w io.Writer) error) error {
+	s := newStreamWriter(c)
+	c.stream = s
+	defer func() {
+		c.stream = nil
+	}()
+	err := exec(s)
+	if err == nil {
+		return s.Close()
+	}
+	// the response is done, whatever the handler returns
+	c.Exit = true
+	if !s.flushed {
+		c.App.Error("Error during render:", err)
+		if c.App.AppConfig.Mode == Debug {
+			c.Abort(500, fmt.Sprintf("<pre>render error: %v</pre>", err))
+		} else {
+			c.Abort(500, "Server Error")
+		}
+		return err
+	}
+	c.App.Error("Error during render, response already sent:", err)
+	s.Close()
+	return err
+}
+
+// flushStream is the template function flush, it sends what a streamed
+// render has written so far, for instance the head of the page before a
+// slow query. It does nothing when the render is buffered.
+func (c *Action) flushStream() (string, error) {
+	if c.stream == nil {
+		return "", nil
+	}
+	return "", c.stream.Flush()
+}
@@ -3,8 +3,9 @@ package xweb
 import (
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -20,6 +21,8 @@ import (
  * include      —— Include(tmplName string) interface{}
  * session      —— GetSession(key string) interface{}
  * cookie       —— Cookie(key string) string
+ * flashes      —— Flash().Messages() []*FlashMessage
+ * cspNonce     —— CSPNonce() string
  * XsrfFormHtml —— XsrfFormHtml() template.HTML
  * XsrfValue    —— XsrfValue() string
  * XsrfName     —— XsrfName() string
@@ -44,6 +47,24 @@ var (
 		"HtmlAttr":    HtmlAttr,
 		"ToHtmlAttrs": ToHtmlAttrs,
 		"BuildUrl":    BuildUrl,
+
+		"Truncate":       Truncate,
+		"Substr":         Substr,
+		"Replace":        Replace,
+		"Title":          Title,
+		"FormatNumber":   FormatNumber,
+		"FormatBytes":    FormatBytes,
+		"FormatDuration": FormatDuration,
+		"TimeAgo":        TimeAgo,
+		"Json":           Json,
+		"Dict":           Dict,
+		"List":           List,
+		"Paginate":       Paginate,
+		"Pagination":     Pagination,
+		"Default":        Default,
+		"Coalesce":       Coalesce,
+		"Markdown":       Markdown,
+		"Nl2br":          Nl2br,
 	}
 	DefaultTemplateMgr *TemplateMgr = new(TemplateMgr)
 )
@@ -307,6 +328,7 @@ type TemplateMgr struct {
 	Caches        map[string][]byte
 	mutex         *sync.Mutex
 	RootDir       string
+	FS            fs.FS //where the templates are read, AppConfig.TemplateFS or RootDir
 	Ignores       map[string]bool
 	IsReload      bool
 	app           *App
@@ -316,7 +338,9 @@ type TemplateMgr struct {
 	initialized   bool
 }
 
-func (self *TemplateMgr) Moniter(rootDir string) error {
+// Moniter watches the directories on disk of the FS, a changed template is
+// read again through the FS.
+func (self *TemplateMgr) Moniter(rootDirs ...string) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -334,6 +358,13 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 				if _, ok := self.Ignores[filepath.Base(ev.Name)]; ok {
 					break
 				}
+				tmpl := relName(rootDirs, ev.Name)
+				if ev.IsDelete() || ev.IsRename() {
+					// a deleted file may still be in a lower layer, read it again on demand
+					watcher.RemoveWatch(ev.Name)
+					self.CacheDelete(tmpl)
+					break
+				}
 				d, err := os.Stat(ev.Name)
 				if err != nil {
 					break
@@ -343,8 +374,7 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 					if d.IsDir() {
 						watcher.Watch(ev.Name)
 					} else {
-						tmpl := ev.Name[len(self.RootDir)+1:]
-						content, err := ioutil.ReadFile(ev.Name)
+						content, err := fs.ReadFile(self.FS, fsPath(tmpl))
 						if err != nil {
 							self.app.Errorf("loaded template %v failed: %v", tmpl, err)
 							break
@@ -352,18 +382,10 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 						self.app.Infof("loaded template file %v success", tmpl)
 						self.CacheTemplate(tmpl, content)
 					}
-				} else if ev.IsDelete() {
-					if d.IsDir() {
-						watcher.RemoveWatch(ev.Name)
-					} else {
-						tmpl := ev.Name[len(self.RootDir)+1:]
-						self.CacheDelete(tmpl)
-					}
 				} else if ev.IsModify() {
 					if d.IsDir() {
 					} else {
-						tmpl := ev.Name[len(self.RootDir)+1:]
-						content, err := ioutil.ReadFile(ev.Name)
+						content, err := fs.ReadFile(self.FS, fsPath(tmpl))
 						if err != nil {
 							self.app.Errorf("reloaded template %v failed: %v", tmpl, err)
 							break
@@ -372,13 +394,6 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 						self.CacheTemplate(tmpl, content)
 						self.app.Infof("reloaded template %v success", tmpl)
 					}
-				} else if ev.IsRename() {
-					if d.IsDir() {
-						watcher.RemoveWatch(ev.Name)
-					} else {
-						tmpl := ev.Name[len(self.RootDir)+1:]
-						self.CacheDelete(tmpl)
-					}
 				}
 			case err := <-watcher.Error:
 				self.app.Error("error:", err)
@@ -394,16 +409,18 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 		}
 	}()
 
-	err = filepath.Walk(self.RootDir, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return watcher.Watch(f)
-		}
-		return nil
-	})
+	for _, rootDir := range rootDirs {
+		err = filepath.Walk(rootDir, func(f string, info os.FileInfo, err error) error {
+			if info.IsDir() {
+				return watcher.Watch(f)
+			}
+			return nil
+		})
 
-	if err != nil {
-		self.app.Error(err.Error())
-		return err
+		if err != nil {
+			self.app.Error(err.Error())
+			return err
+		}
 	}
 
 	<-done
@@ -411,24 +428,25 @@ func (self *TemplateMgr) Moniter(rootDir string) error {
 	return nil
 }
 
+// CacheAll reads all the templates of the FS.
 func (self *TemplateMgr) CacheAll(rootDir string) error {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	fmt.Print("Reading the contents of the template files, please wait... ")
-	err := filepath.Walk(rootDir, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+	err := fs.WalkDir(self.FS, ".", func(tmpl string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
 			return nil
 		}
-		tmpl := f[len(rootDir)+1:]
-		tmpl = FixDirSeparator(tmpl)
-		if _, ok := self.Ignores[filepath.Base(tmpl)]; !ok {
-			fpath := filepath.Join(self.RootDir, tmpl)
-			content, err := ioutil.ReadFile(fpath)
+		if _, ok := self.Ignores[path.Base(tmpl)]; !ok {
+			content, err := fs.ReadFile(self.FS, tmpl)
 			if err != nil {
-				self.app.Debugf("load template %s error: %v", fpath, err)
+				self.app.Debugf("load template %s error: %v", tmpl, err)
 				return err
 			}
-			self.app.Debug("loaded template", fpath)
+			self.app.Debug("loaded template", tmpl)
 			self.Caches[tmpl] = content
 		}
 		return nil
@@ -443,13 +461,14 @@ func (self *TemplateMgr) defaultTimerCallback() func() bool {
 			return self.TimerCallback()
 		}
 		//更改模板主题后，关闭当前监控，重新监控新目录
-		if self.app.AppConfig.TemplateDir == self.RootDir {
+		if self.app.AppConfig.TemplateDir == self.RootDir || !isOSDir(self.FS, self.RootDir) {
 			return true
 		}
 		self.Caches = make(map[string][]byte)
 		self.Ignores = make(map[string]bool)
 		self.RootDir = self.app.AppConfig.TemplateDir
-		go self.Moniter(self.RootDir)
+		self.FS = OSDir(self.RootDir)
+		go self.Moniter(osDirs(self.FS)...)
 		return false
 	}
 }
@@ -465,8 +484,16 @@ func (self *TemplateMgr) Close() {
 }
 
 func (self *TemplateMgr) Init(app *App, rootDir string, reload bool) error {
+	fsys := app.AppConfig.TemplateFS
+	if fsys == nil {
+		fsys = OSDir(rootDir)
+	}
+	return self.initFS(app, rootDir, fsys, reload)
+}
+
+func (self *TemplateMgr) initFS(app *App, rootDir string, fsys fs.FS, reload bool) error {
 	if self.initialized {
-		if rootDir == self.RootDir {
+		if rootDir == self.RootDir && isOSDir(fsys, rootDir) && isOSDir(self.FS, rootDir) {
 			return nil
 		} else {
 			self.TimerCallback = func() bool {
@@ -483,15 +510,16 @@ func (self *TemplateMgr) Init(app *App, rootDir string, reload bool) error {
 		}
 	}
 	self.RootDir = rootDir
+	self.FS = fsys
 	self.Caches = make(map[string][]byte)
 	self.Ignores = make(map[string]bool)
 	self.mutex = &sync.Mutex{}
 	self.app = app
-	if dirExists(rootDir) {
+	if dirs := osDirs(fsys); len(dirs) > 0 {
 		//self.CacheAll(rootDir)
 		if reload {
 			self.timerCallback = self.defaultTimerCallback()
-			go self.Moniter(rootDir)
+			go self.Moniter(dirs...)
 		}
 	}
 
@@ -510,7 +538,7 @@ func (self *TemplateMgr) GetTemplate(tmpl string) ([]byte, error) {
 		return content, nil
 	}
 
-	content, err := ioutil.ReadFile(filepath.Join(self.RootDir, tmpl))
+	content, err := fs.ReadFile(self.FS, fsPath(tmpl))
 	if err == nil {
 		self.app.Debugf("load template %v from the file:", tmpl)
 		self.Caches[tmpl] = content
@@ -527,9 +555,19 @@ func (self *TemplateMgr) CacheTemplate(tmpl string, content []byte) {
 	tmpl = FixDirSeparator(tmpl)
 	self.app.Debugf("update template %v on cache", tmpl)
 	self.Caches[tmpl] = content
+	self.app.TemplateCache.Delete(tmpl)
 	return
 }
 
+func (self *TemplateMgr) ClearCache() {
+	if self.mutex == nil {
+		return
+	}
+	self.mutex.Lock()
+	self.Caches = make(map[string][]byte)
+	self.mutex.Unlock()
+}
+
 func (self *TemplateMgr) CacheDelete(tmpl string) {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
@@ -538,5 +576,6 @@ func (self *TemplateMgr) CacheDelete(tmpl string) {
 		self.app.Debugf("delete template %v from cache", tmpl)
 		delete(self.Caches, tmpl)
 	}
+	self.app.TemplateCache.Delete(tmpl)
 	return
 }
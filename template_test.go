@@ -0,0 +1,573 @@
+package xweb
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/coscms/xweb/lib/i18n"
+	"github.com/coscms/xweb/log"
+	"github.com/coscms/xweb/validation"
+)
+
+type renderAction struct {
+	*Action
+
+	index Mapper `xweb:"/"`
+}
+
+func (c *renderAction) Index() error {
+	c.Assign("user", func() string {
+		return c.GetString("user")
+	})
+	return c.Render("index.html")
+}
+
+type layoutAction struct {
+	*Action
+
+	page   Mapper `xweb:"/page"`
+	plain  Mapper `xweb:"/plain"`
+	bare   Mapper `xweb:"/bare" layout:"-"`
+	broken Mapper `xweb:"/broken"`
+}
+
+func (c *layoutAction) Page() error {
+	return c.Render("page.html")
+}
+
+func (c *layoutAction) Plain() error {
+	return c.Render("plain.html")
+}
+
+func (c *layoutAction) Bare() error {
+	return c.Render("plain.html")
+}
+
+func (c *layoutAction) Broken() error {
+	return c.Render(c.GetString("t"))
+}
+
+type streamAction struct {
+	*Action
+
+	index Mapper `xweb:"/"`
+}
+
+func (c *streamAction) Index() error {
+	c.Option.StreamRender = true
+	c.Assign("fail", func() (string, error) {
+		return "", errors.New("query failed")
+	})
+	return c.Render(c.GetString("t"))
+}
+
+type stringAction struct {
+	*Action
+
+	index Mapper `xweb:"/"`
+	named Mapper `xweb:"/named"`
+}
+
+func (c *stringAction) Index() error {
+	return c.RenderString(c.GetString("greeting")+", {{.T.name}}", &T{"name": "world"})
+}
+
+func (c *stringAction) Named() error {
+	return c.NamedRender("greeting", "hello, {{.T.name}}", &T{"name": "world"})
+}
+
+type i18nAction struct {
+	*Action
+	Validation *validation.Validation
+
+	index   Mapper `xweb:"/"`
+	setLang Mapper `xweb:"/set"`
+}
+
+func (c *i18nAction) SetLang() string {
+	c.SetSession("lang", c.GetString("lang"))
+	return "ok"
+}
+
+func (c *i18nAction) Index() error {
+	v := c.NewValidation()
+	v.Range(12, 1, 10, "age")
+	c.Assign("invalid", func() string {
+		return v.Errors[0].Message
+	})
+	c.Validation.MaxSize("abc", 2, "name")
+	c.Assign("field", func() string {
+		return c.Validation.Errors[0].Message
+	})
+	return c.Render("i18n.html")
+}
+
+func newRenderServer(t *testing.T, templates map[string]string, configure ...func(*App)) *Server {
+	dir, err := ioutil.TempDir("", "xweb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range templates {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewServer(fmt.Sprintf("test%p", t))
+	s.RootApp.Logger = log.New(ioutil.Discard, "", 0)
+	s.RootApp.AppConfig.TemplateDir = dir
+	s.RootApp.AppConfig.ReloadTemplates = false
+	for _, fn := range configure {
+		fn(s.RootApp)
+	}
+	s.AddRouter("/", &renderAction{})
+	s.AddRouter("/layout", &layoutAction{})
+	s.AddRouter("/stream", &streamAction{})
+	s.AddRouter("/i18n", &i18nAction{})
+	s.AddRouter("/string", &stringAction{})
+	s.initServer()
+	return s
+}
+
+func get(s *Server, url string) string {
+	req, _ := http.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestConcurrentRender(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"index.html": `{{user}}|{{cookie "c"}}|{{include "part.html"}}`,
+		"part.html":  `{{user}}`,
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				user := fmt.Sprintf("u%d-%d", i, j)
+				req, _ := http.NewRequest("GET", "/?user="+user, nil)
+				req.AddCookie(&http.Cookie{Name: "c", Value: user})
+				w := httptest.NewRecorder()
+				s.ServeHTTP(w, req)
+				if expected := user + "|" + user + "|" + user; w.Body.String() != expected {
+					t.Errorf("expected %q, got %q", expected, w.Body.String())
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestAssignDoesNotLeak(t *testing.T) {
+	a := NewApp("/", "a")
+	b := NewApp("/b", "b")
+	a.Assign("only", func() string { return "a" })
+	if _, ok := b.TemplateFuncs()["only"]; ok {
+		t.Error("functions of one app should not be seen by another")
+	}
+	if _, ok := DefaultFuncs["only"]; ok {
+		t.Error("DefaultFuncs should not be changed by Assign")
+	}
+	funcs := a.TemplateFuncs()
+	a.Assign("later", func() string { return "" })
+	if _, ok := funcs["later"]; ok {
+		t.Error("a published registry should never change")
+	}
+}
+
+func TestRenderStringNotCached(t *testing.T) {
+	s := newRenderServer(t, nil)
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+	cached := func() int {
+		tc := s.RootApp.TemplateCache
+		tc.lock.RLock()
+		defer tc.lock.RUnlock()
+		return len(tc.entries)
+	}
+
+	for i := 0; i < 100; i++ {
+		greeting := fmt.Sprintf("hello%d", i)
+		if body := get(s, "/string/?greeting="+greeting); body != greeting+", world" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if n := cached(); n != 0 {
+		t.Errorf("RenderString should not fill the cache, got %d entries", n)
+	}
+	for i := 0; i < 3; i++ {
+		if body := get(s, "/string/named"); body != "hello, world" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if n := cached(); n != 1 {
+		t.Errorf("NamedRender should be cached once, got %d entries", n)
+	}
+}
+
+func TestTemplateWatcherEvicts(t *testing.T) {
+	s := newRenderServer(t, map[string]string{"index.html": `old {{user}}`}, func(a *App) {
+		// a watcher of its own, DefaultTemplateMgr is shared by the other tests
+		a.TemplateMgr = new(TemplateMgr)
+		a.AppConfig.ReloadTemplates = true
+	})
+	dir := s.RootApp.AppConfig.TemplateDir
+	defer os.RemoveAll(dir)
+	defer s.RootApp.TemplateMgr.Close()
+	cached := func() int {
+		tc := s.RootApp.TemplateCache
+		tc.lock.RLock()
+		defer tc.lock.RUnlock()
+		return len(tc.entries)
+	}
+
+	if body := get(s, "/?user=a"); body != "old a" || cached() != 1 {
+		t.Fatalf("expected the template to be compiled once, got %q %d", body, cached())
+	}
+	// let the watcher start before the file changes
+	time.Sleep(100 * time.Millisecond)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`new {{user}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for cached() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the watcher should evict the changed template")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if body := get(s, "/?user=a"); body != "new a" || cached() != 1 {
+		t.Errorf("the next render should parse the new file, got %q %d", body, cached())
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"main.html":    `<title>{{block "title" .}}site{{end}}</title>{{block "content" .}}{{end}}`,
+		"section.html": `{{extends "main"}}{{define "content"}}<nav/>{{block "body" .}}{{end}}{{end}}`,
+		"page.html":    "{{extends \"section\"}}\n{{define \"title\"}}page{{end}}\n{{define \"body\"}}<p>{{.T.XwebVer}}</p>{{end}}",
+		"plain.html":   `plain`,
+		"a.html":       `{{extends "b"}}`,
+		"b.html":       `{{extends "a"}}`,
+		"missing.html": "\n{{extends \"nothere\"}}",
+		"error.html":   "{{extends \"main\"}}\n{{define \"content\"}}{{if}}{{end}}",
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+	s.RootApp.AppConfig.Layout = "main.html"
+
+	if body, expected := get(s, "/layout/page"), "<title>page</title><nav/><p>"+Version+"</p>"; body != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+	if body := get(s, "/layout/plain"); body != "<title>site</title>plain" {
+		t.Errorf("the default layout should be used, got %q", body)
+	}
+	if body := get(s, "/layout/bare"); body != "plain" {
+		t.Errorf("layout:\"-\" should render without layout, got %q", body)
+	}
+	for name, expected := range map[string]string{
+		"a.html":       "layout cycle a.html -> b.html -> a.html",
+		"missing.html": "missing.html:2: layout \"nothere.html\"",
+		"error.html":   "error.html:2:",
+	} {
+		if body := get(s, "/layout/broken?t="+name); !strings.Contains(body, expected) {
+			t.Errorf("%v: expected an error with %q, got %q", name, expected, body)
+		}
+	}
+}
+
+func TestTemplateEngines(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"index.html":  `<%Include "part" .T%>|<% shout user %>`,
+		"part.html":   `<%.XwebVer%>`,
+		"broken.html": `{{if}}`,
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	if err := s.RootApp.TemplateEngine.Load("broken.html"); err == nil || !strings.Contains(err.Error(), "broken.html:1") {
+		t.Errorf("Load should report the error of the template, got %v", err)
+	}
+
+	e := NewTplexEngine(s.RootApp)
+	e.Delims("<%", "%>")
+	e.Funcs(template.FuncMap{"shout": strings.ToUpper})
+	s.RootApp.TemplateEngine = e
+	if err := e.Load("part.html"); err != nil {
+		t.Fatal(err)
+	}
+	if body, expected := get(s, "/?user=bob"), Version+"|BOB"; body != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+}
+
+func TestStreamRender(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"small.html": `small`,
+		"flush.html": `<head/>{{flush}}<body/>`,
+		"early.html": `<head/>{{fail}}`,
+		"late.html":  `<head/>{{flush}}{{fail}}`,
+		"large.html": `{{range .T.rows}}0123456789{{end}}`,
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+	s.RootApp.AppConfig.StreamBuffer = 64
+	s.RootApp.Assign("rows", make([]int, 100))
+
+	serve := func(url string, header ...string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/stream/?t=small.html")
+	if w.Body.String() != "small" || w.Header().Get("Content-Length") != "5" || w.Flushed {
+		t.Errorf("a small page should be sent at once, got %q %v", w.Body.String(), w.Header())
+	}
+
+	w = serve("/stream/?t=flush.html")
+	if w.Body.String() != "<head/><body/>" || w.Header().Get("Content-Length") != "" || !w.Flushed {
+		t.Errorf("flush should send the page in chunks, got %q %v", w.Body.String(), w.Header())
+	}
+
+	w = serve("/stream/?t=large.html")
+	if w.Body.Len() != 1000 || !w.Flushed {
+		t.Errorf("a full buffer should be flushed, got %d bytes", w.Body.Len())
+	}
+
+	w = serve("/stream/?t=early.html")
+	if w.Code != 500 || strings.Contains(w.Body.String(), "<head/>") {
+		t.Errorf("an error before the flush should give a 500 page, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve("/stream/?t=late.html")
+	if w.Code != 200 || w.Body.String() != "<head/>" {
+		t.Errorf("an error after the flush should end the body, got %d %q", w.Code, w.Body.String())
+	}
+
+	s.Config.EnableGzip = true
+	w = serve("/stream/?t=flush.html", "Accept-Encoding", "gzip")
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("the stream should be compressed, got %v", w.Header())
+	}
+	r, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "<head/><body/>" {
+		t.Errorf("expected the page, got %q", b)
+	}
+}
+
+func TestTemplateFS(t *testing.T) {
+	defaults := fstest.MapFS{
+		"index.html": {Data: []byte(`default`)},
+		"part.html":  {Data: []byte(`part`)},
+	}
+	s := newRenderServer(t, map[string]string{
+		"index.html": `theme {{include "part.html"}}`,
+	}, func(a *App) {
+		a.AppConfig.TemplateFS = NewOverlay(OSDir(a.AppConfig.TemplateDir), defaults)
+		a.AppConfig.StaticFS = fstest.MapFS{"css/app.css": {Data: []byte("body{}")}}
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	if body := get(s, "/"); body != "theme part" {
+		t.Errorf("the directory should override the defaults, got %q", body)
+	}
+	if body := get(s, "/css/app.css"); body != "body{}" {
+		t.Errorf("expected the static file, got %q", body)
+	}
+	if u := s.RootApp.StaticUrl("/css/app.css"); !strings.HasPrefix(u, "/css/app.css?v=") {
+		t.Errorf("the version should be read from StaticFS, got %q", u)
+	}
+	entries, err := fs.ReadDir(s.RootApp.AppConfig.TemplateFS, ".")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("the overlay should list the files of all the layers, got %v %v", entries, err)
+	}
+}
+
+func TestThemes(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"index.html": `{{include "part.html"}} {{include "foot.html"}} {{StaticUrl "/app.css"}}`,
+		"part.html":  `part`,
+		"foot.html":  `foot`,
+	}, func(a *App) {
+		a.Themes = NewThemes(&Theme{
+			Name:      "dark",
+			Templates: fstest.MapFS{"part.html": {Data: []byte(`dark part`)}},
+			Static:    fstest.MapFS{"app.css": {Data: []byte(`dark{}`)}},
+		}, &Theme{
+			Name:      "xmas",
+			Parent:    "dark",
+			Templates: fstest.MapFS{"foot.html": {Data: []byte(`xmas foot`)}},
+		})
+		a.Themes.Select = ThemeByCookie("theme")
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	serve := func(theme string) string {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "theme", Value: theme})
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := serve(""); body != "part foot /app.css" {
+		t.Errorf("without theme the templates of the app should be used, got %q", body)
+	}
+	if body := serve("dark"); !strings.HasPrefix(body, "dark part foot /themes/dark/app.css?v=") {
+		t.Errorf("unexpected dark page %q", body)
+	}
+	if body := serve("xmas"); !strings.HasPrefix(body, "dark part xmas foot /themes/dark/app.css?v=") {
+		t.Errorf("a theme should fall back to its parent, got %q", body)
+	}
+	if body := serve("unknown"); body != "part foot /app.css" {
+		t.Errorf("an unknown theme should use the default, got %q", body)
+	}
+	if body := get(s, "/themes/dark/app.css"); body != "dark{}" {
+		t.Errorf("the static file of the theme should be served, got %q", body)
+	}
+}
+
+func TestI18n(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"i18n.html": `{{T "hello"}}|{{T "items" 1}}|{{T "items" 3}}|{{invalid}}|{{field}}`,
+	}, func(a *App) {
+		bundle := i18n.NewBundle("en")
+		bundle.Add("en", map[string]i18n.Message{
+			"hello": {"other": "Hello"},
+			"items": {"one": "%d item", "other": "%d items"},
+		})
+		bundle.Add("zh-CN", map[string]i18n.Message{
+			"hello":              {"other": "你好"},
+			"items":              {"other": "%d件商品"},
+			"validation.Range":   {"other": "范围是%d到%d"},
+			"validation.MaxSize": {"other": "最多%d个字符"},
+		})
+		a.AppConfig.SessionOn = false
+		a.I18n = NewI18n(bundle)
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	serve := func(url, acceptLanguage, cookie string) string {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "lang", Value: cookie})
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := serve("/i18n", "", ""); body != "Hello|1 item|3 items|Range is 1 to 10|Maximum size is 2" {
+		t.Errorf("unexpected default page %q", body)
+	}
+	if body := serve("/i18n", "fr;q=0.9, zh-TW;q=0.8", ""); body != "你好|1件商品|3件商品|范围是1到10|最多2个字符" {
+		t.Errorf("zh-TW should be served by zh-CN, got %q", body)
+	}
+	if body := serve("/i18n", "zh-CN", "en"); !strings.HasPrefix(body, "Hello|") {
+		t.Errorf("the cookie should win over Accept-Language, got %q", body)
+	}
+	if body := serve("/i18n?lang=zh_cn", "", "en"); !strings.HasPrefix(body, "你好|") {
+		t.Errorf("the query param should win over the cookie, got %q", body)
+	}
+}
+
+func TestI18nSession(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"i18n.html": `{{T "hello"}}`,
+	}, func(a *App) {
+		bundle := i18n.NewBundle("en")
+		bundle.Add("en", map[string]i18n.Message{"hello": {"other": "Hello"}})
+		bundle.Add("zh-CN", map[string]i18n.Message{"hello": {"other": "你好"}})
+		a.AppConfig.SessionOn = true
+		a.I18n = NewI18n(bundle)
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+
+	client := newTestClient(s)
+	w := client.get("/i18n")
+	if w.Body.String() != "Hello" || len(w.Result().Cookies()) != 0 {
+		t.Errorf("the locale should not create a session, got %q %v", w.Body.String(), w.Result().Cookies())
+	}
+	client.get("/i18n/set?lang=zh-CN")
+	if body := client.get("/i18n").Body.String(); body != "你好" {
+		t.Errorf("the locale of the session should be used, got %q", body)
+	}
+	req, _ := http.NewRequest("GET", "/i18n", nil)
+	req.Header.Set("Accept-Language", "en")
+	if body := client.do(req).Body.String(); body != "你好" {
+		t.Errorf("the session should win over Accept-Language, got %q", body)
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"layout.html": `<body>{{block "content" .}}{{end}}</body>`,
+		"page.html":   `{{extends "layout"}}{{define "content"}}{{user}} {{include "part.html"}}{{end}}`,
+		"part.html":   `part`,
+		"broken.html": "broken\n{{nofunc}}",
+		"calls.html":  `{{template "nothere"}}{{include "gone.html"}}`,
+		"orphan.html": `orphan`,
+	})
+	defer os.RemoveAll(s.RootApp.AppConfig.TemplateDir)
+	src, err := ioutil.TempDir("", "xweb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	code := "package app\n\n" +
+		"func (c *PageAction) Index() error {\n" +
+		"\tc.Assign(\"user\", func() string { return \"\" })\n" +
+		"\treturn c.Render(\"page.html\")\n" +
+		"}\n\n" +
+		"func (c *PageAction) Other() xweb.SHOW {\n" +
+		"\treturn xweb.SHOW{Tmpl: \"missing.html\"}\n" +
+		"}\n"
+	if err = ioutil.WriteFile(filepath.Join(src, "app.go"), []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.RootApp.CheckTemplates(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make([]string, len(report.Errors))
+	for i, e := range report.Errors {
+		errs[i] = strings.TrimPrefix(e.Error(), src+string(filepath.Separator))
+	}
+	expected := []string{
+		`app.go:9: template missing.html not found`,
+		`broken.html:2: function "nofunc" not defined`,
+		`calls.html:1: template "nothere" is not defined`,
+		`calls.html:1: included template gone.html not found`,
+	}
+	if strings.Join(errs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected errors:\n%v", strings.Join(errs, "\n"))
+	}
+	if unused := strings.Join(report.Unused, ","); unused != "broken.html,calls.html,orphan.html" {
+		t.Errorf("unexpected unused templates %v", unused)
+	}
+	if len(report.Templates) != 6 || report.Err() == nil {
+		t.Errorf("all the templates should be checked, got %v", report.Templates)
+	}
+}
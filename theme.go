@@ -0,0 +1,282 @@
+package xweb
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ThemeStaticPath prefixes the urls of the static files of themes,
+// /themes/dark/css/app.css is css/app.css of the theme dark.
+var ThemeStaticPath = "/themes/"
+
+// Theme overrides some templates and static files of the app. What it
+// does not have is looked up in its parent theme, and so on, then in
+// AppConfig.TemplateFS and AppConfig.StaticFS.
+type Theme struct {
+	Name      string
+	Parent    string
+	Templates fs.FS
+	Static    fs.FS
+	tplMgr    *TemplateMgr
+	staticMgr *StaticVerMgr
+}
+
+// NewDirTheme returns a theme with the templates and static
+// subdirectories of dir.
+func NewDirTheme(name, parent, dir string) *Theme {
+	return &Theme{
+		Name:      name,
+		Parent:    parent,
+		Templates: OSDir(filepath.Join(dir, "templates")),
+		Static:    OSDir(filepath.Join(dir, "static")),
+	}
+}
+
+// Themes are the themes of an app, set it as App.Themes. The theme of a
+// request is chosen by Select, Default is used when Select returns no
+// known theme. An action can change it with SetTheme.
+//
+//	themes := xweb.NewThemes(xweb.NewDirTheme("dark", "", "themes/dark"),
+//		xweb.NewDirTheme("christmas", "dark", "themes/christmas"))
+//	themes.Select = xweb.SelectTheme(xweb.ThemeByCookie("theme"),
+//		xweb.ThemeByDomain(map[string]string{"xmas.example.com": "christmas"}))
+//
+// Themes apply to the templates of HtmlTemplateEngine and to StaticUrl.
+type Themes struct {
+	Default string
+	Select  func(c *Action) string
+	themes  map[string]*Theme
+	lock    sync.Mutex
+}
+
+func NewThemes(themes ...*Theme) *Themes {
+	t := &Themes{themes: make(map[string]*Theme)}
+	for _, theme := range themes {
+		t.Add(theme)
+	}
+	return t
+}
+
+func (t *Themes) Add(theme *Theme) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.themes == nil {
+		t.themes = make(map[string]*Theme)
+	}
+	if old, ok := t.themes[theme.Name]; ok {
+		old.close()
+	}
+	t.themes[theme.Name] = theme
+}
+
+func (t *Themes) Get(name string) *Theme {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.themes[name]
+}
+
+// Chain returns the theme and its parents, the theme first.
+func (t *Themes) Chain(name string) []*Theme {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.chain(name)
+}
+
+func (t *Themes) chain(name string) []*Theme {
+	chain := make([]*Theme, 0)
+	seen := make(map[string]bool)
+	for name != "" && !seen[name] {
+		seen[name] = true
+		theme, ok := t.themes[name]
+		if !ok {
+			break
+		}
+		chain = append(chain, theme)
+		name = theme.Parent
+	}
+	return chain
+}
+
+// templateFS puts the templates of the chain of the theme over the ones
+// of the app.
+func (t *Themes) templateFS(a *App, theme *Theme) fs.FS {
+	layers := make([]fs.FS, 0)
+	for _, th := range t.chain(theme.Name) {
+		if th.Templates != nil {
+			layers = append(layers, th.Templates)
+		}
+	}
+	return NewOverlay(append(layers, a.templateFS())...)
+}
+
+// templateMgr caches the templates of the theme, changed files are
+// reloaded like the ones of the app.
+func (t *Themes) templateMgr(a *App, theme *Theme) *TemplateMgr {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if theme.tplMgr == nil {
+		theme.tplMgr = new(TemplateMgr)
+		theme.tplMgr.initFS(a, "", t.templateFS(a, theme), a.AppConfig.ReloadTemplates)
+	}
+	return theme.tplMgr
+}
+
+func (t *Themes) staticMgr(a *App, theme *Theme) *StaticVerMgr {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if theme.staticMgr == nil {
+		theme.staticMgr = new(StaticVerMgr)
+		theme.staticMgr.initFS(a, "", theme.Static)
+	}
+	return theme.staticMgr
+}
+
+func (t *Themes) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, theme := range t.themes {
+		theme.close()
+	}
+}
+
+func (theme *Theme) close() {
+	if theme.tplMgr != nil {
+		theme.tplMgr.Close()
+		theme.tplMgr = nil
+	}
+	if theme.staticMgr != nil {
+		theme.staticMgr.Close()
+		theme.staticMgr = nil
+	}
+}
+
+// SelectTheme asks the selectors in order, the first theme wins.
+func SelectTheme(selectors ...func(*Action) string) func(*Action) string {
+	return func(c *Action) string {
+		for _, selector := range selectors {
+			if name := selector(c); name != "" {
+				return name
+			}
+		}
+		return ""
+	}
+}
+
+// ThemeByDomain selects the theme by the host name of the request.
+func ThemeByDomain(domains map[string]string) func(*Action) string {
+	return func(c *Action) string {
+		return domains[c.Host()]
+	}
+}
+
+// ThemeByCookie selects the theme named by a cookie.
+func ThemeByCookie(name string) func(*Action) string {
+	return func(c *Action) string {
+		return c.Cookie(name)
+	}
+}
+
+// Theme returns the name of the theme of the request, "" when the app has
+// no theme.
+func (c *Action) Theme() string {
+	if theme := c.theme(); theme != nil {
+		return theme.Name
+	}
+	return ""
+}
+
+// SetTheme changes the theme of the request, an unknown name means the
+// templates of the app.
+func (c *Action) SetTheme(name string) {
+	c.themeName = &name
+}
+
+func (c *Action) theme() *Theme {
+	themes := c.App.Themes
+	if themes == nil {
+		return nil
+	}
+	if c.themeName == nil {
+		var name string
+		if themes.Select != nil {
+			name = themes.Select(c)
+		}
+		if themes.Get(name) == nil {
+			name = themes.Default
+		}
+		c.themeName = &name
+	}
+	return themes.Get(*c.themeName)
+}
+
+// themeContent reads a template of the theme of the request.
+func (a *App) themeContent(c *Action, name string) ([]byte, error) {
+	var theme *Theme
+	if c != nil {
+		theme = c.theme()
+	}
+	if theme == nil {
+		return a.templateContent(name)
+	}
+	if a.AppConfig.CacheTemplates {
+		return a.Themes.templateMgr(a, theme).GetTemplate(name)
+	}
+	a.Themes.lock.Lock()
+	fsys := a.Themes.templateFS(a, theme)
+	a.Themes.lock.Unlock()
+	content, err := fs.ReadFile(fsys, fsPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("No template file %v found", name)
+	}
+	return content, err
+}
+
+// StaticUrl is App.StaticUrl for the theme of the request, the url of the
+// file of the first theme of the chain which has it.
+func (c *Action) StaticUrl(url string) string {
+	theme := c.theme()
+	if theme == nil {
+		return c.App.StaticUrl(url)
+	}
+	name := fsPath(url)
+	for _, th := range c.App.Themes.Chain(theme.Name) {
+		if th.Static == nil {
+			continue
+		}
+		if info, err := fs.Stat(th.Static, name); err != nil || info.IsDir() {
+			continue
+		}
+		u := path.Join(c.App.staticBasePath(), ThemeStaticPath, th.Name, name)
+		if !c.App.AppConfig.StaticFileVersion {
+			return u
+		}
+		if ver := c.App.Themes.staticMgr(c.App, th).GetVersion(name); ver != "" {
+			u += "?v=" + ver
+		}
+		return u
+	}
+	return c.App.StaticUrl(url)
+}
+
+// themeStatic finds the theme of a static file url, relative to the
+// base path of the app.
+func (a *App) themeStatic(url string) (fs.FS, string, bool) {
+	url = path.Clean("/" + url)
+	if a.Themes == nil || !strings.HasPrefix(url, ThemeStaticPath) {
+		return nil, "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(url, ThemeStaticPath), "/", 2)
+	if len(parts) != 2 {
+		return nil, "", false
+	}
+	theme := a.Themes.Get(parts[0])
+	if theme == nil || theme.Static == nil {
+		return nil, "", false
+	}
+	return theme.Static, fsPath(parts[1]), true
+}
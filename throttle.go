@@ -0,0 +1,347 @@
+package xweb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coscms/xweb/httpsession"
+	"github.com/coscms/xweb/lib/passwd"
+)
+
+var ErrLockedOut = errors.New("too many failed logins")
+
+// ThrottleStore keeps the failure counters of a LoginThrottle. The servers
+// of a cluster have to share it, or each of them allows MaxFailures.
+type ThrottleStore interface {
+	// Attempt counts an attempt of key in one step, unless key is locked,
+	// then it returns how long it still is. The attempt which reaches max
+	// locks key for lockout and returns last.
+	Attempt(key string, max int, lockout time.Duration, now time.Time) (wait time.Duration, last bool, err error)
+	// Locked returns how long key is still locked.
+	Locked(key string, now time.Time) time.Duration
+	// Reset clears the attempts of key.
+	Reset(key string)
+}
+
+type loginFailures struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+// attempt counts an attempt, see ThrottleStore.Attempt.
+func (f *loginFailures) attempt(max int, lockout time.Duration, now time.Time) (time.Duration, bool) {
+	if f.stale(lockout, now) {
+		*f = loginFailures{}
+	}
+	if !f.until.IsZero() {
+		return f.until.Sub(now), false
+	}
+	f.failures++
+	f.last = now
+	if f.failures >= max {
+		f.until = now.Add(lockout)
+		return 0, true
+	}
+	return 0, false
+}
+
+// MemoryThrottleStore keeps the counters of one server, use it only when
+// a single process serves the logins.
+type MemoryThrottleStore struct {
+	entries map[string]*loginFailures
+	lock    sync.Mutex
+}
+
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{entries: make(map[string]*loginFailures)}
+}
+
+// maxThrottleEntries is how many counters a MemoryThrottleStore keeps
+// before it drops the stale ones.
+const maxThrottleEntries = 10000
+
+// stale reports whether the failures no longer count: the lockout is
+// over, or there was no failure for lockout.
+func (f *loginFailures) stale(lockout time.Duration, now time.Time) bool {
+	if !f.until.IsZero() {
+		return !now.Before(f.until)
+	}
+	return now.Sub(f.last) > lockout
+}
+
+func (s *MemoryThrottleStore) Attempt(key string, max int, lockout time.Duration, now time.Time) (time.Duration, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, ok := s.entries[key]
+	if !ok {
+		if len(s.entries) >= maxThrottleEntries {
+			for k, e := range s.entries {
+				if e.stale(lockout, now) {
+					delete(s.entries, k)
+				}
+			}
+		}
+		f = &loginFailures{}
+		s.entries[key] = f
+	}
+	wait, last := f.attempt(max, lockout, now)
+	return wait, last, nil
+}
+
+func (s *MemoryThrottleStore) Locked(key string, now time.Time) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if f, ok := s.entries[key]; ok && f.until.After(now) {
+		return f.until.Sub(now)
+	}
+	return 0
+}
+
+func (s *MemoryThrottleStore) Reset(key string) {
+	s.lock.Lock()
+	delete(s.entries, key)
+	s.lock.Unlock()
+}
+
+// SessionThrottleStore keeps the counters in a session store, so that the
+// servers which share the sessions share the lockouts. Every key has a
+// session node of its own, its id is a HMAC of the key, which a client
+// can't send as its session id. On a CASStore an attempt is a versioned
+// write, on other stores two servers may count parallel attempts as one.
+// The counters expire with the node, keep the session timeout above the
+// Lockout. Listeners and Range see the nodes like sessions, tell them by
+// ThrottleIdPrefix.
+type SessionThrottleStore struct {
+	store  httpsession.Store
+	secret []byte
+	lock   sync.Mutex
+}
+
+// NewSessionThrottleStore keys the nodes by the secret, the servers of a
+// cluster need the same one. An empty secret is replaced by a random one,
+// which only this process knows.
+func NewSessionThrottleStore(store httpsession.Store, secret string) *SessionThrottleStore {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = httpsession.GenRandKey(32)
+	}
+	return &SessionThrottleStore{store: store, secret: key}
+}
+
+// ThrottleIdPrefix starts the ids of the nodes of a SessionThrottleStore.
+const ThrottleIdPrefix = "throttle-"
+
+func (s *SessionThrottleStore) id(key string) httpsession.Id {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(key))
+	return httpsession.Id(ThrottleIdPrefix + hex.EncodeToString(h.Sum(nil)))
+}
+
+func unixNano(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
+
+func timeOf(v interface{}) time.Time {
+	if n := unixNano(v); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+func nanoOf(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func (s *SessionThrottleStore) failures(get func(key string) interface{}) *loginFailures {
+	return &loginFailures{
+		failures: int(unixNano(get("failures"))),
+		last:     timeOf(get("last")),
+		until:    timeOf(get("until")),
+	}
+}
+
+func (s *SessionThrottleStore) Attempt(key string, max int, lockout time.Duration, now time.Time) (time.Duration, bool, error) {
+	id := s.id(key)
+	if cas, ok := s.store.(httpsession.CASStore); ok {
+		for i := 0; i < httpsession.DefaultMaxRetries; i++ {
+			kvs, version, err := cas.Load(id)
+			if err != nil {
+				return 0, false, err
+			}
+			f := s.failures(func(k string) interface{} { return kvs[k] })
+			wait, last := f.attempt(max, lockout, now)
+			if wait > 0 {
+				return wait, false, nil
+			}
+			kvs["failures"] = int64(f.failures)
+			kvs["last"] = nanoOf(f.last)
+			kvs["until"] = nanoOf(f.until)
+			if err = cas.CompareAndSwap(id, kvs, version); err != httpsession.ErrConflict {
+				return 0, last, err
+			}
+		}
+		return 0, false, httpsession.ErrConflict
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f := s.failures(func(k string) interface{} { return s.store.Get(id, k) })
+	wait, last := f.attempt(max, lockout, now)
+	if wait > 0 {
+		return wait, false, nil
+	}
+	s.store.Set(id, "failures", int64(f.failures))
+	s.store.Set(id, "last", nanoOf(f.last))
+	s.store.Set(id, "until", nanoOf(f.until))
+	return 0, last, nil
+}
+
+func (s *SessionThrottleStore) Locked(key string, now time.Time) time.Duration {
+	if until := timeOf(s.store.Get(s.id(key), "until")); until.After(now) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+func (s *SessionThrottleStore) Reset(key string) {
+	s.store.Clear(s.id(key))
+}
+
+// LoginThrottle counts the failed logins of a user and locks the user out
+// for Lockout after MaxFailures of them in a row. Failures older than
+// Lockout are forgotten. Set it as App.LoginThrottle, BasicAuth and
+// CheckPassword use it.
+type LoginThrottle struct {
+	MaxFailures int
+	Lockout     time.Duration
+	Store       ThrottleStore                       //a SessionThrottleStore on the session store of the app by default
+	Key         func(c *Action, user string) string //the user name by default
+	OnLockout   func(c *Action, user string)        //called when a user gets locked out
+	storeOnce   sync.Once
+}
+
+func NewLoginThrottle(maxFailures int, lockout time.Duration) *LoginThrottle {
+	return &LoginThrottle{MaxFailures: maxFailures, Lockout: lockout}
+}
+
+// store returns the Store, by default the session store of the app, so
+// that the lockouts hold on every server. Without sessions the counters
+// can only be kept in memory.
+func (t *LoginThrottle) store(c *Action) ThrottleStore {
+	t.storeOnce.Do(func() {
+		if t.Store != nil {
+			return
+		}
+		if c != nil && c.App.AppConfig.SessionOn && c.App.SessionManager != nil {
+			t.Store = NewSessionThrottleStore(c.App.SessionManager.Store(), c.App.AppConfig.CookieSecret)
+			return
+		}
+		if c != nil {
+			c.Warn("no session store for the login throttle, the failures are counted in memory")
+		}
+		t.Store = NewMemoryThrottleStore()
+	})
+	return t.Store
+}
+
+func (t *LoginThrottle) key(c *Action, user string) string {
+	if t.Key != nil {
+		return t.Key(c, user)
+	}
+	return user
+}
+
+// Locked returns how long the user is still locked out.
+func (t *LoginThrottle) Locked(c *Action, user string) time.Duration {
+	return t.store(c).Locked(t.key(c, user), time.Now())
+}
+
+// Attempt counts a login of the user as failed before its password is
+// checked, so that guesses sent in parallel can't get past MaxFailures.
+// Call done with the result of the check, a good password clears the
+// failures. Locked users get ErrLockedOut.
+func (t *LoginThrottle) Attempt(c *Action, user string) (done func(ok bool), err error) {
+	key := t.key(c, user)
+	wait, last, err := t.store(c).Attempt(key, t.MaxFailures, t.Lockout, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, ErrLockedOut
+	}
+	return func(ok bool) {
+		if ok {
+			t.store(c).Reset(key)
+			return
+		}
+		if last {
+			c.Warnf("login of %q locked for %v", user, t.Lockout)
+			if t.OnLockout != nil {
+				t.OnLockout(c, user)
+			}
+		}
+	}, nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// verifyPassword takes as long for an empty hash as for a real one, so
+// that the time of a login does not tell which users exist.
+func verifyPassword(password, encoded string) (bool, string, error) {
+	if encoded != "" {
+		return passwd.Verify(password, encoded)
+	}
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = passwd.Hash("xweb")
+	})
+	passwd.Verify(password, dummyHash)
+	return false, "", nil
+}
+
+// CheckPassword checks a login against the hash stored for the user, made
+// by passwd.Hash. Pass an empty hash for unknown users, it takes as long
+// as a real check. When the hash
+// is outdated, rehash is called with a new one to store instead. Failures
+// are counted by App.LoginThrottle, locked users get ErrLockedOut.
+func (c *Action) CheckPassword(user, password, encoded string, rehash func(newHash string)) error {
+	var done func(ok bool)
+	if t := c.App.LoginThrottle; t != nil {
+		var err error
+		if done, err = t.Attempt(c, user); err != nil {
+			return err
+		}
+	}
+	ok, newHash, err := verifyPassword(password, encoded)
+	if err != nil {
+		c.Warnf("password hash of %q: %v", user, err)
+	}
+	if done != nil {
+		done(ok)
+	}
+	if !ok {
+		return ErrUnauthorized
+	}
+	if newHash != "" && rehash != nil {
+		rehash(newHash)
+	}
+	return nil
+}
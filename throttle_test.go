@@ -0,0 +1,158 @@
+package xweb
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coscms/xweb/httpsession"
+)
+
+func newThrottledServer(t *testing.T, auth *BasicAuth, throttle *LoginThrottle) *Server {
+	return newTestServer(t, func(a *App) {
+		a.Auth = NewAuth("", auth)
+		a.LoginThrottle = throttle
+	}, map[string]interface{}{"/": &authAction{}})
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	throttle := NewLoginThrottle(3, time.Minute)
+	var lockouts int
+	throttle.OnLockout = func(c *Action, user string) {
+		lockouts++
+	}
+	auth := NewBasicAuthUsers("test", map[string]string{"alice": "secret"})
+	client := newTestClient(newThrottledServer(t, auth, throttle))
+
+	// a good password clears the failures
+	for _, password := range []string{"a", "b", "secret", "c", "d", "secret"} {
+		whoami(t, client, "Authorization", basic("alice", password))
+	}
+	if lockouts != 0 {
+		t.Fatal("failures in between good logins should not lock")
+	}
+	for i := 0; i < 3; i++ {
+		whoami(t, client, "Authorization", basic("alice", "guess"))
+	}
+	if lockouts != 1 {
+		t.Errorf("expected one lockout, got %d", lockouts)
+	}
+	if id := whoami(t, client, "Authorization", basic("alice", "secret")); id != "" {
+		t.Error("a locked user should not log in, not even with the right password")
+	}
+	if d := throttle.Locked(nil, "alice"); d <= 0 || d > time.Minute {
+		t.Errorf("alice should be locked for a minute, got %v", d)
+	}
+	if throttle.Locked(nil, "bob") != 0 {
+		t.Error("other users should not be locked")
+	}
+	if _, ok := throttle.Store.(*SessionThrottleStore); !ok {
+		t.Errorf("the failures should be kept in the session store, got %T", throttle.Store)
+	}
+}
+
+// casless hides the CompareAndSwap of a store.
+type casless struct {
+	httpsession.Store
+}
+
+func TestSessionThrottleStoreShared(t *testing.T) {
+	for name, store := range map[string]httpsession.Store{
+		"cas":   httpsession.NewMemoryStore(time.Hour),
+		"plain": casless{httpsession.NewMemoryStore(time.Hour)},
+	} {
+		// two servers with the same secret
+		a := NewSessionThrottleStore(store, "secret")
+		b := NewSessionThrottleStore(store, "secret")
+		now := time.Now()
+		var wg sync.WaitGroup
+		var lasts int32
+		for i := 0; i < 20; i++ {
+			attempt := func(s ThrottleStore) {
+				defer wg.Done()
+				if _, last, err := s.Attempt("alice", 20, time.Minute, now); err != nil {
+					t.Error(err)
+				} else if last {
+					atomic.AddInt32(&lasts, 1)
+				}
+			}
+			wg.Add(1)
+			// only a CASStore counts parallel attempts of two servers
+			if name == "cas" {
+				go attempt([]ThrottleStore{a, b}[i%2])
+			} else {
+				attempt([]ThrottleStore{a, b}[i%2])
+			}
+		}
+		wg.Wait()
+		if lasts != 1 {
+			t.Errorf("%s: the attempts of both servers should be counted, got %d lockouts", name, lasts)
+		}
+		if d := b.Locked("alice", now); d != time.Minute {
+			t.Errorf("%s: alice should be locked on every server, got %v", name, d)
+		}
+		if store.Exist(httpsession.Id("alice")) {
+			t.Errorf("%s: the user name should not be a session id", name)
+		}
+		a.Reset("alice")
+		if b.Locked("alice", now) != 0 {
+			t.Errorf("%s: a reset should clear the lockout everywhere", name)
+		}
+	}
+}
+
+func TestThrottleStoreExpiry(t *testing.T) {
+	store := NewMemoryThrottleStore()
+	now := time.Now()
+	attempt := func(at time.Duration) (time.Duration, bool) {
+		wait, last, err := store.Attempt("alice", 3, time.Minute, now.Add(at))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return wait, last
+	}
+	attempt(0)
+	attempt(time.Second)
+	if wait, last := attempt(2 * time.Second); wait != 0 || !last {
+		t.Fatal("the third failure should lock")
+	}
+	if wait, _ := attempt(32 * time.Second); wait != 30*time.Second {
+		t.Errorf("expected 30s to wait, got %v", wait)
+	}
+	if wait, last := attempt(62 * time.Second); wait != 0 || last {
+		t.Errorf("the lockout should be over and counting start again, got %v %v", wait, last)
+	}
+
+	// failures which are older than the lockout are forgotten
+	attempt(63 * time.Second)
+	if _, last := attempt(3 * time.Minute); last {
+		t.Error("failures older than the lockout should not count")
+	}
+}
+
+func TestLoginThrottleConcurrentFailures(t *testing.T) {
+	var checks int32
+	auth := &BasicAuth{Realm: "test", Check: func(user, password string) (*Principal, error) {
+		atomic.AddInt32(&checks, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil, ErrUnauthorized
+	}}
+	s := newThrottledServer(t, auth, NewLoginThrottle(5, time.Minute))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/me", nil)
+			req.SetBasicAuth("alice", "guess")
+			newTestClient(s).do(req)
+		}()
+	}
+	wg.Wait()
+	if checks != 5 {
+		t.Errorf("parallel guesses should stop at 5 checks, got %d", checks)
+	}
+}
@@ -0,0 +1,151 @@
+package xweb
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TemplateCache keeps compiled templates, so that a template is parsed once
+// instead of on every Render. Entries are keyed by the template name and the
+// names of the functions it was parsed with, the functions themselves are
+// bound again for every execution. html/template escapes a template on its
+// first execution and can't be cloned after that, so every entry keeps an
+// unexecuted master and a pool of escaped clones, each used by one request
+// at a time.
+type TemplateCache struct {
+	Delims  [2]string //left and right, {{ and }} when empty
+	lock    sync.RWMutex
+	entries map[string]*compiledTemplate
+}
+
+type compiledTemplate struct {
+	files  []templateFile
+	master *template.Template
+	pool   sync.Pool
+}
+
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{entries: make(map[string]*compiledTemplate)}
+}
+
+// funcsSignature is the sorted list of the function names.
+func funcsSignature(funcs template.FuncMap) string {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func stubFunc() interface{} {
+	return nil
+}
+
+// compile parses with stubs, so that the master does not keep the
+// functions, and the request, of the first render. Executing the master
+// runs the first file, the others add or redefine templates, like the
+// blocks of a layout chain.
+func (tc *TemplateCache) compile(files []templateFile, funcs template.FuncMap) (*compiledTemplate, error) {
+	stubs := make(template.FuncMap, len(funcs))
+	for name := range funcs {
+		stubs[name] = stubFunc
+	}
+	master := template.New(files[0].Name).Delims(tc.Delims[0], tc.Delims[1]).Funcs(stubs)
+	if _, err := master.Parse(files[0].Source); err != nil {
+		return nil, err
+	}
+	for _, f := range files[1:] {
+		if _, err := master.New(f.Name).Parse(f.Source); err != nil {
+			return nil, err
+		}
+	}
+	return &compiledTemplate{files: files, master: master}, nil
+}
+
+func (entry *compiledTemplate) changed(files []templateFile) bool {
+	if len(files) != len(entry.files) {
+		return true
+	}
+	for i, f := range files {
+		if f != entry.files[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the template compiled from source, bound to funcs. It is
+// compiled again when the source has changed. Call release when the
+// template has been executed, it must not be used after that.
+func (tc *TemplateCache) Get(name, source string, funcs template.FuncMap) (t *template.Template, release func(), err error) {
+	return tc.get("", []templateFile{{name, source}}, funcs)
+}
+
+// get compiles a list of files, see compile. Entries are keyed by the
+// names of the files and by scope, the files of a theme are in another.
+func (tc *TemplateCache) get(scope string, files []templateFile, funcs template.FuncMap) (t *template.Template, release func(), err error) {
+	names := make([]string, len(files)+2)
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	names[len(files)] = funcsSignature(funcs)
+	names[len(files)+1] = scope
+	key := strings.Join(names, "\x00")
+	tc.lock.RLock()
+	entry, ok := tc.entries[key]
+	tc.lock.RUnlock()
+	if !ok || entry.changed(files) {
+		entry, err = tc.compile(files, funcs)
+		if err != nil {
+			return nil, nil, err
+		}
+		tc.lock.Lock()
+		tc.entries[key] = entry
+		tc.lock.Unlock()
+	}
+	t, _ = entry.pool.Get().(*template.Template)
+	if t == nil {
+		if t, err = entry.master.Clone(); err != nil {
+			return nil, nil, err
+		}
+	}
+	t.Funcs(funcs)
+	return t, func() {
+		entry.pool.Put(t)
+	}, nil
+}
+
+// once compiles the files for one render, for templates which are not worth
+// keeping, like the content given to RenderString.
+func (tc *TemplateCache) once(files []templateFile, funcs template.FuncMap) (t *template.Template, release func(), err error) {
+	entry, err := tc.compile(files, funcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.master.Funcs(funcs), func() {}, nil
+}
+
+// Delete drops the compiled versions of a template and of the pages which
+// use it as a layout, the TemplateMgr watcher calls it when the file
+// changes.
+func (tc *TemplateCache) Delete(name string) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	for key, entry := range tc.entries {
+		for _, f := range entry.files {
+			if f.Name == name {
+				delete(tc.entries, key)
+				break
+			}
+		}
+	}
+}
+
+func (tc *TemplateCache) Clear() {
+	tc.lock.Lock()
+	tc.entries = make(map[string]*compiledTemplate)
+	tc.lock.Unlock()
+}
@@ -0,0 +1,228 @@
+package xweb
+
+import (
+	"html/template"
+	"io"
+	"io/fs"
+	"sort"
+	"sync"
+
+	"github.com/coscms/xweb/lib/tplex"
+)
+
+// TemplateEngine renders the templates of Action.Render, set it as
+// App.TemplateEngine. HtmlTemplateEngine is the default one, TplexEngine
+// understands the templates of lib/tplex. Other template languages can be
+// plugged in the same way.
+type TemplateEngine interface {
+	// Load compiles a template, to report its errors early. Functions
+	// which actions Assign are not known yet.
+	Load(name string) error
+	// Render executes the template into w. The functions of the request
+	// are c.GetFuncs(), data is the action.
+	Render(w io.Writer, name string, data interface{}, c *Action) error
+	// Funcs adds functions for all the templates of the engine.
+	Funcs(funcs template.FuncMap)
+	// Reload drops what the engine has cached.
+	Reload()
+}
+
+// engineFuncs keeps the functions added by Funcs, copy on write.
+type engineFuncs struct {
+	lock  sync.RWMutex
+	funcs template.FuncMap
+}
+
+func (e *engineFuncs) Funcs(funcs template.FuncMap) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	merged := make(template.FuncMap, len(e.funcs)+len(funcs))
+	for k, v := range e.funcs {
+		merged[k] = v
+	}
+	for k, v := range funcs {
+		merged[k] = v
+	}
+	e.funcs = merged
+}
+
+// requestFuncs puts the functions of the engine between the ones of the
+// app and the ones of the request.
+func (e *engineFuncs) requestFuncs(c *Action) template.FuncMap {
+	funcs := c.GetFuncs()
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for k, v := range e.funcs {
+		if _, ok := c.f[k]; !ok {
+			funcs[k] = v
+		}
+	}
+	return funcs
+}
+
+// loadFuncs are the functions known when a template is loaded without a
+// request, only their names matter.
+func (e *engineFuncs) loadFuncs(app *App) template.FuncMap {
+	c := &Action{App: app, f: T{}}
+	c.f = c.requestFuncs()
+	return e.requestFuncs(c)
+}
+
+// HtmlTemplateEngine renders with html/template, templates are read by
+// App.TemplateMgr, compiled by App.TemplateCache and can extend layouts.
+type HtmlTemplateEngine struct {
+	App *App
+	engineFuncs
+}
+
+func NewHtmlTemplateEngine(app *App) *HtmlTemplateEngine {
+	return &HtmlTemplateEngine{App: app}
+}
+
+func (e *HtmlTemplateEngine) Load(name string) error {
+	content, err := e.App.templateContent(name)
+	if err != nil {
+		return err
+	}
+	files, err := e.App.layoutChain(nil, name, string(content), e.App.AppConfig.Layout)
+	if err != nil {
+		return err
+	}
+	_, err = e.App.TemplateCache.compile(files, e.loadFuncs(e.App))
+	return err
+}
+
+// Render puts templates which extend nothing into c.Layout.
+func (e *HtmlTemplateEngine) Render(w io.Writer, name string, data interface{}, c *Action) error {
+	return e.render(w, name, c.Layout, data, c)
+}
+
+func (e *HtmlTemplateEngine) render(w io.Writer, name, layout string, data interface{}, c *Action) error {
+	content, err := e.App.themeContent(c, name)
+	if err != nil {
+		return err
+	}
+	return e.renderContent(w, name, string(content), layout, data, c, true)
+}
+
+// renderContent keeps the compiled template in App.TemplateCache when cached.
+func (e *HtmlTemplateEngine) renderContent(w io.Writer, name, content, layout string, data interface{}, c *Action, cached bool) error {
+	Event("BeforeRender", &ActionInformation{c, &content, nil}, func(_ bool) {})
+
+	files, err := e.App.layoutChain(c, name, content, layout)
+	if err != nil {
+		return err
+	}
+	var tmpl *template.Template
+	var release func()
+	if cached {
+		// the same names are other files in another theme
+		tmpl, release, err = e.App.TemplateCache.get(c.Theme(), files, e.requestFuncs(c))
+	} else {
+		tmpl, release, err = e.App.TemplateCache.once(files, e.requestFuncs(c))
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+	// RootTemplate is only valid while it executes, the compiled template
+	// goes back to the cache afterwards
+	c.RootTemplate = tmpl
+	err = tmpl.Execute(w, data)
+	c.RootTemplate = nil
+	return err
+}
+
+func (e *HtmlTemplateEngine) Reload() {
+	e.App.TemplateCache.Clear()
+	if e.App.AppConfig.CacheTemplates && e.App.TemplateMgr != nil {
+		e.App.TemplateMgr.ClearCache()
+	}
+}
+
+// TplexEngine renders the templates of lib/tplex: include tags, such as
+// {{Include "header"}}, and custom delimiters. The templates are compiled
+// by a TemplateCache of its own, which binds the functions of every
+// request.
+type TplexEngine struct {
+	*tplex.TemplateEx
+	App *App
+	engineFuncs
+	cache *TemplateCache
+}
+
+// appTemplates reads the templates of the app like HtmlTemplateEngine
+// does, so that tplex finds them in AppConfig.TemplateFS and cached by
+// App.TemplateMgr.
+type appTemplates struct {
+	app *App
+}
+
+func (t appTemplates) Open(name string) (fs.File, error) {
+	return t.app.templateFS().Open(name)
+}
+
+func (t appTemplates) ReadFile(name string) ([]byte, error) {
+	return t.app.templateContent(name)
+}
+
+func NewTplexEngine(app *App) *TplexEngine {
+	ex := tplex.New(app.Logger, app.AppConfig.TemplateDir)
+	ex.FS = appTemplates{app}
+	e := &TplexEngine{TemplateEx: ex, App: app, cache: NewTemplateCache()}
+	e.cache.Delims = [2]string{ex.DelimLeft, ex.DelimRight}
+	return e
+}
+
+// Delims changes the delimiters, before the engine is used.
+func (e *TplexEngine) Delims(left, right string) {
+	e.DelimLeft, e.DelimRight = left, right
+	e.cache.Delims = [2]string{left, right}
+	e.Reload()
+}
+
+// files returns the template and its includes, sorted so that the cache
+// sees the same list every time.
+func (e *TplexEngine) files(name string) ([]templateFile, error) {
+	content, subs, err := e.Sources(name)
+	if err != nil {
+		return nil, err
+	}
+	files := []templateFile{{name, content}}
+	names := make([]string, 0, len(subs))
+	for sub := range subs {
+		names = append(names, sub)
+	}
+	sort.Strings(names)
+	for _, sub := range names {
+		files = append(files, templateFile{sub + "#define", subs[sub]})
+	}
+	return files, nil
+}
+
+func (e *TplexEngine) Load(name string) error {
+	files, err := e.files(name)
+	if err != nil {
+		return err
+	}
+	_, err = e.cache.compile(files, e.loadFuncs(e.App))
+	return err
+}
+
+func (e *TplexEngine) Render(w io.Writer, name string, data interface{}, c *Action) error {
+	files, err := e.files(name)
+	if err != nil {
+		return err
+	}
+	tmpl, release, err := e.cache.get("", files, e.requestFuncs(c))
+	if err != nil {
+		return err
+	}
+	defer release()
+	return tmpl.Execute(w, data)
+}
+
+func (e *TplexEngine) Reload() {
+	e.cache.Clear()
+	e.TemplateEx.Reload()
+}
@@ -56,6 +56,12 @@ func (r *ValidationResult) Message(message string, args ...interface{}) *Validat
 type Validation struct {
 	Errors    []*ValidationError
 	ErrorsMap map[string]*ValidationError
+
+	// Messages, when set, returns the message template of a validator by
+	// its name, like MessageTmpls, to translate the messages. An empty
+	// template keeps the default message. In xweb actions, build the
+	// validation with c.NewValidation to use the catalogs of App.I18n.
+	Messages func(name string) string
 }
 
 func (v *Validation) Clear() {
@@ -194,6 +200,12 @@ func (v *Validation) apply(chk Validator, obj interface{}) *ValidationResult {
 		Tmpl:       MessageTmpls[Name],
 		LimitValue: chk.GetLimitValue(),
 	}
+	if v.Messages != nil {
+		if tmpl := v.Messages(reflect.TypeOf(chk).Name()); tmpl != "" {
+			err.Tmpl = tmpl
+			err.Message = formatMessage(tmpl, err.LimitValue)
+		}
+	}
 	v.setError(err)
 
 	// Also return it in the result.
@@ -203,6 +215,21 @@ func (v *Validation) apply(chk Validator, obj interface{}) *ValidationResult {
 	}
 }
 
+// formatMessage fills a message template with the limit of its validator.
+func formatMessage(tmpl string, limit interface{}) string {
+	switch v := limit.(type) {
+	case nil:
+		return tmpl
+	case []int:
+		args := make([]interface{}, len(v))
+		for i, n := range v {
+			args[i] = n
+		}
+		return fmt.Sprintf(tmpl, args...)
+	}
+	return fmt.Sprintf(tmpl, limit)
+}
+
 func (v *Validation) setError(err *ValidationError) {
 	v.Errors = append(v.Errors, err)
 	if v.ErrorsMap == nil {
@@ -409,3 +409,18 @@ func TestValid(t *testing.T) {
 		t.Errorf("Message key should be `UserExt2.UserExt3.Domain|Match` but got %s", valid.Errors[0].Key)
 	}
 }
+
+func TestMessages(t *testing.T) {
+	valid := Validation{Messages: func(name string) string {
+		return map[string]string{"Range": "entre %d et %d", "Required": "obligatoire"}[name]
+	}}
+	if msg := valid.Range(12, 1, 10, "range").Error.Message; msg != "entre 1 et 10" {
+		t.Error("Range message should be translated, got", msg)
+	}
+	if msg := valid.Required("", "required").Error.Message; msg != "obligatoire" {
+		t.Error("Required message should be translated, got", msg)
+	}
+	if msg := valid.Min(0, 1, "min").Error.Message; msg != "Minimum is 1" {
+		t.Error("Min message should be the default one, got", msg)
+	}
+}
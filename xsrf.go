@@ -0,0 +1,168 @@
+package xweb
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+const XSRF_HEADER string = "X-XSRF-Token"
+
+var (
+	ErrXsrfToken  = errors.New("xsrf token error.")
+	ErrXsrfOrigin = errors.New("xsrf origin error.")
+)
+
+// methods which must not change anything, they are never checked
+var xsrfSafeMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"TRACE":   true,
+}
+
+// newXsrfManager gives every request its own copy of the App's XsrfManager,
+// because Init binds it to the Action.
+func (a *App) newXsrfManager(c *Action) XsrfManager {
+	m := a.XsrfManager
+	if v := reflect.ValueOf(m); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		n := reflect.New(v.Elem().Type())
+		n.Elem().Set(v.Elem())
+		m = n.Interface().(XsrfManager)
+	}
+	m.Init(c)
+	return m
+}
+
+// xsrfExempt reports whether the Mapper of the method is tagged xsrf:"-"
+func (a *App) xsrfExempt(t reflect.Type, method string) bool {
+	tag := a.MapperTag(t, method).Get("xsrf")
+	return tag == "-" || tag == "false"
+}
+
+// xsrfMaskPrefix marks masked tokens, a token without it is taken as it is.
+const xsrfMaskPrefix = "m1."
+
+// maskXsrfToken xors the token with a random pad which is sent along, so
+// the token looks different in every response and can not be recovered
+// by compression side channels such as BREACH.
+func maskXsrfToken(token string) string {
+	pad := make([]byte, len(token))
+	if _, err := rand.Read(pad); err != nil {
+		return token
+	}
+	out := make([]byte, len(token)*2)
+	copy(out, pad)
+	for i := 0; i < len(token); i++ {
+		out[len(token)+i] = token[i] ^ pad[i]
+	}
+	return xsrfMaskPrefix + base64.RawURLEncoding.EncodeToString(out)
+}
+
+// unmaskXsrfToken returns the token as it is when it was not masked, and
+// nothing when the masked token is broken.
+func unmaskXsrfToken(masked string) string {
+	if !strings.HasPrefix(masked, xsrfMaskPrefix) {
+		return masked
+	}
+	b, err := base64.RawURLEncoding.DecodeString(masked[len(xsrfMaskPrefix):])
+	if err != nil || len(b) == 0 || len(b)%2 != 0 {
+		return ""
+	}
+	n := len(b) / 2
+	token := make([]byte, n)
+	for i := 0; i < n; i++ {
+		token[i] = b[i] ^ b[n+i]
+	}
+	return string(token)
+}
+
+// xsrfRequestToken looks for the token in the form, the X-XSRF-Token
+// header and a json body, in this order.
+func (c *Action) xsrfRequestToken() string {
+	if vals := c.Request.Form[XSRF_TAG]; len(vals) > 0 && vals[0] != "" {
+		return vals[0]
+	}
+	if token := c.Request.Header.Get(XSRF_HEADER); token != "" {
+		return token
+	}
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "json") {
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &body); err == nil {
+			if token, ok := body[XSRF_TAG].(string); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// xsrfOriginValid compares the Origin, or the Referer when there is no
+// Origin, with the scheme and host of the request and the trusted origins.
+// Requests without both headers are not from a browser and only need the
+// token.
+func (c *Action) xsrfOriginValid() bool {
+	origin := c.Request.Header.Get("Origin")
+	if origin == "" {
+		origin = c.Request.Referer()
+		if origin == "" {
+			return true
+		}
+	}
+	if origin == "null" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, c.Request.Host) && strings.EqualFold(u.Scheme, c.requestScheme()) {
+		return true
+	}
+	for _, trusted := range c.App.AppConfig.XsrfOrigins {
+		if t, err := url.Parse(trusted); err == nil && t.Host != "" {
+			if t.Scheme != u.Scheme {
+				continue
+			}
+			trusted = t.Host
+		}
+		if strings.HasPrefix(trusted, "*.") {
+			if strings.HasSuffix(strings.ToLower(u.Host), strings.ToLower(trusted[1:])) {
+				return true
+			}
+		} else if strings.EqualFold(u.Host, trusted) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkXsrf validates requests with unsafe methods
+func (c *Action) checkXsrf() error {
+	if xsrfSafeMethods[c.Request.Method] {
+		return nil
+	}
+	if !c.xsrfOriginValid() {
+		return ErrXsrfOrigin
+	}
+	token := c.xsrfRequestToken()
+	if token == "" {
+		return ErrXsrfToken
+	}
+	name := c.App.AppConfig.CookiePrefix + XSRF_TAG
+	if !c.xsrfManager().Valid(name, unmaskXsrfToken(token)) {
+		return ErrXsrfToken
+	}
+	return nil
+}
+
+// xsrfTokenEqual compares the stored token with the one of the request in
+// constant time, for the Valid methods of the XsrfManagers.
+func xsrfTokenEqual(stored, token string) bool {
+	return stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(token)) == 1
+}
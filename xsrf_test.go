@@ -0,0 +1,143 @@
+package xweb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type xsrfAction struct {
+	*Action
+
+	form Mapper `xweb:"/form"`
+	save Mapper `xweb:"GET|POST|PUT|DELETE /save"`
+	hook Mapper `xweb:"POST /hook" xsrf:"-"`
+}
+
+func (c *xsrfAction) Form() string {
+	return c.XsrfValue()
+}
+
+func (c *xsrfAction) Save() string {
+	return "saved"
+}
+
+func (c *xsrfAction) Hook() string {
+	return "hooked"
+}
+
+// strictXsrf accepts no token at all
+type strictXsrf struct {
+	XsrfCookieStorage
+}
+
+func (c *strictXsrf) Valid(key, val string) bool {
+	return false
+}
+
+func newXsrfServer(t *testing.T, manager XsrfManager) *Server {
+	return newTestServer(t, func(a *App) {
+		a.AppConfig.CheckXsrf = true
+		a.AppConfig.CookieSecret = "secret"
+		if manager != nil {
+			a.XsrfManager = manager
+		}
+	}, map[string]interface{}{"/": &xsrfAction{}})
+}
+
+func postForm(client *testClient, path string, form url.Values) *http.Response {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.do(req).Result()
+}
+
+func TestXsrf(t *testing.T) {
+	client := newTestClient(newXsrfServer(t, nil))
+	if w := client.get("/save"); w.Code != 200 || w.Body.String() != "saved" {
+		t.Errorf("a GET should not be checked, got %v %q", w.Code, w.Body.String())
+	}
+	if resp := postForm(client, "/save", nil); resp.StatusCode != 403 {
+		t.Errorf("a POST without token should be forbidden, got %v", resp.StatusCode)
+	}
+	if resp := postForm(client, "/hook", nil); resp.StatusCode != 200 {
+		t.Errorf("an exempt method should not be checked, got %v", resp.StatusCode)
+	}
+
+	token := client.get("/form").Body.String()
+	if resp := postForm(client, "/save", url.Values{XSRF_TAG: {token}}); resp.StatusCode != 200 {
+		t.Errorf("a POST with the token should pass, got %v", resp.StatusCode)
+	}
+	if resp := postForm(client, "/save", url.Values{XSRF_TAG: {token + "x"}}); resp.StatusCode != 403 {
+		t.Errorf("a wrong token should be forbidden, got %v", resp.StatusCode)
+	}
+	req, _ := http.NewRequest("DELETE", "/save", nil)
+	req.Header.Set(XSRF_HEADER, client.get("/form").Body.String())
+	if w := client.do(req); w.Code != 200 {
+		t.Errorf("the token of the header should pass, got %v", w.Code)
+	}
+	req, _ = http.NewRequest("PUT", "/save", nil)
+	req.Header.Set(XSRF_HEADER, token)
+	req.Header.Set("Origin", "https://evil.example.com")
+	if w := client.do(req); w.Code != 403 {
+		t.Errorf("another origin should be forbidden, got %v", w.Code)
+	}
+}
+
+func TestXsrfManagerValid(t *testing.T) {
+	client := newTestClient(newXsrfServer(t, &strictXsrf{}))
+	token := client.get("/form").Body.String()
+	if resp := postForm(client, "/save", url.Values{XSRF_TAG: {token}}); resp.StatusCode != 403 {
+		t.Errorf("the Valid method of the manager should decide, got %v", resp.StatusCode)
+	}
+}
+
+func TestXsrfMaskedToken(t *testing.T) {
+	token := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	masked := maskXsrfToken(token)
+	if !strings.HasPrefix(masked, xsrfMaskPrefix) || masked == maskXsrfToken(token) {
+		t.Errorf("a masked token should be marked and differ every time, got %q", masked)
+	}
+	if got := unmaskXsrfToken(masked); got != token {
+		t.Errorf("expected the token back, got %q", got)
+	}
+	// tokens of any length which are not marked are taken as they are
+	for _, raw := range []string{token, "abcd", token + "12"} {
+		if got := unmaskXsrfToken(raw); got != raw {
+			t.Errorf("expected %q as it is, got %q", raw, got)
+		}
+	}
+	if got := unmaskXsrfToken(xsrfMaskPrefix + "not base64!"); got != "" {
+		t.Errorf("a broken masked token should be rejected, got %q", got)
+	}
+}
+
+func TestXsrfOriginScheme(t *testing.T) {
+	s := newXsrfServer(t, nil)
+	s.RootApp.AppConfig.TrustedProxies = []string{"192.0.2.1"}
+	client := newTestClient(s)
+	token := client.get("/form").Body.String()
+	put := func(origin, proto string) int {
+		req, _ := http.NewRequest("PUT", "http://example.com/save", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set(XSRF_HEADER, token)
+		req.Header.Set("Origin", origin)
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		return client.do(req).Code
+	}
+	if code := put("http://example.com", ""); code != 200 {
+		t.Errorf("the same origin should pass, got %v", code)
+	}
+	if code := put("https://example.com", ""); code != 403 {
+		t.Errorf("another scheme should be forbidden, got %v", code)
+	}
+	if code := put("https://example.com", "https"); code != 200 {
+		t.Errorf("the scheme of a trusted proxy should count, got %v", code)
+	}
+	s.RootApp.AppConfig.TrustedProxies = nil
+	if code := put("https://example.com", "https"); code != 403 {
+		t.Errorf("X-Forwarded-Proto of an untrusted client should not count, got %v", code)
+	}
+}
@@ -16,7 +16,11 @@ type XsrfCookieStorage struct {
 func (c *XsrfCookieStorage) Get(key string) string {
 	var val string
 	if res, err := c.Request.Cookie(key); err == nil && res.Value != "" {
-		val = c.App.Cryptor.Decode(res.Value, c.App.AppConfig.CookieSecret)
+		val, err = c.App.Cryptor.Decode(res.Value, c.App.AppConfig.CookieSecret)
+		if err != nil {
+			c.Warnf("xsrf cookie rejected: %v", err)
+			return ""
+		}
 	}
 	return val
 }
@@ -27,7 +31,7 @@ func (c *XsrfCookieStorage) Set(key, val string) {
 }
 
 func (c *XsrfCookieStorage) Valid(key, val string) bool {
-	return c.Get(key) == val
+	return xsrfTokenEqual(c.Get(key), val)
 }
 
 func (c *XsrfCookieStorage) Init(a *Action) {
@@ -39,15 +43,21 @@ type XsrfSessionStorage struct {
 }
 
 func (c *XsrfSessionStorage) Get(key string) string {
-	return c.Session().Get(key).(string)
+	if c.App.SessionManager == nil {
+		return ""
+	}
+	val, _ := c.Session().Get(key).(string)
+	return val
 }
 
 func (c *XsrfSessionStorage) Set(key, val string) {
-	c.Session().Set(key, val)
+	if c.App.SessionManager != nil {
+		c.Session().Set(key, val)
+	}
 }
 
 func (c *XsrfSessionStorage) Valid(key, val string) bool {
-	return c.Get(key) == val
+	return xsrfTokenEqual(c.Get(key), val)
 }
 
 func (c *XsrfSessionStorage) Init(a *Action) {